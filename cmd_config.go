@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	stateabi "github.com/iden3/contracts-abi/state/go/abi"
+	core "github.com/iden3/go-iden3-core/v2"
+	"github.com/iden3/go-iden3-core/v2/w3c"
+	"github.com/iden3/go-service-template/config"
+	"github.com/iden3/go-service-template/pkg/contracts/onchainissuer"
+	"github.com/iden3/go-service-template/pkg/ethrpc"
+	"github.com/pkg/errors"
+)
+
+const configUsage = `Usage: %s config <command> [flags]
+
+Commands:
+  print   print the effective config with the secrets redacted
+  check   validate the config and test the rpc urls, state and issuer contracts
+`
+
+// runConfigCommand runs the config subcommands and returns the exit code.
+func runConfigCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintf(stderr, configUsage, os.Args[0])
+		return 2
+	}
+
+	fs := flag.NewFlagSet("config "+args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "", "path to the YAML or TOML config file")
+	format := fs.String("format", "yaml", "output format of print: yaml or toml")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to parse config: %v\n", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "print":
+		if err := cfg.FileForm().Redacted().Encode(stdout, *format); err != nil {
+			fmt.Fprintf(stderr, "failed to print config: %v\n", err)
+			return 1
+		}
+		return 0
+	case "check":
+		if err := cfg.Validate(); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintln(stdout, "config is valid")
+		if !checkConnectivity(context.Background(), cfg, stdout) {
+			return 1
+		}
+		return 0
+	default:
+		fmt.Fprintf(stderr, configUsage, os.Args[0])
+		return 2
+	}
+}
+
+// checkConnectivity tests every rpc url, state contract and issuer
+// contract, and reports the results. It returns false on any failure.
+func checkConnectivity(ctx context.Context, cfg *config.Config, w io.Writer) bool {
+	ok := true
+	report := func(err error, format string, args ...interface{}) {
+		status := "OK  "
+		if err != nil {
+			status = "FAIL"
+			ok = false
+		}
+		fmt.Fprintf(w, "%s %s", status, fmt.Sprintf(format, args...))
+		if err != nil {
+			fmt.Fprintf(w, ": %v", err)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if _, err := initializationChainRegistry(cfg); err != nil {
+		report(err, "chain registry")
+		return false
+	}
+
+	networks := make([]string, 0, len(cfg.SupportedRPC))
+	for network := range cfg.SupportedRPC {
+		networks = append(networks, network)
+	}
+	sort.Strings(networks)
+
+	callers := make(map[string]bind.ContractCaller)
+	for _, network := range networks {
+		for _, u := range cfg.SupportedRPC[network] {
+			client, err := checkRPC(ctx, cfg, network, u)
+			report(err, "rpc %s %s", network, ethrpc.RedactURL(u))
+			if err != nil {
+				continue
+			}
+			defer client.Close()
+			if _, found := callers[network]; !found {
+				callers[network] = client
+			}
+		}
+
+		stateContract, found := cfg.SupportedStateContracts[network]
+		caller, connected := callers[network]
+		if !found || !connected {
+			continue
+		}
+		report(checkStateContract(ctx, cfg, caller, stateContract),
+			"state contract %s %s", network, stateContract)
+	}
+
+	for _, issuerDID := range cfg.Issuers {
+		report(checkIssuer(ctx, cfg, callers, issuerDID), "issuer %s", issuerDID)
+	}
+	return ok
+}
+
+func checkRPC(ctx context.Context, cfg *config.Config, network, u string) (*ethclient.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.RPC.HealthCheckTimeout)
+	defer cancel()
+	client, err := ethclient.DialContext(ctx, u)
+	if err != nil {
+		return nil, ethrpc.RedactError(err, u)
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		client.Close()
+		return nil, ethrpc.RedactError(err, u)
+	}
+	if chainID.String() != network {
+		client.Close()
+		return nil, errors.Errorf("rpc is on chain %s", chainID)
+	}
+	return client, nil
+}
+
+func checkStateContract(ctx context.Context, cfg *config.Config, caller bind.ContractCaller, address string) error {
+	ctx, cancel := context.WithTimeout(ctx, cfg.RPC.HealthCheckTimeout)
+	defer cancel()
+	state, err := stateabi.NewStateCaller(common.HexToAddress(address), caller)
+	if err != nil {
+		return err
+	}
+	if _, err := state.GetDefaultIdType(&bind.CallOpts{Context: ctx}); err != nil {
+		return errors.Wrap(err, "not a state contract")
+	}
+	return nil
+}
+
+func checkIssuer(
+	ctx context.Context,
+	cfg *config.Config,
+	callers map[string]bind.ContractCaller,
+	issuerDID string,
+) error {
+	did, err := w3c.ParseDID(issuerDID)
+	if err != nil {
+		return err
+	}
+	id, err := core.IDFromDID(*did)
+	if err != nil {
+		return err
+	}
+	contract, err := core.EthAddressFromID(id)
+	if err != nil {
+		return err
+	}
+	chainID, err := core.ChainIDfromDID(*did)
+	if err != nil {
+		return err
+	}
+	caller, ok := callers[strconv.Itoa(int(chainID))]
+	if !ok {
+		return errors.Errorf("no reachable rpc for chain %d", chainID)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.RPC.HealthCheckTimeout)
+	defer cancel()
+	contractID, err := onchainissuer.NewIssuerCaller(common.Address(contract), caller).
+		GetID(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return errors.Wrap(err, "not an issuer contract")
+	}
+	if contractID.Cmp(id.BigInt()) != 0 {
+		return errors.Errorf("contract has id %s", contractID)
+	}
+	return nil
+}
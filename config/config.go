@@ -2,7 +2,9 @@ package config
 
 import (
 	"log/slog"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/iden3/go-service-template/pkg/logger"
 	"github.com/kelseyhightower/envconfig"
@@ -20,9 +22,12 @@ func (c *KVstring) Decode(value string) error {
 	pairs := strings.Split(value, ",")
 	for _, pair := range pairs {
 		kvpair := strings.Split(pair, "=")
-		if len(kvpair) != 2 {
+		if len(kvpair) != 2 || kvpair[0] == "" || kvpair[1] == "" {
 			return errors.Errorf("invalid map item: %q", pair)
 		}
+		if _, ok := contracts[kvpair[0]]; ok {
+			return errors.Errorf("duplicate map key: %q", kvpair[0])
+		}
 		contracts[kvpair[0]] = kvpair[1]
 
 	}
@@ -30,55 +35,318 @@ func (c *KVstring) Decode(value string) error {
 	return nil
 }
 
+// KVlist is a map of lists encoded as "key1=a|b,key2=c".
+type KVlist map[string][]string
+
+func (c *KVlist) Decode(value string) error {
+	lists := make(map[string][]string)
+	if value == "" {
+		*c = lists
+		return nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		kvpair := strings.SplitN(pair, "=", 2)
+		if len(kvpair) != 2 || kvpair[0] == "" {
+			return errors.Errorf("invalid map item: %q", pair)
+		}
+		for _, item := range strings.Split(kvpair[1], "|") {
+			if item == "" {
+				return errors.Errorf("empty list item in: %q", pair)
+			}
+			lists[kvpair[0]] = append(lists[kvpair[0]], item)
+		}
+	}
+	*c = KVlist(lists)
+	return nil
+}
+
 type Config struct {
-	Log        Log        `envconfig:"LOG"`
-	HTTPServer HTTPServer `envconfig:"HTTP_SERVER"`
+	Log        Log        `envconfig:"LOG" yaml:"log" toml:"log"`
+	HTTPServer HTTPServer `envconfig:"HTTP_SERVER" yaml:"httpServer" toml:"httpServer"`
+	Admin      Admin      `envconfig:"ADMIN" yaml:"admin" toml:"admin"`
+
+	ExternalHost string `envconfig:"EXTERNAL_HOST" yaml:"externalHost" toml:"externalHost"`
+
+	SupportedStateContracts KVstring `envconfig:"SUPPORTED_STATE_CONTRACTS" yaml:"-" toml:"-"`
+	// SupportedRPC is the list of rpc urls per chain ID, separated by '|'.
+	SupportedRPC KVlist `envconfig:"SUPPORTED_RPC" secret:"true" yaml:"-" toml:"-"`
+	RPC          RPC    `envconfig:"RPC" yaml:"rpc" toml:"rpc"`
+
+	StateCache StateCache `envconfig:"STATE_CACHE" yaml:"stateCache" toml:"stateCache"`
+
+	// Chains are the custom chains in addition to the built-in ones,
+	// in the form "chainID=method:blockchain:network:networkFlag".
+	Chains KVstring `envconfig:"CHAINS" yaml:"-" toml:"-"`
+
+	// Networks is the config file form of the state contracts,
+	// rpc urls and chains.
+	Networks []Network `ignored:"true" yaml:"networks" toml:"networks"`
+
+	MongoDBConnectionString string `envconfig:"MONGODB_CONNECTION_STRING" secret:"true" default:"mongodb://localhost:27017/credentials" yaml:"mongoDBConnectionString" toml:"mongoDBConnectionString"`
+
+	Issuers []string `envconfig:"ISSUERS" yaml:"-" toml:"-"`
+	// IssuerDetails is the config file form of the issuers.
+	IssuerDetails []Issuer `ignored:"true" yaml:"issuers" toml:"issuers"`
 
-	ExternalHost string `envconfig:"EXTERNAL_HOST" required:"true"`
+	KeysDirPath string `envconfig:"KEYS_DIR_PATH" default:"./keys" yaml:"keysDirPath" toml:"keysDirPath"`
 
-	SupportedStateContracts KVstring `envconfig:"SUPPORTED_STATE_CONTRACTS" required:"true"`
-	SupportedRPC            KVstring `envconfig:"SUPPORTED_RPC" required:"true"`
+	Indexer Indexer `envconfig:"INDEXER" yaml:"indexer" toml:"indexer"`
 
-	MongoDBConnectionString string `envconfig:"MONGODB_CONNECTION_STRING" default:"mongodb://localhost:27017/credentials"`
+	Tracing Tracing `envconfig:"TRACING" yaml:"tracing" toml:"tracing"`
 
-	Issuers []string `envconfig:"ISSUERS" required:"true"`
+	RateLimit RateLimit `envconfig:"RATE_LIMIT" yaml:"rateLimit" toml:"rateLimit"`
+
+	Auth Auth `envconfig:"AUTH" yaml:"auth" toml:"auth"`
+
+	Shutdown Shutdown `envconfig:"SHUTDOWN" yaml:"shutdown" toml:"shutdown"`
+
+	Readiness Readiness `envconfig:"READINESS" yaml:"readiness" toml:"readiness"`
+
+	Startup Startup `envconfig:"STARTUP" yaml:"startup" toml:"startup"`
+}
+
+// Network is a chain block of the config file.
+type Network struct {
+	ChainID       int      `yaml:"chainID" toml:"chainID"`
+	StateContract string   `yaml:"stateContract,omitempty" toml:"stateContract,omitempty"`
+	RPC           []string `yaml:"rpc" toml:"rpc"`
+	// DIDPrefix is the "method:blockchain:network" of the chain DIDs.
+	// It is checked against the built-in chains, or registers a custom
+	// chain when NetworkFlag is set.
+	DIDPrefix   string `yaml:"didPrefix,omitempty" toml:"didPrefix,omitempty"`
+	NetworkFlag string `yaml:"networkFlag,omitempty" toml:"networkFlag,omitempty"`
+}
+
+// Issuer is an issuer block of the config file.
+type Issuer struct {
+	DID         string `yaml:"did" toml:"did"`
+	Name        string `yaml:"name,omitempty" toml:"name,omitempty"`
+	Description string `yaml:"description,omitempty" toml:"description,omitempty"`
+	// StartBlock is the block the indexer starts from.
+	StartBlock uint64 `yaml:"startBlock,omitempty" toml:"startBlock,omitempty"`
+}
+
+type RPC struct {
+	Retries             int           `envconfig:"RETRIES" default:"2" yaml:"retries" toml:"retries"`
+	RetryBackoff        time.Duration `envconfig:"RETRY_BACKOFF" default:"200ms" yaml:"retryBackoff" toml:"retryBackoff"`
+	HealthCheckInterval time.Duration `envconfig:"HEALTH_CHECK_INTERVAL" default:"30s" yaml:"healthCheckInterval" toml:"healthCheckInterval"`
+	HealthCheckTimeout  time.Duration `envconfig:"HEALTH_CHECK_TIMEOUT" default:"5s" yaml:"healthCheckTimeout" toml:"healthCheckTimeout"`
+}
+
+type StateCache struct {
+	Enabled     bool          `envconfig:"ENABLED" default:"true" yaml:"enabled" toml:"enabled"`
+	LatestTTL   time.Duration `envconfig:"LATEST_TTL" default:"30s" yaml:"latestTTL" toml:"latestTTL"`
+	HistoricTTL time.Duration `envconfig:"HISTORIC_TTL" default:"1h" yaml:"historicTTL" toml:"historicTTL"`
+}
+
+type Indexer struct {
+	Enabled      bool          `envconfig:"ENABLED" default:"false" yaml:"enabled" toml:"enabled"`
+	DataDir      string        `envconfig:"DATA_DIR" default:"./data/indexer" yaml:"dataDir" toml:"dataDir"`
+	PollInterval time.Duration `envconfig:"POLL_INTERVAL" default:"15s" yaml:"pollInterval" toml:"pollInterval"`
+	BatchSize    uint64        `envconfig:"BATCH_SIZE" default:"2000" yaml:"batchSize" toml:"batchSize"`
+	ReorgDepth   int           `envconfig:"REORG_DEPTH" default:"64" yaml:"reorgDepth" toml:"reorgDepth"`
+	// StartBlocks is the block to start indexing from per issuer DID.
+	StartBlocks KVstring `envconfig:"START_BLOCKS" yaml:"-" toml:"-"`
+}
+
+// RateLimit configures the token buckets of the clients: the rate is the
+// requests per second on average, and the burst is the requests at once.
+// A rule with a zero rate is disabled.
+type RateLimit struct {
+	Enabled bool `envconfig:"ENABLED" default:"true" yaml:"enabled" toml:"enabled"`
+	// Store is memory or redis. The memory store limits every instance separately.
+	Store    string `envconfig:"STORE" default:"memory" yaml:"store" toml:"store"`
+	RedisURL string `envconfig:"REDIS_URL" secret:"true" yaml:"redisURL,omitempty" toml:"redisURL,omitempty"`
+	// IP limits all the requests of a client address.
+	IPRate  float64 `envconfig:"IP_RATE" default:"10" yaml:"ipRate" toml:"ipRate"`
+	IPBurst int     `envconfig:"IP_BURST" default:"30" yaml:"ipBurst" toml:"ipBurst"`
+	// Session limits the callbacks of an auth session.
+	SessionRate  float64 `envconfig:"SESSION_RATE" default:"0.2" yaml:"sessionRate" toml:"sessionRate"`
+	SessionBurst int     `envconfig:"SESSION_BURST" default:"3" yaml:"sessionBurst" toml:"sessionBurst"`
+	// DID limits the callbacks from a DID.
+	DIDRate  float64 `envconfig:"DID_RATE" default:"0.1" yaml:"didRate" toml:"didRate"`
+	DIDBurst int     `envconfig:"DID_BURST" default:"5" yaml:"didBurst" toml:"didBurst"`
+}
+
+// Readiness configures the checks of the readiness probe. They run in the
+// background every CheckInterval, and the probe reports their last results.
+type Readiness struct {
+	CheckInterval time.Duration `envconfig:"CHECK_INTERVAL" default:"10s" yaml:"checkInterval" toml:"checkInterval"`
+	CheckTimeout  time.Duration `envconfig:"CHECK_TIMEOUT" default:"5s" yaml:"checkTimeout" toml:"checkTimeout"`
+	// MaxBlockAge is how old the latest block of a chain may be,
+	// zero checks only that the rpc serves it.
+	MaxBlockAge time.Duration `envconfig:"MAX_BLOCK_AGE" default:"2m" yaml:"maxBlockAge" toml:"maxBlockAge"`
+}
 
-	KeysDirPath string `envconfig:"KEYS_DIR_PATH" default:"./keys"`
+// Startup configures the warm-up, that the startup probe waits for.
+type Startup struct {
+	// Timeout limits the warm-up, the dependencies that are not
+	// loaded by then are loaded on their first use.
+	Timeout time.Duration `envconfig:"TIMEOUT" default:"1m" yaml:"timeout" toml:"timeout"`
+}
+
+// Shutdown configures the graceful shutdown. The readiness turns false at
+// once, the traffic is served for Delay more, and then every phase of the
+// shutdown (stop traffic, drain, close, telemetry) has Timeout to complete.
+type Shutdown struct {
+	Timeout time.Duration `envconfig:"TIMEOUT" default:"10s" yaml:"timeout" toml:"timeout"`
+	Delay   time.Duration `envconfig:"DELAY" default:"0s" yaml:"delay" toml:"delay"`
+}
+
+// Auth configures the authorization requests.
+type Auth struct {
+	// MaxAge is how long after the request a response is accepted.
+	MaxAge time.Duration `envconfig:"MAX_AGE" default:"5m" yaml:"maxAge" toml:"maxAge"`
+	// GracePeriod is how long the callbacks of the pending sessions are
+	// accepted on shutdown, while no new requests are issued.
+	GracePeriod time.Duration `envconfig:"GRACE_PERIOD" default:"30s" yaml:"gracePeriod" toml:"gracePeriod"`
+	// Store is memory or redis. The sessions left on shutdown are handed off
+	// to the redis store, so that another instance continues them.
+	Store    string `envconfig:"STORE" default:"memory" yaml:"store" toml:"store"`
+	RedisURL string `envconfig:"REDIS_URL" secret:"true" yaml:"redisURL,omitempty" toml:"redisURL,omitempty"`
+}
+
+// Tracing configures the OpenTelemetry spans. The OTLP exporter
+// is set up by the standard OTEL_EXPORTER_OTLP_* env vars.
+type Tracing struct {
+	// Exporter is none, stdout or otlp.
+	Exporter    string  `envconfig:"EXPORTER" default:"none" yaml:"exporter" toml:"exporter"`
+	SampleRatio float64 `envconfig:"SAMPLE_RATIO" default:"1" yaml:"sampleRatio" toml:"sampleRatio"`
+	ServiceName string  `envconfig:"SERVICE_NAME" default:"onchain-non-merklized-issuer-demo" yaml:"serviceName" toml:"serviceName"`
 }
 
 type Log struct {
-	Level       string `envconfig:"LEVEL" default:"INFO"`
-	Environment string `envconfig:"ENVIRONMENT" default:"production"`
-}
-
-func (l *Log) LogLevel() (loglevel slog.Level) {
-	switch l.Level {
-	case "DEBUG":
-		loglevel = slog.LevelDebug
-	case "INFO":
-		loglevel = slog.LevelInfo
-	case "WARN":
-		loglevel = slog.LevelWarn
-	case "ERROR":
-		loglevel = slog.LevelError
-	case "FATAL":
-		loglevel = logger.LevelFatal
-	case "NOTICE":
-		loglevel = logger.LevelNotice
-	}
-	return
+	Level       string `envconfig:"LEVEL" default:"INFO" yaml:"level" toml:"level"`
+	Environment string `envconfig:"ENVIRONMENT" default:"production" yaml:"environment" toml:"environment"`
+}
+
+var logLevels = map[string]slog.Level{
+	"DEBUG":  slog.LevelDebug,
+	"INFO":   slog.LevelInfo,
+	"WARN":   slog.LevelWarn,
+	"ERROR":  slog.LevelError,
+	"FATAL":  logger.LevelFatal,
+	"NOTICE": logger.LevelNotice,
+}
+
+// LogLevel returns the configured level. Unknown levels
+// are reported by Validate.
+func (l *Log) LogLevel() slog.Level {
+	return logLevels[l.Level]
 }
 
 type HTTPServer struct {
-	Host    string   `envconfig:"HOST"`
-	Port    string   `envconfig:"PORT" default:"8080"`
-	Origins []string `envconfig:"ORIGINS" default:"*"`
+	Host    string   `envconfig:"HOST" yaml:"host" toml:"host"`
+	Port    string   `envconfig:"PORT" default:"8080" yaml:"port" toml:"port"`
+	Origins []string `envconfig:"ORIGINS" default:"*" yaml:"origins" toml:"origins"`
+	// BodyLimit is the max size of the request bodies in bytes,
+	// and CallbackBodyLimit of the JWZ tokens posted to the callback.
+	BodyLimit         int64 `envconfig:"BODY_LIMIT" default:"16384" yaml:"bodyLimit" toml:"bodyLimit"`
+	CallbackBodyLimit int64 `envconfig:"CALLBACK_BODY_LIMIT" default:"131072" yaml:"callbackBodyLimit" toml:"callbackBodyLimit"`
+	TLS               TLS   `envconfig:"TLS" yaml:"tls" toml:"tls"`
+}
+
+// Admin is the internal listener of the probes, the metrics, pprof and
+// the admin routes. Its port must not be exposed to the public.
+type Admin struct {
+	// Host is the loopback by default. Set it to 0.0.0.0 for the probes
+	// and the scrapes from outside of the host, e.g. in a pod.
+	Host string `envconfig:"HOST" default:"127.0.0.1" yaml:"host" toml:"host"`
+	Port string `envconfig:"PORT" default:"9090" yaml:"port" toml:"port"`
+	// Token is the bearer token of the metrics, the version, pprof and
+	// the admin routes. pprof and the admin routes are not served without it.
+	Token string `envconfig:"TOKEN" secret:"true" yaml:"token,omitempty" toml:"token,omitempty"`
+	// TLS serves the admin listener over HTTPS. With the client CA file, all
+	// the routes but the probes need a client certificate, unless the
+	// client cert paths name other ones.
+	TLS TLS `envconfig:"TLS" yaml:"tls" toml:"tls"`
+}
+
+// TLS serves HTTPS when the certificate and the key files are set.
+// The files are loaded again when they change.
+type TLS struct {
+	CertFile string `envconfig:"CERT_FILE" yaml:"certFile,omitempty" toml:"certFile,omitempty"`
+	KeyFile  string `envconfig:"KEY_FILE" yaml:"keyFile,omitempty" toml:"keyFile,omitempty"`
+	// MinVersion is 1.2 or 1.3.
+	MinVersion string `envconfig:"MIN_VERSION" default:"1.2" yaml:"minVersion" toml:"minVersion"`
+	// CipherSuites are the names of the TLS 1.2 cipher suites,
+	// the Go defaults are used when it is empty.
+	CipherSuites []string `envconfig:"CIPHER_SUITES" yaml:"cipherSuites,omitempty" toml:"cipherSuites,omitempty"`
+	// ClientCAFile enables the client certificates, that
+	// are required for the paths in ClientCertPaths.
+	ClientCAFile    string   `envconfig:"CLIENT_CA_FILE" yaml:"clientCAFile,omitempty" toml:"clientCAFile,omitempty"`
+	ClientCertPaths []string `envconfig:"CLIENT_CERT_PATHS" yaml:"clientCertPaths,omitempty" toml:"clientCertPaths,omitempty"`
+}
+
+// Enabled is true when the certificate is set.
+func (t *TLS) Enabled() bool {
+	return t.CertFile != ""
+}
+
+// Dev is the configuration of the local development chain,
+// that is only used with the -dev flag.
+type Dev struct {
+	// RPCURL of an external dev node, e.g. anvil. The in-process
+	// simulated chain is started when it is empty.
+	RPCURL      string        `envconfig:"RPC_URL" secret:"true"`
+	HTTPHost    string        `envconfig:"HTTP_HOST" default:"127.0.0.1"`
+	HTTPPort    int           `envconfig:"HTTP_PORT" default:"8545"`
+	PrivateKey  string        `envconfig:"PRIVATE_KEY" secret:"true" default:"0xac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80"`
+	BlockPeriod time.Duration `envconfig:"BLOCK_PERIOD" default:"1s"`
+	// ArtifactsDir overrides the embedded contract artifacts.
+	ArtifactsDir string `envconfig:"ARTIFACTS_DIR"`
+	// Chain is the DID network of the dev chain in the form
+	// "method:blockchain:network:networkFlag".
+	Chain        string `envconfig:"CHAIN" default:"iden3:local:dev:0xf1"`
+	ExternalHost string `envconfig:"EXTERNAL_HOST" default:"http://localhost:8080"`
 }
 
+func ParseDev() (*Dev, error) {
+	secrets, err := loadSecrets(reflect.TypeOf(Dev{}), "DEV")
+	if err != nil {
+		return nil, err
+	}
+	var cfg Dev
+	if err := envconfig.Process("DEV", &cfg); err != nil {
+		return nil, err
+	}
+	if err := setSecrets(reflect.ValueOf(&cfg).Elem(), secrets, "DEV"); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Parse reads the configuration from the environment.
 func Parse() (*Config, error) {
+	return Load("")
+}
+
+// Load reads the configuration file, when the path is set, and the
+// environment. Environment variables override the values of the file,
+// and the defaults apply to the values that are set in neither.
+// Any env var may be read from a secret instead, see DefaultSecretProviders.
+// The result is not validated, see Validate.
+func Load(path string) (*Config, error) {
+	secrets, err := loadSecrets(reflect.TypeOf(Config{}), "")
+	if err != nil {
+		return nil, err
+	}
 	var cfg Config
 	if err := envconfig.Process("", &cfg); err != nil {
 		return nil, err
 	}
+	if err := setSecrets(reflect.ValueOf(&cfg).Elem(), secrets, ""); err != nil {
+		return nil, err
+	}
+	if path != "" {
+		env := cfg
+		if err := decodeFile(path, &cfg); err != nil {
+			return nil, err
+		}
+		if err := cfg.expandFileBlocks(); err != nil {
+			return nil, err
+		}
+		overrideFromEnv(reflect.ValueOf(&cfg).Elem(), reflect.ValueOf(env), "", secrets)
+	}
 	return &cfg, nil
 }
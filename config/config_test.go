@@ -0,0 +1,148 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const yamlConfig = `
+externalHost: https://issuer.example.com
+log:
+  level: DEBUG
+stateCache:
+  enabled: false
+  latestTTL: 10s
+networks:
+  - chainID: 80002
+    stateContract: "0x1a4cC30f2aA0377b0c3bc9848766D90cb4404124"
+    rpc: ["https://rpc1.example.com", "https://rpc2.example.com"]
+  - chainID: 31337
+    stateContract: "0x5FbDB2315678afecb367f032d93F642f64180aa3"
+    rpc: ["http://localhost:8545"]
+    didPrefix: iden3:local:dev
+    networkFlag: "0x91"
+issuers:
+  - did: did:iden3:privado:main:2SZ
+    name: Issuer
+    startBlock: 100
+`
+
+const tomlConfig = `
+externalHost = "https://issuer.example.com"
+
+[log]
+level = "DEBUG"
+
+[stateCache]
+enabled = false
+latestTTL = "10s"
+
+[[networks]]
+chainID = 80002
+stateContract = "0x1a4cC30f2aA0377b0c3bc9848766D90cb4404124"
+rpc = ["https://rpc1.example.com", "https://rpc2.example.com"]
+
+[[networks]]
+chainID = 31337
+stateContract = "0x5FbDB2315678afecb367f032d93F642f64180aa3"
+rpc = ["http://localhost:8545"]
+didPrefix = "iden3:local:dev"
+networkFlag = "0x91"
+
+[[issuers]]
+did = "did:iden3:privado:main:2SZ"
+name = "Issuer"
+startBlock = 100
+`
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad_File(t *testing.T) {
+	for name, content := range map[string]string{
+		"config.yaml": yamlConfig,
+		"config.toml": tomlConfig,
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := Load(writeFile(t, name, content))
+			require.NoError(t, err)
+
+			require.Equal(t, "https://issuer.example.com", cfg.ExternalHost)
+			require.Equal(t, "DEBUG", cfg.Log.Level)
+			// defaults apply to the values that are not in the file
+			require.Equal(t, "production", cfg.Log.Environment)
+			require.Equal(t, "8080", cfg.HTTPServer.Port)
+			require.False(t, cfg.StateCache.Enabled)
+			require.Equal(t, 10*time.Second, cfg.StateCache.LatestTTL)
+			require.Equal(t, time.Hour, cfg.StateCache.HistoricTTL)
+
+			require.Equal(t, KVstring{
+				"80002": "0x1a4cC30f2aA0377b0c3bc9848766D90cb4404124",
+				"31337": "0x5FbDB2315678afecb367f032d93F642f64180aa3",
+			}, cfg.SupportedStateContracts)
+			require.Equal(t, KVlist{
+				"80002": {"https://rpc1.example.com", "https://rpc2.example.com"},
+				"31337": {"http://localhost:8545"},
+			}, cfg.SupportedRPC)
+			require.Equal(t, KVstring{"31337": "iden3:local:dev:0x91"}, cfg.Chains)
+			require.Equal(t, []string{"did:iden3:privado:main:2SZ"}, cfg.Issuers)
+			require.Equal(t, KVstring{"did:iden3:privado:main:2SZ": "100"}, cfg.Indexer.StartBlocks)
+		})
+	}
+}
+
+func TestLoad_EnvOverridesFile(t *testing.T) {
+	t.Setenv("LOG_LEVEL", "WARN")
+	t.Setenv("STATE_CACHE_ENABLED", "true")
+	t.Setenv("SUPPORTED_RPC", "80002=https://rpc3.example.com")
+
+	cfg, err := Load(writeFile(t, "config.yaml", yamlConfig))
+	require.NoError(t, err)
+	require.Equal(t, "WARN", cfg.Log.Level)
+	require.True(t, cfg.StateCache.Enabled)
+	require.Equal(t, KVlist{"80002": {"https://rpc3.example.com"}}, cfg.SupportedRPC)
+	// values without env vars still come from the file
+	require.Equal(t, 10*time.Second, cfg.StateCache.LatestTTL)
+	require.Len(t, cfg.SupportedStateContracts, 2)
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	_, err := Load(writeFile(t, "config.yaml", "unknownKey: 1\n"))
+	require.ErrorContains(t, err, "unknownKey")
+
+	_, err = Load(writeFile(t, "config.toml", "unknownKey = 1\n"))
+	require.ErrorContains(t, err, "unknownKey")
+
+	_, err = Load(writeFile(t, "config.json", "{}"))
+	require.ErrorContains(t, err, "unsupported config file format")
+}
+
+func TestFileForm_RoundTrip(t *testing.T) {
+	for _, format := range []string{"yaml", "toml"} {
+		t.Run(format, func(t *testing.T) {
+			cfg, err := Load(writeFile(t, "config.yaml", yamlConfig))
+			require.NoError(t, err)
+
+			var b strings.Builder
+			require.NoError(t, cfg.FileForm().Encode(&b, format))
+			loaded, err := Load(writeFile(t, "config."+format, b.String()))
+			require.NoError(t, err)
+
+			require.Equal(t, cfg.SupportedStateContracts, loaded.SupportedStateContracts)
+			require.Equal(t, cfg.SupportedRPC, loaded.SupportedRPC)
+			require.Equal(t, cfg.Chains, loaded.Chains)
+			require.Equal(t, cfg.Issuers, loaded.Issuers)
+			require.Equal(t, cfg.Indexer, loaded.Indexer)
+			require.Equal(t, cfg.StateCache, loaded.StateCache)
+		})
+	}
+}
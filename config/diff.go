@@ -0,0 +1,178 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// reloadable are the settings that are applied on a config
+// reload. The others take effect after a restart.
+var reloadable = []string{
+	"ISSUERS",
+	"SUPPORTED_STATE_CONTRACTS",
+	"SUPPORTED_RPC",
+	"CHAINS",
+	"RPC_",
+	"STATE_CACHE_",
+	"KEYS_DIR_PATH",
+	"INDEXER_START_BLOCKS",
+}
+
+// Change is a setting that differs between two configs.
+// Map settings are compared per key.
+type Change struct {
+	Field      string
+	Old        string
+	New        string
+	Reloadable bool
+}
+
+func (c Change) String() string {
+	switch {
+	case c.Old == "":
+		return fmt.Sprintf("%s: added %s", c.Field, c.New)
+	case c.New == "":
+		return fmt.Sprintf("%s: removed %s", c.Field, c.Old)
+	default:
+		return fmt.Sprintf("%s: %s -> %s", c.Field, c.Old, c.New)
+	}
+}
+
+// Diff returns the settings that changed from prev to next.
+// Secrets are redacted, so that the changes can be logged.
+func Diff(prev, next *Config) []Change {
+	var changes []Change
+	diffStruct(reflect.ValueOf(*prev), reflect.ValueOf(*next), "", &changes)
+
+	oldMeta, newMeta := issuerMetadata(prev), issuerMetadata(next)
+	for _, did := range sortedKeys(newMeta) {
+		if o, ok := oldMeta[did]; ok && o != newMeta[did] {
+			changes = append(changes, Change{
+				Field:      fmt.Sprintf("issuers[%s]", did),
+				Old:        o,
+				New:        newMeta[did],
+				Reloadable: true,
+			})
+		}
+	}
+	return changes
+}
+
+func diffStruct(prev, next reflect.Value, prefix string, changes *[]Change) {
+	t := prev.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("envconfig")
+		if tag == "" || field.Tag.Get("ignored") == "true" {
+			continue
+		}
+		key := tag
+		if prefix != "" {
+			key = prefix + "_" + tag
+		}
+		o, n := prev.Field(i), next.Field(i)
+		secret := field.Tag.Get("secret") == "true"
+		switch field.Type.Kind() {
+		case reflect.Struct:
+			diffStruct(o, n, key, changes)
+		case reflect.Map:
+			diffMap(o, n, key, secret, changes)
+		case reflect.Slice:
+			diffList(o, n, key, secret, changes)
+		default:
+			if !reflect.DeepEqual(o.Interface(), n.Interface()) {
+				*changes = append(*changes, newChange(key, key, o, n, secret))
+			}
+		}
+	}
+}
+
+func diffMap(prev, next reflect.Value, key string, secret bool, changes *[]Change) {
+	keys := make(map[string]bool)
+	for _, k := range prev.MapKeys() {
+		keys[k.String()] = true
+	}
+	for _, k := range next.MapKeys() {
+		keys[k.String()] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	for _, k := range sorted {
+		mapKey := reflect.ValueOf(k).Convert(prev.Type().Key())
+		o, n := prev.MapIndex(mapKey), next.MapIndex(mapKey)
+		if o.IsValid() && n.IsValid() && reflect.DeepEqual(o.Interface(), n.Interface()) {
+			continue
+		}
+		*changes = append(*changes, newChange(fmt.Sprintf("%s[%s]", key, k), key, o, n, secret))
+	}
+}
+
+// diffList compares lists as sets, e.g. the issuers.
+func diffList(prev, next reflect.Value, key string, secret bool, changes *[]Change) {
+	index := func(v reflect.Value) map[string]reflect.Value {
+		items := make(map[string]reflect.Value, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			items[fmt.Sprintf("%v", v.Index(i).Interface())] = v.Index(i)
+		}
+		return items
+	}
+	prevItems, nextItems := index(prev), index(next)
+	for _, item := range sortedKeys(prevItems) {
+		if _, ok := nextItems[item]; !ok {
+			*changes = append(*changes, newChange(key, key, prevItems[item], reflect.Value{}, secret))
+		}
+	}
+	for _, item := range sortedKeys(nextItems) {
+		if _, ok := prevItems[item]; !ok {
+			*changes = append(*changes, newChange(key, key, reflect.Value{}, nextItems[item], secret))
+		}
+	}
+}
+
+func newChange(field, key string, prev, next reflect.Value, secret bool) Change {
+	c := Change{Field: field}
+	if prev.IsValid() {
+		c.Old = formatValue(prev, secret)
+	}
+	if next.IsValid() {
+		c.New = formatValue(next, secret)
+	}
+	for _, prefix := range reloadable {
+		if key == prefix || (strings.HasSuffix(prefix, "_") && strings.HasPrefix(key, prefix)) {
+			c.Reloadable = true
+		}
+	}
+	return c
+}
+
+func formatValue(v reflect.Value, secret bool) string {
+	if !secret {
+		return fmt.Sprintf("%v", v.Interface())
+	}
+	switch value := v.Interface().(type) {
+	case string:
+		return redactValue(value)
+	case []string:
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			items = append(items, redactValue(item))
+		}
+		return fmt.Sprintf("%v", items)
+	default:
+		return redacted
+	}
+}
+
+func issuerMetadata(c *Config) map[string]string {
+	m := make(map[string]string, len(c.IssuerDetails))
+	for _, i := range c.IssuerDetails {
+		m[i.DID] = fmt.Sprintf("%s (%s)", i.Name, i.Description)
+	}
+	return m
+}
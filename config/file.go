@@ -0,0 +1,184 @@
+package config
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// decodeFile decodes the YAML or TOML file on top of the config.
+// Keys that are not in the file keep their values, unknown keys fail.
+func decodeFile(path string, cfg *Config) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to read config file")
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return errors.Wrapf(err, "invalid config file '%s'", path)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(content), cfg)
+		if err != nil {
+			return errors.Wrapf(err, "invalid config file '%s'", path)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return errors.Errorf("invalid config file '%s': unknown keys %v", path, undecoded)
+		}
+	default:
+		return errors.Errorf("unsupported config file format '%s', expected .yaml, .yml or .toml", path)
+	}
+	return nil
+}
+
+// expandFileBlocks fills the flat settings from the network and issuer blocks.
+func (c *Config) expandFileBlocks() error {
+	if len(c.Networks) > 0 {
+		c.SupportedStateContracts = make(KVstring, len(c.Networks))
+		c.SupportedRPC = make(KVlist, len(c.Networks))
+		c.Chains = make(KVstring)
+		for _, n := range c.Networks {
+			network := strconv.Itoa(n.ChainID)
+			if n.ChainID <= 0 {
+				return errors.Errorf("invalid chain id %d in network block", n.ChainID)
+			}
+			if n.StateContract != "" {
+				c.SupportedStateContracts[network] = n.StateContract
+			}
+			if len(n.RPC) > 0 {
+				c.SupportedRPC[network] = n.RPC
+			}
+			if n.NetworkFlag != "" {
+				if n.DIDPrefix == "" {
+					return errors.Errorf("network flag without did prefix for chain id %d", n.ChainID)
+				}
+				c.Chains[network] = n.DIDPrefix + ":" + n.NetworkFlag
+			}
+		}
+	}
+	if len(c.IssuerDetails) > 0 {
+		c.Issuers = make([]string, 0, len(c.IssuerDetails))
+		c.Indexer.StartBlocks = make(KVstring)
+		for _, i := range c.IssuerDetails {
+			if i.DID == "" {
+				return errors.New("issuer block without did")
+			}
+			c.Issuers = append(c.Issuers, i.DID)
+			if i.StartBlock > 0 {
+				c.Indexer.StartBlocks[i.DID] = strconv.FormatUint(i.StartBlock, 10)
+			}
+		}
+	}
+	return nil
+}
+
+// overrideFromEnv copies the values of the environment variables and the
+// secrets that are set from the env config into the config, using the
+// envconfig tags as names.
+func overrideFromEnv(dst, env reflect.Value, prefix string, secrets map[string]string) {
+	decoderType := reflect.TypeOf((*envconfig.Decoder)(nil)).Elem()
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("envconfig")
+		if tag == "" || field.Tag.Get("ignored") == "true" {
+			continue
+		}
+		key := tag
+		if prefix != "" {
+			key = prefix + "_" + tag
+		}
+		if field.Type.Kind() == reflect.Struct && !reflect.PointerTo(field.Type).Implements(decoderType) {
+			overrideFromEnv(dst.Field(i), env.Field(i), key, secrets)
+			continue
+		}
+		_, secret := secrets[key]
+		if _, ok := os.LookupEnv(key); ok || secret {
+			dst.Field(i).Set(env.Field(i))
+		}
+	}
+}
+
+// FileForm returns a copy of the config with the flat network and issuer
+// settings in the network and issuer blocks, so that it can be saved as
+// a config file.
+func (c *Config) FileForm() *Config {
+	cp := *c
+
+	networks := make(map[string]bool)
+	for _, m := range []map[string]string{c.SupportedStateContracts, c.Chains} {
+		for network := range m {
+			networks[network] = true
+		}
+	}
+	for network := range c.SupportedRPC {
+		networks[network] = true
+	}
+	cp.Networks = make([]Network, 0, len(networks))
+	for _, network := range sortedKeys(networks) {
+		chainID, err := strconv.Atoi(network)
+		if err != nil {
+			continue
+		}
+		n := Network{
+			ChainID:       chainID,
+			StateContract: c.SupportedStateContracts[network],
+			RPC:           c.SupportedRPC[network],
+		}
+		for _, prev := range c.Networks {
+			if prev.ChainID == chainID {
+				n.DIDPrefix = prev.DIDPrefix
+			}
+		}
+		if custom, ok := c.Chains[network]; ok {
+			if i := strings.LastIndex(custom, ":"); i > 0 {
+				n.DIDPrefix, n.NetworkFlag = custom[:i], custom[i+1:]
+			}
+		}
+		cp.Networks = append(cp.Networks, n)
+	}
+
+	details := make(map[string]Issuer, len(c.IssuerDetails))
+	for _, i := range c.IssuerDetails {
+		details[i.DID] = i
+	}
+	cp.IssuerDetails = make([]Issuer, 0, len(c.Issuers))
+	for _, did := range c.Issuers {
+		i := details[did]
+		i.DID = did
+		if v, ok := c.Indexer.StartBlocks[did]; ok {
+			i.StartBlock, _ = strconv.ParseUint(v, 10, 64)
+		}
+		cp.IssuerDetails = append(cp.IssuerDetails, i)
+	}
+	return &cp
+}
+
+// Encode writes the config in the YAML or TOML file format.
+func (c *Config) Encode(w io.Writer, format string) error {
+	switch format {
+	case "yaml", "yml":
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(c); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case "toml":
+		return toml.NewEncoder(w).Encode(c)
+	default:
+		return errors.Errorf("unsupported config format '%s', expected yaml or toml", format)
+	}
+}
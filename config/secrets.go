@@ -0,0 +1,323 @@
+package config
+
+import (
+	"encoding"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/iden3/go-service-template/pkg/ethrpc"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+)
+
+const redacted = "[REDACTED]"
+
+// SecretProvider resolves the value of a setting by its env var name,
+// e.g. SUPPORTED_RPC, from a place other than the env var itself.
+type SecretProvider interface {
+	// Secret returns false when the provider has no value for the name.
+	Secret(name string) (value string, ok bool, err error)
+}
+
+// EnvFileProvider reads the secret from the file that the NAME_FILE
+// env var points to, like Docker secrets.
+type EnvFileProvider struct{}
+
+func (EnvFileProvider) Secret(name string) (string, bool, error) {
+	path, ok := os.LookupEnv(name + "_FILE")
+	if !ok {
+		return "", false, nil
+	}
+	value, err := readSecretFile(path)
+	if err != nil {
+		return "", false, errors.Wrapf(err, "failed to read %s_FILE", name)
+	}
+	return value, true, nil
+}
+
+// DirProvider reads the secret from the file named NAME in the directory,
+// like a mounted Kubernetes secret.
+type DirProvider struct {
+	Dir string
+}
+
+func (p DirProvider) Secret(name string) (string, bool, error) {
+	value, err := readSecretFile(filepath.Join(p.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, errors.Wrapf(err, "failed to read secret %s", name)
+	}
+	return value, true, nil
+}
+
+// KeystoreProvider decrypts a private key from the Ethereum keystore file
+// that the NAME_KEYSTORE env var points to. The password is taken from
+// NAME_KEYSTORE_PASSWORD or the NAME_KEYSTORE_PASSWORD_FILE file.
+type KeystoreProvider struct{}
+
+func (KeystoreProvider) Secret(name string) (string, bool, error) {
+	path, ok := os.LookupEnv(name + "_KEYSTORE")
+	if !ok {
+		return "", false, nil
+	}
+	keyJSON, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, errors.Wrapf(err, "failed to read %s_KEYSTORE", name)
+	}
+	password, ok := os.LookupEnv(name + "_KEYSTORE_PASSWORD")
+	if !ok {
+		password, ok, err = EnvFileProvider{}.Secret(name + "_KEYSTORE_PASSWORD")
+		if err != nil {
+			return "", false, err
+		}
+		if !ok {
+			return "", false, errors.Errorf("no password for %s_KEYSTORE", name)
+		}
+	}
+	key, err := keystore.DecryptKey(keyJSON, password)
+	if err != nil {
+		return "", false, errors.Wrapf(err, "failed to decrypt %s_KEYSTORE", name)
+	}
+	return "0x" + hex.EncodeToString(crypto.FromECDSA(key.PrivateKey)), true, nil
+}
+
+// DefaultSecretProviders are the NAME_FILE files, the SECRETS_DIR
+// directory when it is set, and the keystore files.
+func DefaultSecretProviders() []SecretProvider {
+	providers := []SecretProvider{EnvFileProvider{}}
+	if dir := os.Getenv("SECRETS_DIR"); dir != "" {
+		providers = append(providers, DirProvider{Dir: dir})
+	}
+	return append(providers, KeystoreProvider{})
+}
+
+// LoadSecrets resolves the env vars of the config that are not set
+// directly from the first provider that has them. The values are
+// returned by name and are not put in the environment.
+func LoadSecrets(names []string, providers ...SecretProvider) (map[string]string, error) {
+	secrets := make(map[string]string)
+	for _, name := range names {
+		if _, ok := os.LookupEnv(name); ok {
+			if _, ok := os.LookupEnv(name + "_FILE"); ok {
+				return nil, errors.Errorf("both %s and %s_FILE are set", name, name)
+			}
+			continue
+		}
+		for _, p := range providers {
+			value, ok, err := p.Secret(name)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				secrets[name] = value
+				break
+			}
+		}
+	}
+	return secrets, nil
+}
+
+func readSecretFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+func loadSecrets(t reflect.Type, prefix string) (map[string]string, error) {
+	return LoadSecrets(envKeys(t, prefix), DefaultSecretProviders()...)
+}
+
+// setSecrets sets the fields of the struct that have a secret, by their
+// env var names, decoding the values like envconfig does for the env vars.
+func setSecrets(dst reflect.Value, secrets map[string]string, prefix string) error {
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("envconfig")
+		if tag == "" || field.Tag.Get("ignored") == "true" {
+			continue
+		}
+		key := tag
+		if prefix != "" {
+			key = prefix + "_" + tag
+		}
+		if field.Type.Kind() == reflect.Struct && decoderFrom(dst.Field(i)) == nil {
+			if err := setSecrets(dst.Field(i), secrets, key); err != nil {
+				return err
+			}
+			continue
+		}
+		if value, ok := secrets[key]; ok {
+			if err := decodeSecret(value, dst.Field(i)); err != nil {
+				return errors.Wrapf(err, "failed to decode secret %s", key)
+			}
+		}
+	}
+	return nil
+}
+
+func decoderFrom(f reflect.Value) envconfig.Decoder {
+	if d, ok := f.Addr().Interface().(envconfig.Decoder); ok {
+		return d
+	}
+	return nil
+}
+
+func decodeSecret(value string, f reflect.Value) error {
+	if d := decoderFrom(f); d != nil {
+		return d.Decode(value)
+	}
+	if s, ok := f.Addr().Interface().(envconfig.Setter); ok {
+		return s.Set(value)
+	}
+	if u, ok := f.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if f.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return err
+			}
+			f.SetInt(int64(d))
+			return nil
+		}
+		v, err := strconv.ParseInt(value, 0, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(value, 0, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(v)
+	case reflect.Bool:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		f.SetBool(v)
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(value, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(v)
+	case reflect.Slice:
+		sl := reflect.MakeSlice(f.Type(), 0, 0)
+		if strings.TrimSpace(value) != "" {
+			values := strings.Split(value, ",")
+			sl = reflect.MakeSlice(f.Type(), len(values), len(values))
+			for i, v := range values {
+				if err := decodeSecret(v, sl.Index(i)); err != nil {
+					return err
+				}
+			}
+		}
+		f.Set(sl)
+	default:
+		return errors.Errorf("unsupported type %s", f.Type())
+	}
+	return nil
+}
+
+// envKeys returns the env var names of the struct fields.
+func envKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("envconfig")
+		if tag == "" || field.Tag.Get("ignored") == "true" {
+			continue
+		}
+		key := tag
+		if prefix != "" {
+			key = prefix + "_" + tag
+		}
+		if field.Type.Kind() == reflect.Struct {
+			keys = append(keys, envKeys(field.Type, key)...)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Redacted returns a copy of the config with the secrets hidden,
+// so that it can be logged or printed.
+func (c *Config) Redacted() *Config {
+	cp := *c
+	redactStruct(reflect.ValueOf(&cp).Elem())
+	cp.Networks = make([]Network, 0, len(c.Networks))
+	for _, n := range c.Networks {
+		rpc := make([]string, 0, len(n.RPC))
+		for _, u := range n.RPC {
+			rpc = append(rpc, redactValue(u))
+		}
+		n.RPC = rpc
+		cp.Networks = append(cp.Networks, n)
+	}
+	return &cp
+}
+
+func redactStruct(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		f := v.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			redactStruct(f)
+			continue
+		}
+		if field.Tag.Get("secret") != "true" {
+			continue
+		}
+		switch value := f.Interface().(type) {
+		case string:
+			f.SetString(redactValue(value))
+		case KVlist:
+			lists := make(KVlist, len(value))
+			for k, items := range value {
+				for _, item := range items {
+					lists[k] = append(lists[k], redactValue(item))
+				}
+			}
+			f.Set(reflect.ValueOf(lists))
+		case KVstring:
+			kv := make(KVstring, len(value))
+			for k, item := range value {
+				kv[k] = redactValue(item)
+			}
+			f.Set(reflect.ValueOf(kv))
+		}
+	}
+}
+
+// redactValue keeps the scheme and the host of urls, since
+// credentials and api keys are usually in the other parts.
+func redactValue(value string) string {
+	if value == "" {
+		return ""
+	}
+	if strings.Contains(value, "://") {
+		return ethrpc.RedactURL(value)
+	}
+	return redacted
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSecrets_EnvFile(t *testing.T) {
+	path := writeFile(t, "rpc", "80002=https://rpc.example.com/v3/apikey\n")
+	t.Setenv("SUPPORTED_RPC_FILE", path)
+
+	secrets, err := LoadSecrets([]string{"SUPPORTED_RPC"}, EnvFileProvider{})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"SUPPORTED_RPC": "80002=https://rpc.example.com/v3/apikey"}, secrets)
+
+	// the secret is read again on the next load, e.g. after a rotation
+	require.NoError(t, os.WriteFile(path, []byte("80002=https://rpc.example.com/v3/newkey"), 0o600))
+	secrets, err = LoadSecrets([]string{"SUPPORTED_RPC"}, EnvFileProvider{})
+	require.NoError(t, err)
+	require.Equal(t, "80002=https://rpc.example.com/v3/newkey", secrets["SUPPORTED_RPC"])
+}
+
+func TestLoad_Secrets(t *testing.T) {
+	t.Setenv("SUPPORTED_RPC_FILE", writeFile(t, "rpc", "80002=https://rpc.example.com/v3/apikey\n"))
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "RPC_RETRIES"), []byte("5"), 0o600))
+	t.Setenv("SECRETS_DIR", dir)
+
+	cfg, err := Load("")
+	require.NoError(t, err)
+	require.Equal(t, KVlist{"80002": {"https://rpc.example.com/v3/apikey"}}, cfg.SupportedRPC)
+	require.Equal(t, 5, cfg.RPC.Retries)
+	// the secrets are not exposed to the environment
+	_, ok := os.LookupEnv("SUPPORTED_RPC")
+	require.False(t, ok)
+	_, ok = os.LookupEnv("RPC_RETRIES")
+	require.False(t, ok)
+
+	// the secrets override the file like the env vars
+	cfg, err = Load(writeFile(t, "config.yaml", yamlConfig))
+	require.NoError(t, err)
+	require.Equal(t, KVlist{"80002": {"https://rpc.example.com/v3/apikey"}}, cfg.SupportedRPC)
+}
+
+func TestLoadSecrets_Conflict(t *testing.T) {
+	t.Setenv("MONGODB_CONNECTION_STRING", "mongodb://localhost:27017")
+	t.Setenv("MONGODB_CONNECTION_STRING_FILE", writeFile(t, "mongo", "mongodb://user:pass@db:27017"))
+	_, err := LoadSecrets([]string{"MONGODB_CONNECTION_STRING"}, EnvFileProvider{})
+	require.ErrorContains(t, err,
+		"both MONGODB_CONNECTION_STRING and MONGODB_CONNECTION_STRING_FILE are set")
+}
+
+func TestDirProvider(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "DEV_RPC_URL"), []byte("http://anvil:8545\n"), 0o600))
+
+	value, ok, err := DirProvider{Dir: dir}.Secret("DEV_RPC_URL")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "http://anvil:8545", value)
+
+	_, ok, err = DirProvider{Dir: dir}.Secret("DEV_PRIVATE_KEY")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestKeystoreProvider(t *testing.T) {
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	keyJSON, err := keystore.EncryptKey(&keystore.Key{
+		Id:         uuid.New(),
+		Address:    crypto.PubkeyToAddress(privateKey.PublicKey),
+		PrivateKey: privateKey,
+	}, "password", keystore.LightScryptN, keystore.LightScryptP)
+	require.NoError(t, err)
+
+	t.Setenv("DEV_PRIVATE_KEY_KEYSTORE", writeFile(t, "keystore.json", string(keyJSON)))
+	t.Setenv("DEV_PRIVATE_KEY_KEYSTORE_PASSWORD_FILE", writeFile(t, "password", "password\n"))
+
+	value, ok, err := KeystoreProvider{}.Secret("DEV_PRIVATE_KEY")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "0x"+hex.EncodeToString(crypto.FromECDSA(privateKey)), value)
+
+	t.Setenv("DEV_PRIVATE_KEY_KEYSTORE_PASSWORD", "wrong")
+	_, _, err = KeystoreProvider{}.Secret("DEV_PRIVATE_KEY")
+	require.ErrorContains(t, err, "failed to decrypt")
+}
+
+func TestConfig_Redacted(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.MongoDBConnectionString = "mongodb://user:pass@db:27017/credentials"
+	cfg.Networks = []Network{{ChainID: 80002, RPC: []string{"https://rpc.example.com/v3/apikey"}}}
+
+	redacted := cfg.Redacted()
+	require.Equal(t, "mongodb://db:27017", redacted.MongoDBConnectionString)
+	require.Equal(t, KVlist{"80002": {"https://rpc1.example.com", "wss://rpc2.example.com"}}, redacted.SupportedRPC)
+	require.Equal(t, []string{"https://rpc.example.com"}, redacted.Networks[0].RPC)
+	// the original config is not changed
+	require.Equal(t, "mongodb://user:pass@db:27017/credentials", cfg.MongoDBConnectionString)
+	require.Equal(t, []string{"https://rpc.example.com/v3/apikey"}, cfg.Networks[0].RPC)
+}
@@ -0,0 +1,410 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/iden3/go-iden3-core/v2/w3c"
+	"github.com/iden3/go-service-template/pkg/chain"
+	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/iden3/go-service-template/pkg/tracing"
+	httptransport "github.com/iden3/go-service-template/pkg/transport/http"
+)
+
+// authKey is the verification key that the auth verifier loads from KeysDirPath.
+const authKey = "authV2.json"
+
+// Problem is an invalid config value.
+type Problem struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s", p.Field, p.Message)
+}
+
+// ValidationError lists all the problems found by Validate.
+type ValidationError struct {
+	Problems []Problem `json:"problems"`
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid config, %d problem(s):", len(e.Problems))
+	for _, p := range e.Problems {
+		b.WriteString("\n  - ")
+		b.WriteString(p.String())
+	}
+	return b.String()
+}
+
+type validator struct {
+	problems []Problem
+}
+
+func (v *validator) add(field, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) positive(field string, d time.Duration) {
+	if d <= 0 {
+		v.add(field, "must be positive, got %s", d)
+	}
+}
+
+// url checks the value. The messages have the redacted value, since
+// urls may have credentials.
+func (v *validator) url(field, value string, schemes ...string) {
+	u, err := url.Parse(value)
+	if err != nil {
+		v.add(field, "invalid url %q", redactValue(value))
+		return
+	}
+	if u.Host == "" {
+		v.add(field, "url %q has no host", redactValue(value))
+		return
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return
+		}
+	}
+	v.add(field, "url %q must have one of the schemes %s", redactValue(value), strings.Join(schemes, ", "))
+}
+
+func (v *validator) chainID(field, value string) bool {
+	id, err := strconv.Atoi(value)
+	if err != nil || id <= 0 {
+		v.add(field, "invalid chain id %q", value)
+		return false
+	}
+	return true
+}
+
+// Validate checks the whole config and returns a *ValidationError
+// with every problem found, or nil when the config is valid.
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	if _, ok := logLevels[c.Log.Level]; !ok {
+		v.add("LOG_LEVEL", "unknown level %q, expected one of %s", c.Log.Level, strings.Join(sortedKeys(logLevels), ", "))
+	}
+	if c.Log.Environment != logger.EnvDevelopment && c.Log.Environment != logger.EnvProduction {
+		v.add("LOG_ENVIRONMENT", "unknown environment %q, expected %s or %s",
+			c.Log.Environment, logger.EnvDevelopment, logger.EnvProduction)
+	}
+
+	if port, err := strconv.Atoi(c.HTTPServer.Port); err != nil || port <= 0 || port > 65535 {
+		v.add("HTTP_SERVER_PORT", "invalid port %q", c.HTTPServer.Port)
+	}
+	if port, err := strconv.Atoi(c.Admin.Port); err != nil || port <= 0 || port > 65535 {
+		v.add("ADMIN_PORT", "invalid port %q", c.Admin.Port)
+	} else if c.Admin.Port == c.HTTPServer.Port {
+		v.add("ADMIN_PORT", "must differ from HTTP_SERVER_PORT %s", c.HTTPServer.Port)
+	}
+	c.validateTLS(v, "HTTP_SERVER_", &c.HTTPServer.TLS)
+	c.validateTLS(v, "ADMIN_", &c.Admin.TLS)
+	if c.HTTPServer.BodyLimit <= 0 {
+		v.add("HTTP_SERVER_BODY_LIMIT", "must be positive, got %d", c.HTTPServer.BodyLimit)
+	}
+	if c.HTTPServer.CallbackBodyLimit <= 0 {
+		v.add("HTTP_SERVER_CALLBACK_BODY_LIMIT", "must be positive, got %d", c.HTTPServer.CallbackBodyLimit)
+	}
+
+	if c.ExternalHost == "" {
+		v.add("EXTERNAL_HOST", "is required")
+	} else {
+		v.url("EXTERNAL_HOST", c.ExternalHost, "http", "https")
+	}
+
+	c.validateChains(v)
+	c.validateIssuers(v)
+
+	if info, err := os.Stat(c.KeysDirPath); err != nil || !info.IsDir() {
+		v.add("KEYS_DIR_PATH", "%q is not a directory", c.KeysDirPath)
+	} else if _, err := os.Stat(filepath.Join(c.KeysDirPath, authKey)); err != nil {
+		v.add("KEYS_DIR_PATH", "%q has no %s verification key", c.KeysDirPath, authKey)
+	}
+
+	if c.RPC.Retries < 0 {
+		v.add("RPC_RETRIES", "must not be negative, got %d", c.RPC.Retries)
+	}
+	if c.RPC.RetryBackoff < 0 {
+		v.add("RPC_RETRY_BACKOFF", "must not be negative, got %s", c.RPC.RetryBackoff)
+	}
+	v.positive("AUTH_MAX_AGE", c.Auth.MaxAge)
+	c.validateAuthStore(v)
+	v.positive("SHUTDOWN_TIMEOUT", c.Shutdown.Timeout)
+	v.positive("READINESS_CHECK_INTERVAL", c.Readiness.CheckInterval)
+	v.positive("STARTUP_TIMEOUT", c.Startup.Timeout)
+	v.positive("READINESS_CHECK_TIMEOUT", c.Readiness.CheckTimeout)
+	if c.Readiness.MaxBlockAge < 0 {
+		v.add("READINESS_MAX_BLOCK_AGE", "must not be negative, got %s", c.Readiness.MaxBlockAge)
+	}
+	if c.Shutdown.Delay < 0 {
+		v.add("SHUTDOWN_DELAY", "must not be negative, got %s", c.Shutdown.Delay)
+	}
+	v.positive("RPC_HEALTH_CHECK_INTERVAL", c.RPC.HealthCheckInterval)
+	v.positive("RPC_HEALTH_CHECK_TIMEOUT", c.RPC.HealthCheckTimeout)
+
+	if c.StateCache.Enabled {
+		v.positive("STATE_CACHE_LATEST_TTL", c.StateCache.LatestTTL)
+		v.positive("STATE_CACHE_HISTORIC_TTL", c.StateCache.HistoricTTL)
+	}
+
+	if c.Indexer.Enabled {
+		if c.Indexer.DataDir == "" {
+			v.add("INDEXER_DATA_DIR", "is required")
+		}
+		v.positive("INDEXER_POLL_INTERVAL", c.Indexer.PollInterval)
+		if c.Indexer.BatchSize == 0 {
+			v.add("INDEXER_BATCH_SIZE", "must be positive")
+		}
+		if c.Indexer.ReorgDepth <= 0 {
+			v.add("INDEXER_REORG_DEPTH", "must be positive, got %d", c.Indexer.ReorgDepth)
+		}
+	}
+
+	if c.RateLimit.Enabled {
+		c.validateRateLimit(v)
+	}
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		v.add("TRACING_EXPORTER", "unknown exporter %q, expected %s, %s or %s", c.Tracing.Exporter,
+			tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		v.add("TRACING_SAMPLE_RATIO", "must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+	}
+
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+func (c *Config) validateChains(v *validator) {
+	if len(c.SupportedStateContracts) == 0 {
+		v.add("SUPPORTED_STATE_CONTRACTS", "is required")
+	}
+	if len(c.SupportedRPC) == 0 {
+		v.add("SUPPORTED_RPC", "is required")
+	}
+	known := c.knownChains()
+
+	for _, network := range sortedKeys(c.Chains) {
+		field := fmt.Sprintf("CHAINS[%s]", network)
+		if !v.chainID(field, network) {
+			continue
+		}
+		if _, err := chain.ParseChains(map[string]string{network: c.Chains[network]}); err != nil {
+			v.add(field, "%v", err)
+		}
+	}
+
+	for _, network := range sortedKeys(c.SupportedStateContracts) {
+		field := fmt.Sprintf("SUPPORTED_STATE_CONTRACTS[%s]", network)
+		if !v.chainID(field, network) {
+			continue
+		}
+		if address := c.SupportedStateContracts[network]; !common.IsHexAddress(address) {
+			v.add(field, "invalid address %q", address)
+		}
+		if _, ok := known[network]; !ok {
+			v.add(field, "unknown chain, add it to CHAINS")
+		}
+		if _, ok := c.SupportedRPC[network]; !ok {
+			v.add(field, "no rpc is configured for the chain in SUPPORTED_RPC")
+		}
+	}
+
+	for _, network := range sortedKeys(c.SupportedRPC) {
+		field := fmt.Sprintf("SUPPORTED_RPC[%s]", network)
+		if !v.chainID(field, network) {
+			continue
+		}
+		for _, u := range c.SupportedRPC[network] {
+			v.url(field, u, "http", "https", "ws", "wss")
+		}
+		if _, ok := known[network]; !ok {
+			v.add(field, "unknown chain, add it to CHAINS")
+		}
+	}
+
+	for i, n := range c.Networks {
+		if n.DIDPrefix != "" && len(strings.Split(n.DIDPrefix, ":")) != 3 {
+			v.add(fmt.Sprintf("networks[%d].didPrefix", i),
+				"invalid did prefix %q, expected method:blockchain:network", n.DIDPrefix)
+		}
+	}
+}
+
+func (c *Config) validateIssuers(v *validator) {
+	if len(c.Issuers) == 0 {
+		v.add("ISSUERS", "is required")
+	}
+	byPrefix := make(map[string]string)
+	for network, ch := range c.knownChains() {
+		byPrefix[fmt.Sprintf("%s:%s", ch.Method, ch.DIDPrefix())] = network
+	}
+
+	seen := make(map[string]bool, len(c.Issuers))
+	for _, issuer := range c.Issuers {
+		field := fmt.Sprintf("ISSUERS[%s]", issuer)
+		if seen[issuer] {
+			v.add(field, "duplicate issuer")
+			continue
+		}
+		seen[issuer] = true
+
+		did, err := w3c.ParseDID(issuer)
+		if err != nil {
+			v.add(field, "invalid did: %v", err)
+			continue
+		}
+		// did:method:blockchain:network:id
+		parts := strings.Split(did.ID, ":")
+		if len(parts) != 3 {
+			v.add(field, "did has no blockchain and network")
+			continue
+		}
+		network, ok := byPrefix[fmt.Sprintf("%s:%s:%s", did.Method, parts[0], parts[1])]
+		if !ok {
+			v.add(field, "unknown chain, add it to CHAINS")
+			continue
+		}
+		if _, ok := c.SupportedStateContracts[network]; !ok {
+			v.add(field, "no state contract is configured for chain %s", network)
+		}
+		if _, ok := c.SupportedRPC[network]; !ok {
+			v.add(field, "no rpc is configured for chain %s", network)
+		}
+	}
+
+	for _, issuer := range sortedKeys(c.Indexer.StartBlocks) {
+		field := fmt.Sprintf("INDEXER_START_BLOCKS[%s]", issuer)
+		if !seen[issuer] {
+			v.add(field, "not a configured issuer")
+		}
+		if _, err := strconv.ParseUint(c.Indexer.StartBlocks[issuer], 10, 64); err != nil {
+			v.add(field, "invalid block number %q", c.Indexer.StartBlocks[issuer])
+		}
+	}
+}
+
+// knownChains returns the built-in and the valid custom chains by chain ID.
+func (c *Config) knownChains() map[string]chain.Chain {
+	chains := make(map[string]chain.Chain)
+	for _, ch := range chain.DefaultChains() {
+		chains[strconv.Itoa(ch.ChainID)] = ch
+	}
+	for network, value := range c.Chains {
+		custom, err := chain.ParseChains(map[string]string{network: value})
+		if err != nil {
+			continue
+		}
+		chains[network] = custom[0]
+	}
+	return chains
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (c *Config) validateAuthStore(v *validator) {
+	if c.Auth.GracePeriod < 0 {
+		v.add("AUTH_GRACE_PERIOD", "must not be negative, got %s", c.Auth.GracePeriod)
+	}
+	switch c.Auth.Store {
+	case "memory":
+	case "redis":
+		if c.Auth.RedisURL == "" {
+			v.add("AUTH_REDIS_URL", "is required for the redis store")
+		} else {
+			v.url("AUTH_REDIS_URL", c.Auth.RedisURL, "redis", "rediss")
+		}
+	default:
+		v.add("AUTH_STORE", "unknown store %q, expected memory or redis", c.Auth.Store)
+	}
+}
+
+func (c *Config) validateRateLimit(v *validator) {
+	switch c.RateLimit.Store {
+	case "memory":
+	case "redis":
+		if c.RateLimit.RedisURL == "" {
+			v.add("RATE_LIMIT_REDIS_URL", "is required for the redis store")
+		} else {
+			v.url("RATE_LIMIT_REDIS_URL", c.RateLimit.RedisURL, "redis", "rediss")
+		}
+	default:
+		v.add("RATE_LIMIT_STORE", "unknown store %q, expected memory or redis", c.RateLimit.Store)
+	}
+
+	rules := []struct {
+		name  string
+		rate  float64
+		burst int
+	}{
+		{"IP", c.RateLimit.IPRate, c.RateLimit.IPBurst},
+		{"SESSION", c.RateLimit.SessionRate, c.RateLimit.SessionBurst},
+		{"DID", c.RateLimit.DIDRate, c.RateLimit.DIDBurst},
+	}
+	for _, rule := range rules {
+		if rule.rate < 0 {
+			v.add("RATE_LIMIT_"+rule.name+"_RATE", "must not be negative, got %v", rule.rate)
+		}
+		if rule.rate > 0 && rule.burst < 1 {
+			v.add("RATE_LIMIT_"+rule.name+"_BURST", "must be positive, got %d", rule.burst)
+		}
+	}
+}
+
+// validateTLS checks the TLS of a listener, whose env vars start with prefix.
+func (c *Config) validateTLS(v *validator, prefix string, t *TLS) {
+	if !t.Enabled() {
+		if t.KeyFile != "" {
+			v.add(prefix+"TLS_CERT_FILE", "is required with the key file")
+		}
+		if t.ClientCAFile != "" {
+			v.add(prefix+"TLS_CLIENT_CA_FILE", "requires TLS, set the certificate and the key files")
+		}
+		return
+	}
+	if t.KeyFile == "" {
+		v.add(prefix+"TLS_KEY_FILE", "is required with the certificate file")
+	} else if _, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile); err != nil {
+		v.add(prefix+"TLS_CERT_FILE", "%v", err)
+	}
+	if _, err := httptransport.ParseTLSVersion(t.MinVersion); err != nil {
+		v.add(prefix+"TLS_MIN_VERSION", "%v", err)
+	}
+	if _, err := httptransport.ParseCipherSuites(t.CipherSuites); err != nil {
+		v.add(prefix+"TLS_CIPHER_SUITES", "%v", err)
+	}
+	if t.ClientCAFile != "" {
+		if pem, err := os.ReadFile(t.ClientCAFile); err != nil {
+			v.add(prefix+"TLS_CLIENT_CA_FILE", "%v", err)
+		} else if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+			v.add(prefix+"TLS_CLIENT_CA_FILE", "no certificates in %s", t.ClientCAFile)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func validConfig(t *testing.T) *Config {
+	t.Helper()
+	t.Setenv("EXTERNAL_HOST", "https://issuer.example.com")
+	t.Setenv("SUPPORTED_STATE_CONTRACTS", "80002=0x1a4cC30f2aA0377b0c3bc9848766D90cb4404124")
+	t.Setenv("SUPPORTED_RPC", "80002=https://rpc1.example.com|wss://rpc2.example.com")
+	t.Setenv("ISSUERS", "did:polygonid:polygon:amoy:2qCU58EJgrELNZCDkSU23dQHZsBgAFWLNpNezo1g6b")
+	t.Setenv("KEYS_DIR_PATH", "../keys")
+	cfg, err := Parse()
+	require.NoError(t, err)
+	return cfg
+}
+
+func TestValidate_Valid(t *testing.T) {
+	require.NoError(t, validConfig(t).Validate())
+}
+
+func TestValidate_ReportsAllProblems(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.Log.Level = "WARNING"
+	cfg.ExternalHost = "issuer.example.com"
+	cfg.SupportedStateContracts["80002"] = "0x123"
+	cfg.SupportedStateContracts["31337"] = "0x5FbDB2315678afecb367f032d93F642f64180aa3"
+	cfg.SupportedRPC["80002"] = []string{"ftp://rpc.example.com"}
+	cfg.Issuers = append(cfg.Issuers, "did:iden3:local:dev:2SZ", "not-a-did")
+	cfg.KeysDirPath = t.TempDir()
+	cfg.RPC.HealthCheckTimeout = 0
+	cfg.Tracing.Exporter = "jaeger"
+	cfg.Tracing.SampleRatio = 2
+	cfg.RateLimit.Store = "redis"
+	cfg.HTTPServer.CallbackBodyLimit = 0
+	cfg.Auth.MaxAge = 0
+	cfg.HTTPServer.TLS.KeyFile = "tls.key"
+	cfg.Admin.Port = cfg.HTTPServer.Port
+	cfg.Admin.TLS.ClientCAFile = "ca.crt"
+	cfg.Shutdown.Timeout = 0
+	cfg.Auth.Store = "redis"
+	cfg.Auth.RedisURL = "http://redis:6379"
+	cfg.Readiness.CheckTimeout = 0
+	cfg.Startup.Timeout = 0
+	cfg.RateLimit.DIDBurst = 0
+
+	err := cfg.Validate()
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+
+	fields := make(map[string]bool)
+	for _, p := range verr.Problems {
+		fields[p.Field] = true
+	}
+	for _, field := range []string{
+		"LOG_LEVEL",
+		"EXTERNAL_HOST",
+		"SUPPORTED_STATE_CONTRACTS[80002]",
+		"SUPPORTED_STATE_CONTRACTS[31337]",
+		"SUPPORTED_RPC[80002]",
+		"ISSUERS[did:iden3:local:dev:2SZ]",
+		"ISSUERS[not-a-did]",
+		"KEYS_DIR_PATH",
+		"RPC_HEALTH_CHECK_TIMEOUT",
+		"TRACING_EXPORTER",
+		"TRACING_SAMPLE_RATIO",
+		"RATE_LIMIT_REDIS_URL",
+		"RATE_LIMIT_DID_BURST",
+		"HTTP_SERVER_CALLBACK_BODY_LIMIT",
+		"AUTH_MAX_AGE",
+		"HTTP_SERVER_TLS_CERT_FILE",
+		"ADMIN_PORT",
+		"ADMIN_TLS_CLIENT_CA_FILE",
+		"SHUTDOWN_TIMEOUT",
+		"AUTH_REDIS_URL",
+		"READINESS_CHECK_TIMEOUT",
+		"STARTUP_TIMEOUT",
+	} {
+		require.True(t, fields[field], "no problem reported for %s in:\n%v", field, err)
+	}
+}
+
+func TestKVstring_DecodeRejectsEmptyKeys(t *testing.T) {
+	var kv KVstring
+	require.Error(t, kv.Decode("=0x1a4cC30f2aA0377b0c3bc9848766D90cb4404124"))
+	require.Error(t, kv.Decode("80002="))
+	require.Error(t, kv.Decode("80002=a,80002=b"))
+
+	var kl KVlist
+	require.Error(t, kl.Decode("=https://rpc.example.com"))
+	require.Error(t, kl.Decode("80002=https://rpc.example.com||"))
+}
@@ -1,31 +1,69 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"strconv"
 
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
 	auth "github.com/iden3/go-iden3-auth/v2"
 	"github.com/iden3/go-iden3-auth/v2/loaders"
 	"github.com/iden3/go-iden3-auth/v2/pubsignals"
-	"github.com/iden3/go-iden3-auth/v2/state"
+	core "github.com/iden3/go-iden3-core/v2"
+	"github.com/iden3/go-iden3-core/v2/w3c"
 	"github.com/iden3/go-service-template/config"
+	"github.com/iden3/go-service-template/pkg/chain"
+	"github.com/iden3/go-service-template/pkg/devchain"
+	"github.com/iden3/go-service-template/pkg/ethrpc"
+	"github.com/iden3/go-service-template/pkg/indexer"
 	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/iden3/go-service-template/pkg/metrics"
+	"github.com/iden3/go-service-template/pkg/ratelimit"
+	"github.com/iden3/go-service-template/pkg/reload"
 	httprouter "github.com/iden3/go-service-template/pkg/router/http"
 	"github.com/iden3/go-service-template/pkg/router/http/handlers"
 	"github.com/iden3/go-service-template/pkg/services/authentication"
 	"github.com/iden3/go-service-template/pkg/services/issuer"
 	"github.com/iden3/go-service-template/pkg/services/system"
 	"github.com/iden3/go-service-template/pkg/shutdown"
+	"github.com/iden3/go-service-template/pkg/stateresolver"
+	"github.com/iden3/go-service-template/pkg/tracing"
 	httptransport "github.com/iden3/go-service-template/pkg/transport/http"
 	"github.com/pkg/errors"
 )
 
 func main() {
-	cfg, err := config.Parse()
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfigCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	dev := flag.Bool("dev", false, "run against a local development chain with auto-deployed contracts")
+	configPath := flag.String("config", "", "path to the YAML or TOML config file")
+	flag.Parse()
+
+	var devChain *devchain.Chain
+	if *dev {
+		var err error
+		devChain, err = startDevChain(context.Background())
+		if err != nil {
+			log.Fatalf("failed to start dev chain: %v", err)
+		}
+	}
+
+	cfg, err := config.Load(*configPath)
 	if err != nil {
 		log.Fatalf("failed to parse config: %v", err)
 	}
+	if err = cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
 
 	if err = logger.SetDefaultLogger(
 		cfg.Log.Environment,
@@ -33,39 +71,169 @@ func main() {
 	); err != nil {
 		log.Fatalf("failed to set default logger: %v", err)
 	}
+	build := system.ReadBuildInfo()
+	logger.Info("starting", build.LogAttrs()...)
+
+	tracer, err := tracing.New(context.Background(), cfg.Tracing.Exporter,
+		tracing.WithServiceName(cfg.Tracing.ServiceName),
+		tracing.WithSampleRatio(cfg.Tracing.SampleRatio),
+	)
+	if err != nil {
+		logger.WithError(err).Fatal("error setting up tracing")
+	}
 
 	// init dependencies
-	authverifier, err := initializationAuthVerifier(cfg)
+	chains, err := initializationChainRegistry(cfg)
+	if err != nil {
+		logger.WithError(err).Fatal("error creating chain registry")
+	}
+
+	rpcclients, err := initializationRPCClients(cfg)
+	if err != nil {
+		logger.WithError(err).Fatal("error creating rpc clients")
+	}
+
+	keys := authentication.NewKeyCache(loaders.FSKeyLoader{Dir: cfg.KeysDirPath})
+	authverifier, stateCaches, err := initializationAuthVerifier(cfg, chains, rpcclients, keys)
 	if err != nil {
 		logger.WithError(err).Fatal("error creating auth verifier")
 	}
 
-	httpserver := newHTTPServer(
-		cfg,
-		authverifier,
+	app := &reloader{
+		path:    *configPath,
+		cfg:     cfg,
+		keys:    keys,
+		startup: system.NewStartupService(),
+		done:    make(chan struct{}),
+	}
+	app.rpcclients.Store(&rpcclients)
+	app.version = system.NewVersionService(build, app.deployment)
+	app.stateCaches.Store(&stateCaches)
+
+	eventStore, err := indexer.NewFileStore(cfg.Indexer.DataDir)
+	if err != nil {
+		logger.WithError(err).Fatal("error creating indexer store")
+	}
+	app.indexer, err = initializationIndexer(cfg, rpcclients, eventStore,
+		indexer.WithStateUpdateHook(app.invalidateState),
+	)
+	if err != nil {
+		logger.WithError(err).Fatal("error creating indexer")
+	}
+	if cfg.Indexer.Enabled {
+		app.indexer.Start()
+	}
+
+	// init services
+	authOpts := []authentication.Option{
+		authentication.WithMaxAge(cfg.Auth.MaxAge),
+		authentication.WithGracePeriod(cfg.Auth.GracePeriod),
+	}
+	if cfg.Auth.Store == "redis" {
+		app.sessionStore, err = authentication.NewRedisStore(cfg.Auth.RedisURL)
+		if err != nil {
+			logger.WithError(err).Fatal("error creating auth session store")
+		}
+		authOpts = append(authOpts, authentication.WithSharedStore(app.sessionStore))
+	}
+	app.authenticationService = authentication.NewAuthenticationService(authverifier, authOpts...)
+	metrics.Register()
+	metrics.SetSessionCount(app.authenticationService.SessionCount)
+	metrics.SetRPCEndpoints(app.rpcEndpoints)
+	app.issuerService = issuer.NewIssuerService(
 		cfg.Issuers,
+		contractCallers(rpcclients),
+		cfg.SupportedStateContracts,
+		eventStore,
+		issuer.WithMetadata(issuerMetadata(cfg)),
+	)
+
+	var (
+		routerOpts     []httprouter.Option
+		rateLimitStore ratelimit.Store
 	)
-	newShutdownManager(httpserver).HandleShutdownSignal()
+	if cfg.RateLimit.Enabled {
+		var limiter *ratelimit.Limiter
+		limiter, rateLimitStore, err = initializationRateLimiter(cfg)
+		if err != nil {
+			logger.WithError(err).Fatal("error creating rate limiter")
+		}
+		routerOpts = append(routerOpts, httprouter.WithRateLimiter(limiter))
+	}
+
+	app.readiness = system.NewReadinessService(
+		app.readinessCheckers(cfg, rpcclients),
+		system.WithCheckInterval(cfg.Readiness.CheckInterval),
+		system.WithCheckTimeout(cfg.Readiness.CheckTimeout),
+	)
+	app.readiness.Start()
+	watcher := reload.New(*configPath, app.Reload)
+	if err = watcher.Start(); err != nil {
+		logger.WithError(err).Fatal("error starting config watcher")
+	}
+
+	httpservers := httptransport.NewGroup(
+		newHTTPServer(
+			cfg,
+			app.authenticationService,
+			app.issuerService,
+			routerOpts...,
+		),
+		newAdminServer(cfg, app, watcher),
+	)
+	go func() {
+		err := httpservers.Start()
+		if errors.Is(err, http.ErrServerClosed) {
+			logger.Info("HTTP server closed by request")
+		} else {
+			logger.WithError(err).Fatal("http server closed with error")
+		}
+	}()
+	// the startup probe is served while the dependencies warm up
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Startup.Timeout)
+		defer cancel()
+		app.startup.Run(ctx, app.warmUps(cfg, rpcclients)...)
+	}()
+
+	m := shutdown.NewManager(
+		shutdown.WithCloseTimeout(cfg.Shutdown.Timeout),
+		shutdown.WithPhaseTimeout(shutdown.PhaseStopTraffic, cfg.Auth.GracePeriod+cfg.Shutdown.Timeout),
+		shutdown.WithStopDelay(cfg.Shutdown.Delay),
+	)
+	m.OnShutdown(app.readiness.SetShuttingDown)
+	m.OnShutdown(app.authenticationService.StopIssuing)
+	// the callbacks of the pending sessions are served
+	// for the grace period before the listeners stop
+	m.RegisterPhase(shutdown.PhaseStopTraffic, shutdown.Sequence(
+		shutdown.Func("auth sessions drain", app.authenticationService.Drain),
+		httpservers,
+	))
+	m.RegisterPhase(shutdown.PhaseDrain, app.authenticationService)
+	m.RegisterPhase(shutdown.PhaseClose, watcher, app.readiness, app.indexer, app)
+	if app.sessionStore != nil {
+		m.RegisterPhase(shutdown.PhaseClose, app.sessionStore)
+	}
+	if s, ok := rateLimitStore.(shutdown.Shutdown); ok {
+		m.RegisterPhase(shutdown.PhaseClose, s)
+	}
+	if devChain != nil {
+		m.RegisterPhase(shutdown.PhaseClose, devChain)
+	}
+	// the spans of the other phases are exported last
+	m.RegisterPhase(shutdown.PhaseTelemetry, tracer)
+	m.HandleShutdownSignal()
 }
 
+const callbackPath = "/api/v1/callback"
+
 func newHTTPServer(
 	cfg *config.Config,
-	authverifier *auth.Verifier,
-	issuers []string,
+	authenticationService *authentication.AuthenticationService,
+	issuerService *issuer.IssuerService,
+	opts ...httprouter.Option,
 ) *httptransport.Server {
-	// init services
-	authenticationService := authentication.NewAuthenticationService(
-		authverifier,
-	)
-	issuerService := issuer.NewIssuerService(
-		issuers,
-	)
-
 	// init handlers
-	systemHandlers := handlers.NewSystemHandler(
-		system.NewReadinessService(),
-		system.NewLivenessService(),
-	)
 	authenticationHandlers := handlers.NewAuthenticationHandlers(
 		cfg.ExternalHost,
 		authenticationService,
@@ -76,68 +244,392 @@ func newHTTPServer(
 
 	// init routers
 	h := httprouter.NewHandlers(
-		systemHandlers,
 		authenticationHandlers,
 		issuerHandlers,
 	)
-	routers := h.NewRouter(
-		httprouter.WithOrigins(cfg.HTTPServer.Origins),
-	)
+	if cfg.HTTPServer.TLS.ClientCAFile != "" {
+		opts = append(opts, httprouter.WithClientCertPaths(cfg.HTTPServer.TLS.ClientCertPaths...))
+	}
+	routers := h.NewRouter(append(
+		[]httprouter.Option{
+			httprouter.WithOrigins(cfg.HTTPServer.Origins),
+			httprouter.WithBodyLimits(cfg.HTTPServer.BodyLimit, map[string]int64{
+				callbackPath: cfg.HTTPServer.CallbackBodyLimit,
+			}),
+		},
+		opts...,
+	)...)
 
-	// run http server
-	httpserver := httptransport.New(
-		routers,
+	serverOpts := []httptransport.Option{
 		httptransport.WithWriteTimeout(0),
 		httptransport.WithHost(cfg.HTTPServer.Host, cfg.HTTPServer.Port),
+	}
+	if cfg.HTTPServer.TLS.Enabled() {
+		serverOpts = append(serverOpts, withTLS(&cfg.HTTPServer.TLS))
+	}
+	return httptransport.New(routers, serverOpts...)
+}
+
+// newAdminServer is the internal listener of the probes,
+// the metrics, pprof and the admin routes.
+func newAdminServer(cfg *config.Config, app *reloader, watcher *reload.Watcher) *httptransport.Server {
+	systemHandlers := handlers.NewSystemHandler(
+		app.readiness,
+		system.NewLivenessService(),
+		app.startup,
+		app.version,
+	)
+	adminHandlers := handlers.NewAdminHandlers(
+		func(w io.Writer) error {
+			return app.Config().FileForm().Redacted().Encode(w, "yaml")
+		},
+		watcher.Reload,
 	)
+	h := httprouter.NewAdminHandlers(systemHandlers, adminHandlers)
+	var opts []httprouter.Option
+	if cfg.Admin.TLS.ClientCAFile != "" {
+		paths := cfg.Admin.TLS.ClientCertPaths
+		if len(paths) == 0 {
+			paths = httprouter.AdminClientCertPaths
+		}
+		opts = append(opts, httprouter.WithClientCertPaths(paths...))
+	}
 
-	go func() {
-		err := httpserver.Start()
-		if errors.Is(err, http.ErrServerClosed) {
-			logger.Info("HTTP server closed by request")
-		} else {
-			logger.WithError(err).Fatal("http server closed with error")
+	serverOpts := []httptransport.Option{
+		httptransport.WithName("admin"),
+		// the profiles of pprof take longer than the default
+		httptransport.WithWriteTimeout(0),
+		httptransport.WithHost(cfg.Admin.Host, cfg.Admin.Port),
+	}
+	if cfg.Admin.TLS.Enabled() {
+		serverOpts = append(serverOpts, withTLS(&cfg.Admin.TLS))
+	}
+	return httptransport.New(h.NewRouter(cfg.Admin.Token, opts...), serverOpts...)
+}
+
+// withTLS is the TLS option of the config, that is validated at startup.
+func withTLS(cfg *config.TLS) httptransport.Option {
+	minVersion, _ := httptransport.ParseTLSVersion(cfg.MinVersion)
+	cipherSuites, _ := httptransport.ParseCipherSuites(cfg.CipherSuites)
+	opts := []httptransport.TLSOption{
+		httptransport.WithMinVersion(minVersion),
+		httptransport.WithCipherSuites(cipherSuites),
+	}
+	if cfg.ClientCAFile != "" {
+		opts = append(opts, httptransport.WithClientCAs(cfg.ClientCAFile))
+	}
+	return httptransport.WithTLS(cfg.CertFile, cfg.KeyFile, opts...)
+}
+
+// initializationRateLimiter limits the requests per client address, and
+// the proof verifications per auth session and per sender DID.
+func initializationRateLimiter(cfg *config.Config) (*ratelimit.Limiter, ratelimit.Store, error) {
+	var store ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimit.Store == "redis" {
+		redisStore, err := ratelimit.NewRedisStore(cfg.RateLimit.RedisURL)
+		if err != nil {
+			return nil, nil, err
 		}
-	}()
+		store = redisStore
+	}
 
-	return httpserver
+	limiter := ratelimit.New(store,
+		ratelimit.Rule{
+			Name:  "ip",
+			Limit: ratelimit.Limit{Rate: cfg.RateLimit.IPRate, Burst: cfg.RateLimit.IPBurst},
+			Key:   ratelimit.ClientIP,
+		},
+		ratelimit.Rule{
+			Name:  "session",
+			Limit: ratelimit.Limit{Rate: cfg.RateLimit.SessionRate, Burst: cfg.RateLimit.SessionBurst},
+			Key:   ratelimit.OnPath(callbackPath, ratelimit.Query("sessionId")),
+		},
+		ratelimit.Rule{
+			Name:  "did",
+			Limit: ratelimit.Limit{Rate: cfg.RateLimit.DIDRate, Burst: cfg.RateLimit.DIDBurst},
+			Key:   ratelimit.OnPath(callbackPath, ratelimit.JWZSender(cfg.HTTPServer.CallbackBodyLimit)),
+		},
+	)
+	return limiter, store, nil
 }
 
-func newShutdownManager(toclose ...shutdown.Shutdown) *shutdown.Manager {
-	m := shutdown.NewManager()
-	for _, s := range toclose {
-		m.Register(s)
+func contractCallers(rpcclients map[string]*ethrpc.Client) map[string]bind.ContractCaller {
+	callers := make(map[string]bind.ContractCaller, len(rpcclients))
+	for network, client := range rpcclients {
+		callers[network] = client
 	}
-	return m
+	return callers
 }
 
-func chainIDToDIDPrefix(chainID int) string {
-	p := map[int]string{
-		137:   "polygon:main",
-		80001: "polygon:mumbai",
-		80002: "polygon:amoy",
-		21000: "privado:main",
-		21001: "privado:test",
+func issuerMetadata(cfg *config.Config) map[string]issuer.Metadata {
+	metadata := make(map[string]issuer.Metadata, len(cfg.IssuerDetails))
+	for _, i := range cfg.IssuerDetails {
+		metadata[i.DID] = issuer.Metadata{
+			Name:        i.Name,
+			Description: i.Description,
+		}
 	}
-	return p[chainID]
+	return metadata
 }
 
-func initializationAuthVerifier(configuration *config.Config) (*auth.Verifier, error) {
-	var resolvers = make(map[string]pubsignals.StateResolver, len(configuration.SupportedStateContracts))
-	for network, contractAddress := range configuration.SupportedStateContracts {
-		rpcURL, ok := configuration.SupportedRPC[network]
+// startDevChain starts the local chain, deploys the contracts and
+// exports their addresses and the issuer DID into the environment,
+// so that the regular config picks them up.
+func startDevChain(ctx context.Context) (*devchain.Chain, error) {
+	devcfg, err := config.ParseDev()
+	if err != nil {
+		return nil, errors.Errorf("failed to parse dev config: %v", err)
+	}
+	if err = logger.SetDefaultLogger(logger.EnvDevelopment, slog.LevelInfo); err != nil {
+		return nil, err
+	}
+
+	c, err := devchain.Start(ctx, devchain.Config{
+		RPCURL:      devcfg.RPCURL,
+		HTTPHost:    devcfg.HTTPHost,
+		HTTPPort:    devcfg.HTTPPort,
+		PrivateKey:  devcfg.PrivateKey,
+		BlockPeriod: devcfg.BlockPeriod,
+	})
+	if err != nil {
+		return nil, err
+	}
+	deployment, err := c.Deploy(ctx, devcfg.ArtifactsDir)
+	if err != nil {
+		_ = c.Shutdown(ctx)
+		return nil, err
+	}
+
+	network := c.ChainID.String()
+	custom, err := chain.ParseChains(map[string]string{network: devcfg.Chain})
+	if err != nil {
+		_ = c.Shutdown(ctx)
+		return nil, err
+	}
+	if _, err = chain.NewRegistry(custom...); err != nil {
+		_ = c.Shutdown(ctx)
+		return nil, err
+	}
+	typ, err := core.BuildDIDType(custom[0].Method, custom[0].Blockchain, custom[0].Network)
+	if err != nil {
+		_ = c.Shutdown(ctx)
+		return nil, err
+	}
+	did, err := core.NewDID(typ, core.GenesisFromEthAddress(deployment.Issuer))
+	if err != nil {
+		_ = c.Shutdown(ctx)
+		return nil, err
+	}
+
+	appendEnv("CHAINS", fmt.Sprintf("%s=%s", network, devcfg.Chain))
+	appendEnv("SUPPORTED_STATE_CONTRACTS", fmt.Sprintf("%s=%s", network, deployment.State.Hex()))
+	appendEnv("SUPPORTED_RPC", fmt.Sprintf("%s=%s", network, c.RPCURL))
+	appendEnv("ISSUERS", did.String())
+	if os.Getenv("EXTERNAL_HOST") == "" {
+		_ = os.Setenv("EXTERNAL_HOST", devcfg.ExternalHost)
+	}
+	// the dev chain mines on demand, so its latest block gets old
+	if os.Getenv("READINESS_MAX_BLOCK_AGE") == "" {
+		_ = os.Setenv("READINESS_MAX_BLOCK_AGE", "0s")
+	}
+
+	logger.Info("dev chain is ready",
+		slog.String("rpc", ethrpc.RedactURL(c.RPCURL)),
+		slog.String("chainID", network),
+		slog.String("state", deployment.State.Hex()),
+		slog.String("issuer", did.String()))
+	return c, nil
+}
+
+// appendEnv adds an item to a comma separated environment variable.
+func appendEnv(key, value string) {
+	if existing := os.Getenv(key); existing != "" {
+		value = existing + "," + value
+	}
+	_ = os.Setenv(key, value)
+}
+
+func initializationChainRegistry(configuration *config.Config) (*chain.Registry, error) {
+	custom, err := chain.ParseChains(configuration.Chains)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := chain.NewRegistry(custom...)
+	if err != nil {
+		return nil, err
+	}
+	for network := range configuration.SupportedStateContracts {
+		if _, err := registry.ByNetwork(network); err != nil {
+			return nil, errors.Errorf("state contract is configured for unknown chain: %v", err)
+		}
+	}
+	for network := range configuration.SupportedRPC {
+		if _, err := registry.ByNetwork(network); err != nil {
+			return nil, errors.Errorf("rpc is configured for unknown chain: %v", err)
+		}
+	}
+	for _, n := range configuration.Networks {
+		if n.DIDPrefix == "" {
+			continue
+		}
+		c, err := registry.ByChainID(n.ChainID)
+		if err != nil {
+			return nil, errors.Errorf("network is configured for unknown chain: %v", err)
+		}
+		if prefix := fmt.Sprintf("%s:%s", c.Method, c.DIDPrefix()); prefix != n.DIDPrefix {
+			return nil, errors.Errorf("did prefix '%s' of chain id %d does not match '%s'",
+				n.DIDPrefix, n.ChainID, prefix)
+		}
+	}
+	return registry, nil
+}
+
+func initializationRPCClients(configuration *config.Config) (map[string]*ethrpc.Client, error) {
+	clients := make(map[string]*ethrpc.Client, len(configuration.SupportedRPC))
+	for network, urls := range configuration.SupportedRPC {
+		client, err := dialRPC(configuration, network, urls)
+		if err != nil {
+			closeRPCClients(clients)
+			return nil, err
+		}
+		clients[network] = client
+	}
+	return clients, nil
+}
+
+func dialRPC(configuration *config.Config, network string, urls []string) (*ethrpc.Client, error) {
+	client, err := ethrpc.Dial(
+		network,
+		urls,
+		ethrpc.WithRetries(configuration.RPC.Retries),
+		ethrpc.WithRetryBackoff(configuration.RPC.RetryBackoff),
+		ethrpc.WithHealthCheckInterval(configuration.RPC.HealthCheckInterval),
+		ethrpc.WithHealthCheckTimeout(configuration.RPC.HealthCheckTimeout),
+	)
+	if err != nil {
+		return nil, errors.Errorf("error connecting to rpc for network %s: %v", network, err)
+	}
+	client.Start()
+	return client, nil
+}
+
+func closeRPCClients(clients map[string]*ethrpc.Client) {
+	for network, client := range clients {
+		if err := client.Shutdown(context.Background()); err != nil {
+			logger.WithError(err).Error("error closing rpc client", slog.String("network", network))
+		}
+	}
+}
+
+func initializationIndexer(
+	configuration *config.Config,
+	rpcclients map[string]*ethrpc.Client,
+	store indexer.Store,
+	opts ...indexer.Option,
+) (*indexer.Indexer, error) {
+	targets, err := initializationIndexerTargets(configuration, rpcclients)
+	if err != nil {
+		return nil, err
+	}
+	opts = append([]indexer.Option{
+		indexer.WithPollInterval(configuration.Indexer.PollInterval),
+		indexer.WithBatchSize(configuration.Indexer.BatchSize),
+		indexer.WithReorgDepth(configuration.Indexer.ReorgDepth),
+	}, opts...)
+	return indexer.New(store, targets, opts...), nil
+}
+
+func initializationIndexerTargets(
+	configuration *config.Config,
+	rpcclients map[string]*ethrpc.Client,
+) ([]indexer.Target, error) {
+	targets := make([]indexer.Target, 0, len(configuration.Issuers))
+	for _, issuerDID := range configuration.Issuers {
+		did, err := w3c.ParseDID(issuerDID)
+		if err != nil {
+			return nil, errors.Errorf("invalid issuer did '%s': %v", issuerDID, err)
+		}
+		id, err := core.IDFromDID(*did)
+		if err != nil {
+			return nil, errors.Errorf("invalid issuer did '%s': %v", issuerDID, err)
+		}
+		contract, err := core.EthAddressFromID(id)
+		if err != nil {
+			return nil, errors.Errorf("issuer did '%s' is not an onchain issuer: %v", issuerDID, err)
+		}
+		chainID, err := core.ChainIDfromDID(*did)
+		if err != nil {
+			return nil, errors.Errorf("unknown chain for issuer did '%s': %v", issuerDID, err)
+		}
+		network := strconv.Itoa(int(chainID))
+		client, ok := rpcclients[network]
 		if !ok {
 			return nil, errors.Errorf("no rpc for network %s", network)
 		}
-		chainID, _ := strconv.Atoi(network)
-		resolvers[chainIDToDIDPrefix(chainID)] = state.NewETHResolver(rpcURL, contractAddress)
+		stateContract, ok := configuration.SupportedStateContracts[network]
+		if !ok {
+			return nil, errors.Errorf("no state contract for network %s", network)
+		}
+
+		var startBlock uint64
+		if v, ok := configuration.Indexer.StartBlocks[issuerDID]; ok {
+			startBlock, err = strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return nil, errors.Errorf("invalid start block for issuer '%s': %v", issuerDID, err)
+			}
+		}
+
+		targets = append(targets, indexer.Target{
+			IssuerDID:     issuerDID,
+			IssuerID:      id.BigInt(),
+			Contract:      common.Address(contract),
+			StateContract: common.HexToAddress(stateContract),
+			StartBlock:    startBlock,
+			Backend:       client,
+		})
+	}
+	return targets, nil
+}
+
+func initializationAuthVerifier(
+	configuration *config.Config,
+	chains *chain.Registry,
+	rpcclients map[string]*ethrpc.Client,
+	keys loaders.VerificationKeyLoader,
+) (*auth.Verifier, []*stateresolver.CachingResolver, error) {
+	var (
+		resolvers = make(map[string]pubsignals.StateResolver, len(configuration.SupportedStateContracts))
+		caches    []*stateresolver.CachingResolver
+	)
+	for network, contractAddress := range configuration.SupportedStateContracts {
+		client, ok := rpcclients[network]
+		if !ok {
+			return nil, nil, errors.Errorf("no rpc for network %s", network)
+		}
+		var resolver pubsignals.StateResolver
+		resolver, err := stateresolver.NewETHResolver(client, contractAddress)
+		if err != nil {
+			return nil, nil, errors.Errorf("error creating state resolver for network %s: %v", network, err)
+		}
+		if configuration.StateCache.Enabled {
+			c := stateresolver.NewCachingResolver(
+				resolver,
+				configuration.StateCache.LatestTTL,
+				configuration.StateCache.HistoricTTL,
+			)
+			caches = append(caches, c)
+			resolver = c
+		}
+		c, err := chains.ByNetwork(network)
+		if err != nil {
+			return nil, nil, err
+		}
+		resolvers[c.DIDPrefix()] = resolver
 	}
 
-	verifier, err := auth.NewVerifier(loaders.FSKeyLoader{
-		Dir: configuration.KeysDirPath,
-	}, resolvers)
+	verifier, err := auth.NewVerifier(keys, resolvers)
 	if err != nil {
-		return nil, errors.Errorf("error creating verifier: %v", err)
+		return nil, nil, errors.Errorf("error creating verifier: %v", err)
 	}
-	return verifier, nil
+	return verifier, caches, nil
 }
@@ -0,0 +1,149 @@
+package chain
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	core "github.com/iden3/go-iden3-core/v2"
+	"github.com/pkg/errors"
+)
+
+// ErrUnknownChain is returned for chain IDs that are not in the registry.
+var ErrUnknownChain = errors.New("unknown chain")
+
+// Chain maps a chain ID to the DID method, blockchain and network.
+type Chain struct {
+	ChainID    int
+	Method     core.DIDMethod
+	Blockchain core.Blockchain
+	Network    core.NetworkID
+	// NetworkFlag is the DID network byte. It is only required
+	// for networks that are unknown to go-iden3-core.
+	NetworkFlag byte
+}
+
+// DIDPrefix returns the "blockchain:network" part of the DID,
+// that is also used as the key of the state resolvers.
+func (c Chain) DIDPrefix() string {
+	return fmt.Sprintf("%s:%s", c.Blockchain, c.Network)
+}
+
+func (c Chain) String() string {
+	return fmt.Sprintf("%d=%s:%s", c.ChainID, c.Method, c.DIDPrefix())
+}
+
+var defaultChains = []Chain{
+	{ChainID: 137, Method: core.DIDMethodPolygonID, Blockchain: core.Polygon, Network: core.Main},
+	{ChainID: 80001, Method: core.DIDMethodPolygonID, Blockchain: core.Polygon, Network: core.Mumbai},
+	{ChainID: 80002, Method: core.DIDMethodPolygonID, Blockchain: core.Polygon, Network: core.Amoy},
+	{ChainID: 21000, Method: core.DIDMethodIden3, Blockchain: core.Privado, Network: core.Main},
+	{ChainID: 21001, Method: core.DIDMethodIden3, Blockchain: core.Privado, Network: core.Test},
+}
+
+// DefaultChains returns the built-in chains.
+func DefaultChains() []Chain {
+	return append([]Chain(nil), defaultChains...)
+}
+
+// go-iden3-core keeps the registered networks in global maps
+var registerLock sync.Mutex
+
+type Registry struct {
+	chains map[int]Chain
+}
+
+// NewRegistry creates a registry with the default chains and the custom
+// chains. Custom chains are registered in go-iden3-core, so that DIDs
+// on them can be parsed.
+func NewRegistry(custom ...Chain) (*Registry, error) {
+	r := &Registry{
+		chains: make(map[int]Chain, len(defaultChains)+len(custom)),
+	}
+	for _, c := range defaultChains {
+		r.chains[c.ChainID] = c
+	}
+
+	registerLock.Lock()
+	defer registerLock.Unlock()
+	for _, c := range custom {
+		err := core.RegisterDIDMethodNetwork(core.DIDMethodNetworkParams{
+			Method:      c.Method,
+			Blockchain:  c.Blockchain,
+			Network:     c.Network,
+			NetworkFlag: c.NetworkFlag,
+		}, core.WithChainID(c.ChainID))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to register chain %s", c)
+		}
+		r.chains[c.ChainID] = c
+	}
+	return r, nil
+}
+
+// ByChainID returns the chain or ErrUnknownChain.
+func (r *Registry) ByChainID(chainID int) (Chain, error) {
+	c, ok := r.chains[chainID]
+	if !ok {
+		return Chain{}, errors.Wrapf(ErrUnknownChain, "chain id %d", chainID)
+	}
+	return c, nil
+}
+
+// ByNetwork returns the chain for a chain ID in its string form,
+// as it is used in the configuration maps.
+func (r *Registry) ByNetwork(network string) (Chain, error) {
+	chainID, err := strconv.Atoi(network)
+	if err != nil {
+		return Chain{}, errors.Wrapf(ErrUnknownChain, "invalid chain id '%s'", network)
+	}
+	return r.ByChainID(chainID)
+}
+
+// Chains returns all the chains ordered by chain ID.
+func (r *Registry) Chains() []Chain {
+	chains := make([]Chain, 0, len(r.chains))
+	for _, c := range r.chains {
+		chains = append(chains, c)
+	}
+	sort.Slice(chains, func(i, j int) bool {
+		return chains[i].ChainID < chains[j].ChainID
+	})
+	return chains
+}
+
+// ParseChains parses custom chains in the form of
+// chainID => "method:blockchain:network:networkFlag",
+// e.g. "31337" => "iden3:local:dev:0x91".
+func ParseChains(values map[string]string) ([]Chain, error) {
+	chains := make([]Chain, 0, len(values))
+	for network, value := range values {
+		chainID, err := strconv.Atoi(network)
+		if err != nil {
+			return nil, errors.Errorf("invalid chain id '%s'", network)
+		}
+		parts := strings.Split(value, ":")
+		if len(parts) != 4 {
+			return nil, errors.Errorf(
+				"invalid chain '%s' for chain id %d, expected method:blockchain:network:networkFlag",
+				value, chainID)
+		}
+		flag, err := strconv.ParseUint(parts[3], 0, 8)
+		if err != nil {
+			return nil, errors.Errorf("invalid network flag '%s' for chain id %d", parts[3], chainID)
+		}
+		chains = append(chains, Chain{
+			ChainID:     chainID,
+			Method:      core.DIDMethod(parts[0]),
+			Blockchain:  core.Blockchain(parts[1]),
+			Network:     core.NetworkID(parts[2]),
+			NetworkFlag: byte(flag),
+		})
+	}
+	sort.Slice(chains, func(i, j int) bool {
+		return chains[i].ChainID < chains[j].ChainID
+	})
+	return chains, nil
+}
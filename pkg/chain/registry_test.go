@@ -0,0 +1,65 @@
+package chain_test
+
+import (
+	"testing"
+
+	core "github.com/iden3/go-iden3-core/v2"
+	"github.com/iden3/go-service-template/pkg/chain"
+	"github.com/pkg/errors"
+)
+
+func TestRegistryCustomChain(t *testing.T) {
+	custom, err := chain.ParseChains(map[string]string{
+		"31337": "iden3:local:dev:0x91",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry, err := chain.NewRegistry(custom...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := registry.ByNetwork("31337")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.DIDPrefix() != "local:dev" {
+		t.Fatalf("unexpected did prefix: %s", c.DIDPrefix())
+	}
+
+	// custom network is known to go-iden3-core
+	chainID, err := core.GetChainID("local", "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chainID != 31337 {
+		t.Fatalf("unexpected chain id: %d", chainID)
+	}
+
+	amoy, err := registry.ByChainID(80002)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if amoy.DIDPrefix() != "polygon:amoy" {
+		t.Fatalf("unexpected did prefix: %s", amoy.DIDPrefix())
+	}
+}
+
+func TestRegistryUnknownChain(t *testing.T) {
+	registry, err := chain.NewRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.ByChainID(1); !errors.Is(err, chain.ErrUnknownChain) {
+		t.Fatalf("expected unknown chain error, got %v", err)
+	}
+}
+
+func TestParseChainsInvalid(t *testing.T) {
+	for _, value := range []string{"iden3:local:dev", "iden3:local:dev:0x1ff"} {
+		if _, err := chain.ParseChains(map[string]string{"31337": value}); err == nil {
+			t.Fatalf("expected error for '%s'", value)
+		}
+	}
+}
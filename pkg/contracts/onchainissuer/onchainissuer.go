@@ -0,0 +1,94 @@
+package onchainissuer
+
+import (
+	_ "embed"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+//go:embed abi.json
+var issuerABIJSON string
+
+// ABI is the parsed ABI of the non-merklized onchain issuer contract.
+var ABI = mustParseABI(issuerABIJSON)
+
+func mustParseABI(s string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(s))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// Roots is the set of trees roots that compose an identity state.
+type Roots struct {
+	ClaimsRoot      *big.Int
+	RevocationsRoot *big.Int
+	RootsRoot       *big.Int
+}
+
+// IssuerCaller is a read-only binding to the onchain issuer contract.
+type IssuerCaller struct {
+	contract *bind.BoundContract
+}
+
+func NewIssuerCaller(address common.Address, caller bind.ContractCaller) *IssuerCaller {
+	return &IssuerCaller{
+		contract: bind.NewBoundContract(address, ABI, caller, nil, nil),
+	}
+}
+
+func (c *IssuerCaller) GetID(opts *bind.CallOpts) (*big.Int, error) {
+	return c.callBigInt(opts, "getId")
+}
+
+func (c *IssuerCaller) GetLatestPublishedState(opts *bind.CallOpts) (*big.Int, error) {
+	return c.callBigInt(opts, "getLatestPublishedState")
+}
+
+func (c *IssuerCaller) GetLatestPublishedClaimsRoot(opts *bind.CallOpts) (*big.Int, error) {
+	return c.callBigInt(opts, "getLatestPublishedClaimsRoot")
+}
+
+func (c *IssuerCaller) GetLatestPublishedRevocationsRoot(opts *bind.CallOpts) (*big.Int, error) {
+	return c.callBigInt(opts, "getLatestPublishedRevocationsRoot")
+}
+
+func (c *IssuerCaller) GetLatestPublishedRootsRoot(opts *bind.CallOpts) (*big.Int, error) {
+	return c.callBigInt(opts, "getLatestPublishedRootsRoot")
+}
+
+func (c *IssuerCaller) GetRootsByState(opts *bind.CallOpts, state *big.Int) (Roots, error) {
+	var out []interface{}
+	if err := c.contract.Call(opts, &out, "getRootsByState", state); err != nil {
+		return Roots{}, errors.Wrap(err, "failed to call getRootsByState")
+	}
+	if len(out) != 1 {
+		return Roots{}, errors.Errorf("unexpected getRootsByState output length: %d", len(out))
+	}
+	roots, ok := abi.ConvertType(out[0], new(Roots)).(*Roots)
+	if !ok {
+		return Roots{}, errors.New("unexpected getRootsByState output type")
+	}
+	return *roots, nil
+}
+
+func (c *IssuerCaller) callBigInt(opts *bind.CallOpts, method string) (*big.Int, error) {
+	var out []interface{}
+	if err := c.contract.Call(opts, &out, method); err != nil {
+		return nil, errors.Wrapf(err, "failed to call %s", method)
+	}
+	if len(out) != 1 {
+		return nil, errors.Errorf("unexpected %s output length: %d", method, len(out))
+	}
+	v, ok := out[0].(*big.Int)
+	if !ok {
+		return nil, errors.Errorf("unexpected %s output type: %T", method, out[0])
+	}
+	return v, nil
+}
@@ -0,0 +1,360 @@
+package devchain
+
+import (
+	"context"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"log/slog"
+	"math/big"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/pkg/errors"
+)
+
+// artifacts holds the deployment manifest and the hardhat
+// artifacts of the contracts, see artifacts/README.md.
+//
+//go:generate go run ./internal/gen artifacts
+//go:embed artifacts
+var artifacts embed.FS
+
+const (
+	RoleState  = "state"
+	RoleIssuer = "issuer"
+
+	deployerRef = "$deployer"
+	deployTime  = 2 * time.Minute
+)
+
+// Manifest is the ordered list of contracts to deploy.
+type Manifest struct {
+	Contracts []ContractSpec `json:"contracts"`
+}
+
+type ContractSpec struct {
+	// Name is how the deployed contract is referenced by the next steps.
+	Name string `json:"name"`
+	// Artifact is the hardhat artifact file name without extension.
+	Artifact string `json:"artifact"`
+	// Role marks the contracts that are wired into the service config.
+	Role string `json:"role,omitempty"`
+	// Libraries maps library names in the link references to deployed names.
+	Libraries map[string]string `json:"libraries,omitempty"`
+	// Args are the constructor arguments.
+	Args []string `json:"args,omitempty"`
+	// Initialize is called after the deployment, or passed
+	// to the proxy constructor when Proxy is set.
+	Initialize *Call `json:"initialize,omitempty"`
+	// Proxy is the artifact of an ERC1967 compatible proxy with
+	// the (implementation, data) constructor.
+	Proxy string `json:"proxy,omitempty"`
+}
+
+type Call struct {
+	Method string   `json:"method"`
+	Args   []string `json:"args"`
+}
+
+type artifact struct {
+	ContractName   string                                `json:"contractName"`
+	ABI            json.RawMessage                       `json:"abi"`
+	Bytecode       string                                `json:"bytecode"`
+	LinkReferences map[string]map[string][]linkReference `json:"linkReferences"`
+}
+
+type linkReference struct {
+	Start  int `json:"start"`
+	Length int `json:"length"`
+}
+
+// Deployment is the result of the manifest deployment.
+type Deployment struct {
+	Addresses map[string]common.Address
+	State     common.Address
+	Issuer    common.Address
+}
+
+// Deploy deploys the manifest contracts. Artifacts are read from
+// the directory when it is set, and from the embedded files otherwise.
+func (c *Chain) Deploy(ctx context.Context, artifactsDir string) (*Deployment, error) {
+	var fsys fs.FS
+	if artifactsDir != "" {
+		fsys = os.DirFS(artifactsDir)
+	} else {
+		sub, err := fs.Sub(artifacts, "artifacts")
+		if err != nil {
+			return nil, err
+		}
+		fsys = sub
+	}
+
+	var manifest Manifest
+	if err := readJSON(fsys, "manifest.json", &manifest); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deployTime)
+	defer cancel()
+
+	d := &Deployment{Addresses: map[string]common.Address{}}
+	for _, spec := range manifest.Contracts {
+		address, err := c.deployContract(ctx, fsys, spec, d.Addresses)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to deploy '%s'", spec.Name)
+		}
+		d.Addresses[spec.Name] = address
+		logger.Info("dev contract deployed",
+			slog.String("name", spec.Name),
+			slog.String("address", address.Hex()))
+
+		switch spec.Role {
+		case RoleState:
+			d.State = address
+		case RoleIssuer:
+			d.Issuer = address
+		}
+	}
+	if d.State == (common.Address{}) || d.Issuer == (common.Address{}) {
+		return nil, errors.New("manifest must have contracts with the 'state' and 'issuer' roles")
+	}
+	return d, nil
+}
+
+func (c *Chain) deployContract(
+	ctx context.Context,
+	fsys fs.FS,
+	spec ContractSpec,
+	deployed map[string]common.Address,
+) (common.Address, error) {
+	var a artifact
+	if err := readJSON(fsys, spec.Artifact+".json", &a); err != nil {
+		return common.Address{}, err
+	}
+	contractABI, err := abi.JSON(strings.NewReader(string(a.ABI)))
+	if err != nil {
+		return common.Address{}, errors.Wrapf(err, "invalid abi in artifact '%s'", spec.Artifact)
+	}
+	bytecode, err := link(a, spec.Libraries, deployed)
+	if err != nil {
+		return common.Address{}, err
+	}
+	args, err := parseArgs(contractABI.Constructor.Inputs, spec.Args, c.Deployer, deployed)
+	if err != nil {
+		return common.Address{}, errors.Wrap(err, "invalid constructor args")
+	}
+	address, err := c.deploy(ctx, contractABI, bytecode, args...)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if spec.Initialize == nil {
+		return address, nil
+	}
+
+	method, ok := contractABI.Methods[spec.Initialize.Method]
+	if !ok {
+		return common.Address{}, errors.Errorf("no method '%s' in the abi", spec.Initialize.Method)
+	}
+	initArgs, err := parseArgs(method.Inputs, spec.Initialize.Args, c.Deployer, deployed)
+	if err != nil {
+		return common.Address{}, errors.Wrap(err, "invalid initialize args")
+	}
+	calldata, err := contractABI.Pack(method.Name, initArgs...)
+	if err != nil {
+		return common.Address{}, errors.Wrap(err, "failed to pack initialize call")
+	}
+
+	if spec.Proxy == "" {
+		return address, c.transact(ctx, address, contractABI, method.Name, initArgs...)
+	}
+
+	var proxy artifact
+	if err := readJSON(fsys, spec.Proxy+".json", &proxy); err != nil {
+		return common.Address{}, err
+	}
+	proxyABI, err := abi.JSON(strings.NewReader(string(proxy.ABI)))
+	if err != nil {
+		return common.Address{}, errors.Wrapf(err, "invalid abi in artifact '%s'", spec.Proxy)
+	}
+	proxyBytecode, err := link(proxy, nil, deployed)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return c.deploy(ctx, proxyABI, proxyBytecode, address, calldata)
+}
+
+func (c *Chain) transactOpts(ctx context.Context) (*bind.TransactOpts, error) {
+	opts, err := bind.NewKeyedTransactorWithChainID(c.key, c.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	opts.Context = ctx
+	return opts, nil
+}
+
+func (c *Chain) deploy(
+	ctx context.Context,
+	contractABI abi.ABI,
+	bytecode []byte,
+	args ...interface{},
+) (common.Address, error) {
+	opts, err := c.transactOpts(ctx)
+	if err != nil {
+		return common.Address{}, err
+	}
+	_, tx, _, err := bind.DeployContract(opts, contractABI, bytecode, c.client, args...)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return bind.WaitDeployed(ctx, c.client, tx)
+}
+
+func (c *Chain) transact(
+	ctx context.Context,
+	address common.Address,
+	contractABI abi.ABI,
+	method string,
+	args ...interface{},
+) error {
+	opts, err := c.transactOpts(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := bind.NewBoundContract(address, contractABI, c.client, c.client, c.client).
+		Transact(opts, method, args...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to call '%s'", method)
+	}
+	receipt, err := bind.WaitMined(ctx, c.client, tx)
+	if err != nil {
+		return err
+	}
+	if receipt.Status != 1 {
+		return errors.Errorf("'%s' transaction %s reverted", method, tx.Hash().Hex())
+	}
+	return nil
+}
+
+// link replaces the library placeholders in the artifact bytecode.
+func link(a artifact, libraries map[string]string, deployed map[string]common.Address) ([]byte, error) {
+	code := []byte(strings.TrimPrefix(a.Bytecode, "0x"))
+	for _, libs := range a.LinkReferences {
+		for lib, refs := range libs {
+			name := lib
+			if mapped, ok := libraries[lib]; ok {
+				name = mapped
+			}
+			address, ok := deployed[name]
+			if !ok {
+				return nil, errors.Errorf("library '%s' of '%s' is not deployed", lib, a.ContractName)
+			}
+			addressHex := hex.EncodeToString(address.Bytes())
+			for _, ref := range refs {
+				start, end := ref.Start*2, (ref.Start+ref.Length)*2
+				if end > len(code) || ref.Length != common.AddressLength {
+					return nil, errors.Errorf("invalid link reference for '%s'", lib)
+				}
+				copy(code[start:end], addressHex)
+			}
+		}
+	}
+	bytecode, err := hex.DecodeString(string(code))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid bytecode of '%s'", a.ContractName)
+	}
+	return bytecode, nil
+}
+
+// parseArgs converts manifest arguments into abi values. Addresses
+// may reference deployed contracts by "$name" and the deployer by "$deployer".
+func parseArgs(
+	inputs abi.Arguments,
+	values []string,
+	deployer common.Address,
+	deployed map[string]common.Address,
+) ([]interface{}, error) {
+	if len(inputs) != len(values) {
+		return nil, errors.Errorf("expected %d args, got %d", len(inputs), len(values))
+	}
+	args := make([]interface{}, 0, len(values))
+	for i, input := range inputs {
+		v, err := parseArg(input.Type, values[i], deployer, deployed)
+		if err != nil {
+			return nil, errors.Wrapf(err, "arg '%s'", input.Name)
+		}
+		args = append(args, v)
+	}
+	return args, nil
+}
+
+func parseArg(
+	t abi.Type,
+	value string,
+	deployer common.Address,
+	deployed map[string]common.Address,
+) (interface{}, error) {
+	switch t.T {
+	case abi.AddressTy:
+		switch {
+		case value == deployerRef:
+			return deployer, nil
+		case strings.HasPrefix(value, "$"):
+			address, ok := deployed[value[1:]]
+			if !ok {
+				return nil, errors.Errorf("contract '%s' is not deployed", value[1:])
+			}
+			return address, nil
+		case common.IsHexAddress(value):
+			return common.HexToAddress(value), nil
+		}
+		return nil, errors.Errorf("invalid address '%s'", value)
+	case abi.BoolTy:
+		return strconv.ParseBool(value)
+	case abi.StringTy:
+		return value, nil
+	case abi.UintTy, abi.IntTy:
+		n, ok := new(big.Int).SetString(value, 0)
+		if !ok {
+			return nil, errors.Errorf("invalid integer '%s'", value)
+		}
+		if t.Size > 64 {
+			return n, nil
+		}
+		v := reflect.New(t.GetType()).Elem()
+		if t.T == abi.UintTy {
+			v.SetUint(n.Uint64())
+		} else {
+			v.SetInt(n.Int64())
+		}
+		return v.Interface(), nil
+	case abi.FixedBytesTy:
+		b, err := hex.DecodeString(strings.TrimPrefix(value, "0x"))
+		if err != nil || len(b) != t.Size {
+			return nil, errors.Errorf("invalid bytes%d '%s'", t.Size, value)
+		}
+		v := reflect.New(t.GetType()).Elem()
+		reflect.Copy(v, reflect.ValueOf(b))
+		return v.Interface(), nil
+	case abi.BytesTy:
+		return hex.DecodeString(strings.TrimPrefix(value, "0x"))
+	default:
+		return nil, errors.Errorf("unsupported type '%s'", t.String())
+	}
+}
+
+func readJSON(fsys fs.FS, name string, v interface{}) error {
+	content, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read '%s'", name)
+	}
+	return errors.Wrapf(json.Unmarshal(content, v), "failed to decode '%s'", name)
+}
@@ -0,0 +1,139 @@
+package devchain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/ethconfig"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/iden3/go-service-template/pkg/ethrpc"
+	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/pkg/errors"
+)
+
+// Config of the local development chain.
+type Config struct {
+	// RPCURL of an external dev node, like anvil. When it is empty,
+	// an in-process simulated chain is started instead.
+	RPCURL string
+	// HTTPHost and HTTPPort are where the simulated chain serves JSON-RPC.
+	HTTPHost string
+	HTTPPort int
+	// PrivateKey of the deployer account. The simulated chain funds it.
+	PrivateKey string
+	// BlockPeriod is how often the simulated chain seals a block.
+	BlockPeriod time.Duration
+}
+
+// Chain is a running local development chain.
+type Chain struct {
+	RPCURL   string
+	ChainID  *big.Int
+	Deployer common.Address
+
+	key     *ecdsa.PrivateKey
+	client  *ethclient.Client
+	backend *simulated.Backend
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Start starts the simulated chain, or connects to the external dev node.
+func Start(ctx context.Context, cfg Config) (*Chain, error) {
+	key, err := crypto.HexToECDSA(trimHex(cfg.PrivateKey))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid dev private key")
+	}
+	c := &Chain{
+		RPCURL:   cfg.RPCURL,
+		Deployer: crypto.PubkeyToAddress(key.PublicKey),
+		key:      key,
+	}
+
+	if c.RPCURL == "" {
+		c.backend = simulated.NewBackend(
+			types.GenesisAlloc{
+				c.Deployer: {Balance: new(big.Int).Lsh(big.NewInt(1), 100)},
+			},
+			withHTTP(cfg.HTTPHost, cfg.HTTPPort),
+		)
+		c.RPCURL = fmt.Sprintf("http://%s:%d", cfg.HTTPHost, cfg.HTTPPort)
+		c.startSealing(cfg.BlockPeriod)
+		logger.Info("simulated dev chain started", slog.String("rpc", c.RPCURL))
+	}
+
+	c.client, err = ethclient.DialContext(ctx, c.RPCURL)
+	if err != nil {
+		_ = c.Shutdown(ctx)
+		return nil, errors.Wrapf(err, "failed to connect to dev chain '%s'", ethrpc.RedactURL(c.RPCURL))
+	}
+	c.ChainID, err = c.client.ChainID(ctx)
+	if err != nil {
+		_ = c.Shutdown(ctx)
+		return nil, errors.Wrap(err, "failed to get dev chain id")
+	}
+	return c, nil
+}
+
+func withHTTP(host string, port int) func(*node.Config, *ethconfig.Config) {
+	return func(nodeConf *node.Config, _ *ethconfig.Config) {
+		nodeConf.HTTPHost = host
+		nodeConf.HTTPPort = port
+		nodeConf.HTTPModules = []string{"eth", "net", "web3"}
+		nodeConf.HTTPVirtualHosts = []string{"*"}
+		nodeConf.HTTPCors = []string{"*"}
+	}
+}
+
+// startSealing commits blocks periodically, since
+// the simulated chain only seals blocks on request.
+func (c *Chain) startSealing(period time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.backend.Commit()
+			}
+		}
+	}()
+}
+
+func (c *Chain) Shutdown(_ context.Context) error {
+	if c.cancel != nil {
+		c.cancel()
+		c.wg.Wait()
+	}
+	if c.client != nil {
+		c.client.Close()
+	}
+	if c.backend != nil {
+		return c.backend.Close()
+	}
+	return nil
+}
+
+func trimHex(s string) string {
+	if len(s) >= 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		return s[2:]
+	}
+	return s
+}
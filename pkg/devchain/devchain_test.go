@@ -0,0 +1,111 @@
+package devchain_test
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/ethclient"
+	core "github.com/iden3/go-iden3-core/v2"
+	"github.com/iden3/go-service-template/pkg/chain"
+	"github.com/iden3/go-service-template/pkg/devchain"
+	"github.com/iden3/go-service-template/pkg/devchain/internal/devcontracts"
+	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/iden3/go-service-template/pkg/services/issuer"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// the first anvil account, the default of DEV_PRIVATE_KEY
+const devKey = "ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80"
+
+func TestMain(m *testing.M) {
+	if err := logger.SetDefaultLogger(logger.EnvDevelopment, slog.LevelError); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestArtifactsAreGenerated(t *testing.T) {
+	artifacts, err := devcontracts.Artifacts()
+	require.NoError(t, err)
+	for _, a := range artifacts {
+		expected, err := json.MarshalIndent(a, "", "  ")
+		require.NoError(t, err)
+		committed, err := os.ReadFile(filepath.Join("artifacts", a.ContractName+".json"))
+		require.NoError(t, err)
+		require.Equal(t, string(expected)+"\n", string(committed),
+			"%s is out of date, run go generate ./pkg/devchain", a.ContractName)
+	}
+}
+
+func TestDeploy(t *testing.T) {
+	ctx := context.Background()
+	c, err := devchain.Start(ctx, devchain.Config{
+		HTTPHost:    "127.0.0.1",
+		HTTPPort:    freePort(t),
+		PrivateKey:  devKey,
+		BlockPeriod: 50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Shutdown(ctx) })
+
+	deployment, err := c.Deploy(ctx, "")
+	require.NoError(t, err)
+
+	network := c.ChainID.String()
+	custom, err := chain.ParseChains(map[string]string{network: "iden3:local:dev:0xf1"})
+	require.NoError(t, err)
+	_, err = chain.NewRegistry(custom...)
+	require.NoError(t, err)
+	typ, err := core.BuildDIDType(custom[0].Method, custom[0].Blockchain, custom[0].Network)
+	require.NoError(t, err)
+	did, err := core.NewDID(typ, core.GenesisFromEthAddress(deployment.Issuer))
+	require.NoError(t, err)
+
+	client, err := ethclient.Dial(c.RPCURL)
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	service := issuer.NewIssuerService(
+		[]string{did.String()},
+		map[string]bind.ContractCaller{network: client},
+		map[string]string{network: deployment.State.Hex()},
+		nil,
+	)
+
+	// the issuer publishes the state of the empty trees on the initialization
+	state, err := service.GetIssuerState(ctx, did.String())
+	require.NoError(t, err)
+	genesis, err := core.IdenState(big.NewInt(0), big.NewInt(0), big.NewInt(0))
+	require.NoError(t, err)
+	require.Equal(t, genesis.String(), state.Latest.State)
+	require.True(t, state.Consistent)
+
+	roots, err := service.GetRootsByState(ctx, did.String(), genesis.String())
+	require.NoError(t, err)
+	require.Equal(t, "0", roots.ClaimsRoot)
+	require.True(t, roots.Latest)
+
+	_, err = service.GetRootsByState(ctx, did.String(), "1")
+	require.True(t, errors.Is(err, issuer.ErrStateNotFound), err)
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(t, err)
+	p, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	return p
+}
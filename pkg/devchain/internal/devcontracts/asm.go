@@ -0,0 +1,177 @@
+package devcontracts
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// program is an EVM assembler. Jump targets are referenced by labels,
+// that are resolved when the code is built.
+type program struct {
+	code   []byte
+	labels map[string]int
+	refs   map[int]string
+}
+
+func newProgram() *program {
+	return &program{labels: map[string]int{}, refs: map[int]string{}}
+}
+
+// expr pushes one value on the stack.
+type expr func(p *program)
+
+func (p *program) op(ops ...vm.OpCode) {
+	for _, o := range ops {
+		p.code = append(p.code, byte(o))
+	}
+}
+
+func (p *program) push(v *big.Int) {
+	b := v.Bytes()
+	if len(b) == 0 {
+		b = []byte{0}
+	}
+	p.op(vm.PUSH1 + vm.OpCode(len(b)-1))
+	p.code = append(p.code, b...)
+}
+
+// pushLabel pushes the position of the label, as two bytes.
+func (p *program) pushLabel(name string) {
+	p.op(vm.PUSH2)
+	p.refs[len(p.code)] = name
+	p.code = append(p.code, 0, 0)
+}
+
+func (p *program) label(name string) {
+	if _, ok := p.labels[name]; ok {
+		panic(fmt.Sprintf("duplicate label %q", name))
+	}
+	p.labels[name] = len(p.code)
+	p.op(vm.JUMPDEST)
+}
+
+// mark labels a position that is not a jump target, e.g. of data.
+func (p *program) mark(name string) {
+	if _, ok := p.labels[name]; ok {
+		panic(fmt.Sprintf("duplicate label %q", name))
+	}
+	p.labels[name] = len(p.code)
+}
+
+func (p *program) jump(name string) {
+	p.pushLabel(name)
+	p.op(vm.JUMP)
+}
+
+func (p *program) jumpIf(name string, cond expr) {
+	cond(p)
+	p.pushLabel(name)
+	p.op(vm.JUMPI)
+}
+
+// call runs the subroutine at the label, that returns with ret.
+func (p *program) call(name string) {
+	back := fmt.Sprintf("%s-return-%d", name, len(p.code))
+	p.pushLabel(back)
+	p.jump(name)
+	p.label(back)
+}
+
+// ret returns from a subroutine to the position left on the stack.
+func (p *program) ret() {
+	p.op(vm.JUMP)
+}
+
+func (p *program) mstore(offset int64, value expr) {
+	p.apply(vm.MSTORE, num(offset), value)
+}
+
+func (p *program) sstore(key, value expr) {
+	p.apply(vm.SSTORE, key, value)
+}
+
+// apply runs the operation with the first argument on the top of the stack.
+func (p *program) apply(o vm.OpCode, args ...expr) {
+	for i := len(args) - 1; i >= 0; i-- {
+		args[i](p)
+	}
+	p.op(o)
+}
+
+// returnWords returns the memory words from the offset.
+func (p *program) returnWords(offset int64, words int) {
+	p.apply(vm.RETURN, num(offset), num(int64(words)*32))
+}
+
+// revert reverts with Error(string), like the require of solidity.
+// The message is up to 32 bytes.
+func (p *program) revert(msg string) {
+	if len(msg) > 32 {
+		panic(fmt.Sprintf("revert message %q is too long", msg))
+	}
+	selector := new(big.Int).Lsh(big.NewInt(0x08c379a0), 224)
+	word := make([]byte, 32)
+	copy(word, msg)
+	p.mstore(0, value(selector))
+	p.mstore(4, num(32))
+	p.mstore(36, num(int64(len(msg))))
+	p.mstore(68, value(new(big.Int).SetBytes(word)))
+	p.apply(vm.REVERT, num(0), num(100))
+}
+
+// bytes resolves the labels and returns the code.
+func (p *program) bytes() []byte {
+	code := append([]byte{}, p.code...)
+	for pos, name := range p.refs {
+		target, ok := p.labels[name]
+		if !ok {
+			panic(fmt.Sprintf("undefined label %q", name))
+		}
+		code[pos], code[pos+1] = byte(target>>8), byte(target)
+	}
+	return code
+}
+
+func value(v *big.Int) expr {
+	return func(p *program) { p.push(v) }
+}
+
+func labelAt(name string) expr {
+	return func(p *program) { p.pushLabel(name) }
+}
+
+func num(v int64) expr {
+	return value(big.NewInt(v))
+}
+
+func opExpr(o vm.OpCode, args ...expr) expr {
+	return func(p *program) { p.apply(o, args...) }
+}
+
+// arg is the static argument of the call by its index.
+func arg(i int64) expr            { return opExpr(vm.CALLDATALOAD, num(4+32*i)) }
+func mload(offset int64) expr     { return opExpr(vm.MLOAD, num(offset)) }
+func sload(key expr) expr         { return opExpr(vm.SLOAD, key) }
+func add(a, b expr) expr          { return opExpr(vm.ADD, a, b) }
+func sub(a, b expr) expr          { return opExpr(vm.SUB, a, b) }
+func eq(a, b expr) expr           { return opExpr(vm.EQ, a, b) }
+func isZero(a expr) expr          { return opExpr(vm.ISZERO, a) }
+func and(a, b expr) expr          { return opExpr(vm.AND, a, b) }
+func shl(n uint, a expr) expr     { return opExpr(vm.SHL, num(int64(n)), a) }
+func shr(n uint, a expr) expr     { return opExpr(vm.SHR, num(int64(n)), a) }
+func byteAt(i int64, a expr) expr { return opExpr(vm.BYTE, num(i), a) }
+
+// keccak hashes the memory words from zero.
+func keccak(words int64) expr { return opExpr(vm.KECCAK256, num(0), num(words*32)) }
+
+func slot(base expr, field int64) expr { return add(base, num(field)) }
+
+var (
+	caller    = opExpr(vm.CALLER)
+	address   = opExpr(vm.ADDRESS)
+	timestamp = opExpr(vm.TIMESTAMP)
+	number    = opExpr(vm.NUMBER)
+	codeSize  = opExpr(vm.CODESIZE)
+)
@@ -0,0 +1,318 @@
+// Package devcontracts builds the contracts that the dev mode deploys
+// instead of the State and the onchain issuer contracts. They implement
+// the methods and the events the service uses, with the same ABI, and
+// are assembled here, since the dev mode runs without a solidity compiler.
+package devcontracts
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	core "github.com/iden3/go-iden3-core/v2"
+)
+
+// Artifact is a contract in the form of a hardhat artifact.
+type Artifact struct {
+	ContractName   string            `json:"contractName"`
+	ABI            json.RawMessage   `json:"abi"`
+	Bytecode       string            `json:"bytecode"`
+	LinkReferences map[string]string `json:"linkReferences"`
+}
+
+// stateABI is the part of the State contract that the service calls.
+const stateABI = `[
+	{"inputs": [{"internalType": "uint256", "name": "id", "type": "uint256"}, {"internalType": "uint256", "name": "oldState", "type": "uint256"}, {"internalType": "uint256", "name": "newState", "type": "uint256"}, {"internalType": "bool", "name": "isOldStateGenesis", "type": "bool"}, {"internalType": "uint256", "name": "methodId", "type": "uint256"}, {"internalType": "bytes", "name": "methodParams", "type": "bytes"}], "name": "transitStateGeneric", "outputs": [], "stateMutability": "nonpayable", "type": "function"},
+	{"inputs": [{"internalType": "uint256", "name": "id", "type": "uint256"}], "name": "getStateInfoById", "outputs": [{"components": [{"internalType": "uint256", "name": "id", "type": "uint256"}, {"internalType": "uint256", "name": "state", "type": "uint256"}, {"internalType": "uint256", "name": "replacedByState", "type": "uint256"}, {"internalType": "uint256", "name": "createdAtTimestamp", "type": "uint256"}, {"internalType": "uint256", "name": "replacedAtTimestamp", "type": "uint256"}, {"internalType": "uint256", "name": "createdAtBlock", "type": "uint256"}, {"internalType": "uint256", "name": "replacedAtBlock", "type": "uint256"}], "internalType": "struct IState.StateInfo", "name": "", "type": "tuple"}], "stateMutability": "view", "type": "function"},
+	{"inputs": [{"internalType": "uint256", "name": "id", "type": "uint256"}, {"internalType": "uint256", "name": "state", "type": "uint256"}], "name": "getStateInfoByIdAndState", "outputs": [{"components": [{"internalType": "uint256", "name": "id", "type": "uint256"}, {"internalType": "uint256", "name": "state", "type": "uint256"}, {"internalType": "uint256", "name": "replacedByState", "type": "uint256"}, {"internalType": "uint256", "name": "createdAtTimestamp", "type": "uint256"}, {"internalType": "uint256", "name": "replacedAtTimestamp", "type": "uint256"}, {"internalType": "uint256", "name": "createdAtBlock", "type": "uint256"}, {"internalType": "uint256", "name": "replacedAtBlock", "type": "uint256"}], "internalType": "struct IState.StateInfo", "name": "", "type": "tuple"}], "stateMutability": "view", "type": "function"},
+	{"inputs": [{"internalType": "uint256", "name": "root", "type": "uint256"}], "name": "getGISTRootInfo", "outputs": [{"components": [{"internalType": "uint256", "name": "root", "type": "uint256"}, {"internalType": "uint256", "name": "replacedByRoot", "type": "uint256"}, {"internalType": "uint256", "name": "createdAtTimestamp", "type": "uint256"}, {"internalType": "uint256", "name": "replacedAtTimestamp", "type": "uint256"}, {"internalType": "uint256", "name": "createdAtBlock", "type": "uint256"}, {"internalType": "uint256", "name": "replacedAtBlock", "type": "uint256"}], "internalType": "struct IState.GistRootInfo", "name": "", "type": "tuple"}], "stateMutability": "view", "type": "function"},
+	{"anonymous": false, "inputs": [{"indexed": false, "internalType": "uint256", "name": "id", "type": "uint256"}, {"indexed": false, "internalType": "uint256", "name": "blockN", "type": "uint256"}, {"indexed": false, "internalType": "uint256", "name": "timestamp", "type": "uint256"}, {"indexed": false, "internalType": "uint256", "name": "state", "type": "uint256"}], "name": "StateUpdated", "type": "event"}
+]`
+
+// issuerABI is the part of the onchain issuer contract that the service
+// calls, with the constructor that takes the type of the issuer id.
+const issuerABI = `[
+	{"inputs": [{"internalType": "bytes2", "name": "idType", "type": "bytes2"}], "stateMutability": "nonpayable", "type": "constructor"},
+	{"inputs": [{"internalType": "address", "name": "_stateContractAddr", "type": "address"}], "name": "initialize", "outputs": [], "stateMutability": "nonpayable", "type": "function"},
+	{"inputs": [], "name": "owner", "outputs": [{"internalType": "address", "name": "", "type": "address"}], "stateMutability": "view", "type": "function"},
+	{"inputs": [], "name": "getId", "outputs": [{"internalType": "uint256", "name": "", "type": "uint256"}], "stateMutability": "view", "type": "function"},
+	{"inputs": [], "name": "getLatestPublishedState", "outputs": [{"internalType": "uint256", "name": "", "type": "uint256"}], "stateMutability": "view", "type": "function"},
+	{"inputs": [], "name": "getLatestPublishedClaimsRoot", "outputs": [{"internalType": "uint256", "name": "", "type": "uint256"}], "stateMutability": "view", "type": "function"},
+	{"inputs": [], "name": "getLatestPublishedRevocationsRoot", "outputs": [{"internalType": "uint256", "name": "", "type": "uint256"}], "stateMutability": "view", "type": "function"},
+	{"inputs": [], "name": "getLatestPublishedRootsRoot", "outputs": [{"internalType": "uint256", "name": "", "type": "uint256"}], "stateMutability": "view", "type": "function"},
+	{"inputs": [{"internalType": "uint256", "name": "state", "type": "uint256"}], "name": "getRootsByState", "outputs": [{"components": [{"internalType": "uint256", "name": "claimsRoot", "type": "uint256"}, {"internalType": "uint256", "name": "revocationsRoot", "type": "uint256"}, {"internalType": "uint256", "name": "rootsRoot", "type": "uint256"}], "internalType": "struct IdentityLib.Roots", "name": "", "type": "tuple"}], "stateMutability": "view", "type": "function"},
+	{"anonymous": false, "inputs": [{"indexed": false, "internalType": "uint8", "name": "version", "type": "uint8"}], "name": "Initialized", "type": "event"},
+	{"anonymous": false, "inputs": [{"indexed": true, "internalType": "address", "name": "previousOwner", "type": "address"}, {"indexed": true, "internalType": "address", "name": "newOwner", "type": "address"}], "name": "OwnershipTransferred", "type": "event"}
+]`
+
+// Artifacts returns the dev State and issuer contracts.
+func Artifacts() ([]Artifact, error) {
+	state, err := newArtifact("DevState", stateABI, func(*program) {}, stateMethods)
+	if err != nil {
+		return nil, err
+	}
+	genesis, err := core.IdenState(big.NewInt(0), big.NewInt(0), big.NewInt(0))
+	if err != nil {
+		return nil, err
+	}
+	issuer, err := newArtifact("DevIssuer", issuerABI, issuerConstructor, func(a abi.ABI) map[string]func(*program) {
+		return issuerMethods(a, genesis)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []Artifact{state, issuer}, nil
+}
+
+func newArtifact(
+	name, abiJSON string,
+	constructor func(p *program),
+	methods func(a abi.ABI) map[string]func(p *program),
+) (Artifact, error) {
+	parsed, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		return Artifact{}, err
+	}
+	var compact json.RawMessage
+	if err := json.Unmarshal([]byte(abiJSON), &compact); err != nil {
+		return Artifact{}, err
+	}
+	return Artifact{
+		ContractName:   name,
+		ABI:            compact,
+		Bytecode:       "0x" + hex.EncodeToString(deployCode(constructor, runtimeCode(parsed, methods(parsed)))),
+		LinkReferences: map[string]string{},
+	}, nil
+}
+
+// deployCode runs the constructor and returns the runtime code.
+// The constructor arguments follow the code.
+func deployCode(constructor func(p *program), runtime []byte) []byte {
+	p := newProgram()
+	constructor(p)
+	p.apply(vm.CODECOPY, num(0), labelAt("runtime"), num(int64(len(runtime))))
+	p.apply(vm.RETURN, num(0), num(int64(len(runtime))))
+	p.mark("runtime")
+	return append(p.bytes(), runtime...)
+}
+
+// runtimeCode dispatches the calls by the method selector.
+func runtimeCode(a abi.ABI, methods map[string]func(p *program)) []byte {
+	names := make([]string, 0, len(methods))
+	for _, m := range a.Methods {
+		if _, ok := methods[m.Name]; ok {
+			names = append(names, m.Name)
+		}
+	}
+	if len(names) != len(methods) {
+		panic("a method is not in the abi")
+	}
+	sort.Strings(names)
+
+	p := newProgram()
+	selector := shr(224, opExpr(vm.CALLDATALOAD, num(0)))
+	for _, name := range names {
+		p.jumpIf(name, eq(selector, value(new(big.Int).SetBytes(a.Methods[name].ID))))
+	}
+	p.apply(vm.REVERT, num(0), num(0))
+	for _, name := range names {
+		p.label(name)
+		methods[name](p)
+	}
+	return p.bytes()
+}
+
+// The memory of the State methods.
+const (
+	memID     = 0x100
+	memState  = 0x120
+	memLatest = 0x140
+	memBase   = 0x160
+	memOut    = 0x200
+)
+
+// stateMethods keep the states of the identities. The latest state of the
+// id is at keccak256(id), and the info of a state at keccak256(id, state)
+// in the order of the StateInfo fields. The transitions are not verified,
+// and every GIST root is reported as the latest one.
+func stateMethods(a abi.ABI) map[string]func(p *program) {
+	stateUpdated := value(a.Events["StateUpdated"].ID.Big())
+	return map[string]func(p *program){
+		"transitStateGeneric": func(p *program) {
+			p.mstore(memID, arg(0))
+			p.mstore(memState, arg(2))
+			p.mstore(0, mload(memID))
+			p.mstore(32, mload(memState))
+			p.mstore(memBase, keccak(2))
+			p.jumpIf("stateExists", sload(mload(memBase)))
+
+			p.mstore(memLatest, sload(keccak(1)))
+			p.jumpIf("replaced", isZero(mload(memLatest)))
+			p.mstore(32, mload(memLatest))
+			p.sstore(slot(keccak(2), 2), mload(memState))
+			p.sstore(slot(keccak(2), 4), timestamp)
+			p.sstore(slot(keccak(2), 6), number)
+			p.label("replaced")
+
+			p.sstore(slot(mload(memBase), 0), mload(memID))
+			p.sstore(slot(mload(memBase), 1), mload(memState))
+			p.sstore(slot(mload(memBase), 3), timestamp)
+			p.sstore(slot(mload(memBase), 5), number)
+			p.sstore(keccak(1), mload(memState))
+
+			p.mstore(32, number)
+			p.mstore(64, timestamp)
+			p.mstore(96, mload(memState))
+			p.apply(vm.LOG1, num(0), num(128), stateUpdated)
+			p.op(vm.STOP)
+
+			p.label("stateExists")
+			p.revert("State already exists")
+		},
+		"getStateInfoById": func(p *program) {
+			p.mstore(0, arg(0))
+			p.mstore(32, sload(keccak(1)))
+			p.jumpIf("stateNotFound", isZero(mload(32)))
+			p.jump("stateInfo")
+		},
+		"getStateInfoByIdAndState": func(p *program) {
+			p.mstore(0, arg(0))
+			p.mstore(32, arg(1))
+			p.jumpIf("stateNotFound", isZero(sload(keccak(2))))
+
+			p.label("stateInfo")
+			p.mstore(memBase, keccak(2))
+			for i := int64(0); i < 7; i++ {
+				p.mstore(memOut+32*i, sload(slot(mload(memBase), i)))
+			}
+			p.returnWords(memOut, 7)
+
+			p.label("stateNotFound")
+			p.revert("State does not exist")
+		},
+		"getGISTRootInfo": func(p *program) {
+			p.mstore(memOut, arg(0))
+			p.mstore(memOut+64, timestamp)
+			p.mstore(memOut+128, number)
+			p.returnWords(memOut, 6)
+		},
+	}
+}
+
+// The storage slots of the issuer.
+const (
+	slotOwner = iota
+	slotState
+	slotIDType
+	slotLatest
+)
+
+// The memory of the issuer methods.
+const (
+	memAcc  = 0x100
+	memSum  = 0x120
+	memRoot = 0x140
+	memCall = 0x200
+)
+
+// issuerConstructor keeps the id type and the deployer as the owner.
+func issuerConstructor(p *program) {
+	p.apply(vm.CODECOPY, num(0), sub(codeSize, num(32)), num(32))
+	p.sstore(num(slotIDType), shr(240, mload(0)))
+	p.sstore(num(slotOwner), caller)
+	ownershipTransferred := crypto.Keccak256Hash([]byte("OwnershipTransferred(address,address)"))
+	p.apply(vm.LOG3, num(0), num(0), value(ownershipTransferred.Big()), num(0), caller)
+}
+
+// issuerMethods publish the genesis state, of the empty trees, on the
+// initialization. The roots of a state are at keccak256(state).
+func issuerMethods(a abi.ABI, genesis *big.Int) map[string]func(p *program) {
+	latestRoot := func(field int64) func(p *program) {
+		return func(p *program) {
+			p.mstore(0, sload(num(slotLatest)))
+			p.mstore(0, sload(slot(keccak(1), field)))
+			p.returnWords(0, 1)
+		}
+	}
+	return map[string]func(p *program){
+		"initialize": func(p *program) {
+			p.jumpIf("notOwner", isZero(eq(caller, sload(num(slotOwner)))))
+			p.jumpIf("initialized", sload(num(slotState)))
+			p.sstore(num(slotState), arg(0))
+			p.mstore(0, num(1))
+			p.apply(vm.LOG1, num(0), num(32), value(a.Events["Initialized"].ID.Big()))
+
+			p.mstore(0, value(genesis))
+			p.sstore(slot(keccak(1), 3), num(1))
+			p.sstore(num(slotLatest), value(genesis))
+
+			// transitStateGeneric(id, 0, genesis, true, 1, "")
+			transit := crypto.Keccak256([]byte("transitStateGeneric(uint256,uint256,uint256,bool,uint256,bytes)"))[:4]
+			p.mstore(memCall, value(new(big.Int).Lsh(new(big.Int).SetBytes(transit), 224)))
+			p.call("id")
+			p.mstore(memCall+4, mload(memAcc))
+			p.mstore(memCall+68, value(genesis))
+			p.mstore(memCall+100, num(1))
+			p.mstore(memCall+132, num(1))
+			p.mstore(memCall+164, num(192))
+			p.apply(vm.CALL, opExpr(vm.GAS), sload(num(slotState)), num(0), num(memCall), num(4+7*32), num(0), num(0))
+			// the success of the call is on the stack
+			p.pushLabel("transited")
+			p.op(vm.JUMPI)
+			p.apply(vm.RETURNDATACOPY, num(0), num(0), opExpr(vm.RETURNDATASIZE))
+			p.apply(vm.REVERT, num(0), opExpr(vm.RETURNDATASIZE))
+			p.label("transited")
+			p.op(vm.STOP)
+
+			p.label("notOwner")
+			p.revert("Ownable: caller is not the owner")
+			p.label("initialized")
+			p.revert("Contract is already initialized")
+		},
+		"owner": func(p *program) {
+			p.mstore(0, sload(num(slotOwner)))
+			p.returnWords(0, 1)
+		},
+		"getId": func(p *program) {
+			p.call("id")
+			p.returnWords(memAcc, 1)
+
+			// id computes the id of the contract address, like
+			// core.NewID(idType, core.GenesisFromEthAddress(address)),
+			// in the little endian byte order of ID.BigInt.
+			p.label("id")
+			p.mstore(memAcc, add(shr(8, sload(num(slotIDType))), shl(8, and(sload(num(slotIDType)), num(0xff)))))
+			p.mstore(memSum, add(shr(8, sload(num(slotIDType))), and(sload(num(slotIDType)), num(0xff))))
+			for j := int64(0); j < 20; j++ {
+				b := byteAt(12+j, address)
+				p.mstore(memAcc, add(mload(memAcc), shl(uint(8*(9+j)), b)))
+				p.mstore(memSum, add(mload(memSum), b))
+			}
+			p.mstore(memAcc, add(mload(memAcc), shl(8*29, mload(memSum))))
+			p.ret()
+		},
+		"getLatestPublishedState": func(p *program) {
+			p.mstore(0, sload(num(slotLatest)))
+			p.returnWords(0, 1)
+		},
+		"getLatestPublishedClaimsRoot":      latestRoot(0),
+		"getLatestPublishedRevocationsRoot": latestRoot(1),
+		"getLatestPublishedRootsRoot":       latestRoot(2),
+		"getRootsByState": func(p *program) {
+			p.mstore(0, arg(0))
+			p.mstore(memRoot, keccak(1))
+			p.jumpIf("rootsNotFound", isZero(sload(slot(mload(memRoot), 3))))
+			for i := int64(0); i < 3; i++ {
+				p.mstore(memCall+32*i, sload(slot(mload(memRoot), i)))
+			}
+			p.returnWords(memCall, 3)
+			p.label("rootsNotFound")
+			p.revert("Roots do not exist")
+		},
+	}
+}
@@ -0,0 +1,32 @@
+// Command gen writes the artifacts of the dev contracts
+// to the directory given as the argument.
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/iden3/go-service-template/pkg/devchain/internal/devcontracts"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("usage: gen <artifacts dir>")
+	}
+	artifacts, err := devcontracts.Artifacts()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, a := range artifacts {
+		content, err := json.MarshalIndent(a, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		path := filepath.Join(os.Args[1], a.ContractName+".json")
+		if err := os.WriteFile(path, append(content, '\n'), 0o600); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
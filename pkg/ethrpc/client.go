@@ -0,0 +1,439 @@
+package ethrpc
+
+import (
+	"context"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/iden3/go-service-template/pkg/metrics"
+	"github.com/iden3/go-service-template/pkg/tracing"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrNoEndpoints is returned when the client has no endpoints configured.
+var ErrNoEndpoints = errors.New("no rpc endpoints")
+
+const (
+	// ewmaWeight is the weight of the latest observation in the moving averages.
+	ewmaWeight = 0.2
+	// errorPenalty is how much the error rate increases the endpoint score.
+	errorPenalty = 10
+)
+
+// EndpointStatus is a snapshot of the endpoint health.
+type EndpointStatus struct {
+	URL         string        `json:"url"`
+	Healthy     bool          `json:"healthy"`
+	Latency     time.Duration `json:"latency"`
+	ErrorRate   float64       `json:"errorRate"`
+	BlockNumber uint64        `json:"blockNumber"`
+	LastCheck   time.Time     `json:"lastCheck"`
+	LastError   string        `json:"lastError,omitempty"`
+}
+
+type endpoint struct {
+	url    string
+	client *ethclient.Client
+
+	mu          sync.RWMutex
+	healthy     bool
+	latency     time.Duration
+	errorRate   float64
+	blockNumber uint64
+	lastCheck   time.Time
+	lastErr     error
+}
+
+func (e *endpoint) observe(latency time.Duration, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.latency == 0 {
+		e.latency = latency
+	} else {
+		e.latency = time.Duration(ewmaWeight*float64(latency) + (1-ewmaWeight)*float64(e.latency))
+	}
+	var failed float64
+	if err != nil {
+		failed = 1
+		e.lastErr = err
+	}
+	e.errorRate = ewmaWeight*failed + (1-ewmaWeight)*e.errorRate
+}
+
+func (e *endpoint) score() float64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	s := float64(e.latency) * (1 + errorPenalty*e.errorRate)
+	if !e.healthy {
+		s += float64(time.Hour)
+	}
+	return s
+}
+
+func (e *endpoint) status() EndpointStatus {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	s := EndpointStatus{
+		URL:         RedactURL(e.url),
+		Healthy:     e.healthy,
+		Latency:     e.latency,
+		ErrorRate:   e.errorRate,
+		BlockNumber: e.blockNumber,
+		LastCheck:   e.lastCheck,
+	}
+	if e.lastErr != nil {
+		s.LastError = e.lastErr.Error()
+	}
+	return s
+}
+
+// Client is an ethereum client over several rpc endpoints of the same chain.
+// Calls go to the endpoint with the best score, and on transport
+// failures are retried on the next endpoints.
+type Client struct {
+	chainID             string
+	endpoints           []*endpoint
+	retries             int
+	retryBackoff        time.Duration
+	healthCheckInterval time.Duration
+	healthCheckTimeout  time.Duration
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type Option func(*Client)
+
+// WithRetries sets how many times a failed call is retried.
+func WithRetries(retries int) Option {
+	return func(c *Client) {
+		c.retries = retries
+	}
+}
+
+func WithRetryBackoff(backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retryBackoff = backoff
+	}
+}
+
+func WithHealthCheckInterval(interval time.Duration) Option {
+	return func(c *Client) {
+		c.healthCheckInterval = interval
+	}
+}
+
+func WithHealthCheckTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.healthCheckTimeout = timeout
+	}
+}
+
+// Dial creates a client for the chain over the rpc urls.
+func Dial(chainID string, urls []string, opts ...Option) (*Client, error) {
+	if len(urls) == 0 {
+		return nil, errors.Wrapf(ErrNoEndpoints, "chain %s", chainID)
+	}
+	c := &Client{
+		chainID:             chainID,
+		retries:             2,
+		retryBackoff:        200 * time.Millisecond,
+		healthCheckInterval: 30 * time.Second,
+		healthCheckTimeout:  5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	for _, u := range urls {
+		client, err := ethclient.Dial(u)
+		if err != nil {
+			return nil, errors.Wrapf(RedactError(err, u), "failed to dial rpc '%s'", RedactURL(u))
+		}
+		// endpoints are optimistically healthy until the first check
+		c.endpoints = append(c.endpoints, &endpoint{url: u, client: client, healthy: true})
+	}
+	return c, nil
+}
+
+func (c *Client) ChainID() string {
+	return c.chainID
+}
+
+// Endpoints returns the health of every endpoint.
+func (c *Client) Endpoints() []EndpointStatus {
+	statuses := make([]EndpointStatus, 0, len(c.endpoints))
+	for _, e := range c.endpoints {
+		statuses = append(statuses, e.status())
+	}
+	return statuses
+}
+
+// Start runs the periodic health checks until Shutdown is called.
+func (c *Client) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(c.healthCheckInterval)
+		defer ticker.Stop()
+		for {
+			c.CheckHealth(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (c *Client) Shutdown(_ context.Context) error {
+	if c.cancel != nil {
+		c.cancel()
+		c.wg.Wait()
+	}
+	for _, e := range c.endpoints {
+		e.client.Close()
+	}
+	return nil
+}
+
+// CheckHealth requests the latest block from every endpoint.
+func (c *Client) CheckHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, e := range c.endpoints {
+		wg.Add(1)
+		go func(e *endpoint) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, c.healthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			block, err := e.client.BlockNumber(checkCtx)
+			err = RedactError(err, e.url)
+			e.observe(time.Since(start), err)
+
+			e.mu.Lock()
+			wasHealthy := e.healthy
+			e.healthy = err == nil
+			e.lastCheck = time.Now()
+			if err == nil {
+				e.blockNumber = block
+			}
+			e.mu.Unlock()
+
+			if wasHealthy != (err == nil) {
+				l := logger.WithContext(ctx)
+				if err != nil {
+					l = l.WithError(err)
+				}
+				l.Warn("rpc endpoint health changed",
+					slog.String("chainID", c.chainID),
+					slog.String("url", RedactURL(e.url)),
+					slog.Bool("healthy", err == nil))
+			}
+		}(e)
+	}
+	wg.Wait()
+}
+
+// ranked returns endpoints ordered from the best score to the worst.
+func (c *Client) ranked() []*endpoint {
+	ranked := make([]*endpoint, len(c.endpoints))
+	copy(ranked, c.endpoints)
+	scores := make(map[*endpoint]float64, len(ranked))
+	for _, e := range ranked {
+		scores[e] = e.score()
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return scores[ranked[i]] < scores[ranked[j]]
+	})
+	return ranked
+}
+
+// do runs the idempotent call on the endpoints until it succeeds
+// or the retries are exhausted.
+func (c *Client) do(ctx context.Context, method string, call func(*ethclient.Client) error) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "rpc "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "jsonrpc"),
+			attribute.String("rpc.method", method),
+			attribute.String("chain.id", c.chainID),
+		))
+	defer func(start time.Time) {
+		result := metrics.ResultSuccess
+		if isTransportError(err) {
+			result = metrics.ResultFailure
+			tracing.RecordError(span, err)
+		}
+		metrics.RPCDuration.WithLabelValues(c.chainID, method, result).Observe(time.Since(start).Seconds())
+		span.End()
+	}(time.Now())
+
+	var lastErr error
+	ranked := c.ranked()
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if attempt >= len(ranked) {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(c.retryBackoff):
+			}
+		}
+		e := ranked[attempt%len(ranked)]
+		span.AddEvent("attempt", trace.WithAttributes(
+			attribute.Int("attempt", attempt),
+			attribute.String("url", RedactURL(e.url))))
+
+		start := time.Now()
+		err := call(e.client)
+		latency := time.Since(start)
+		switch {
+		case !isTransportError(err):
+			e.observe(latency, nil)
+			return err
+		case ctx.Err() != nil:
+			return RedactError(err, e.url)
+		}
+		err = RedactError(err, e.url)
+		e.observe(latency, err)
+		lastErr = err
+		logger.WithContext(ctx).WithError(err).Debug("rpc call failed, trying next endpoint",
+			slog.String("chainID", c.chainID),
+			slog.String("url", RedactURL(e.url)))
+	}
+	return lastErr
+}
+
+// isTransportError reports whether the error is caused by the endpoint rather
+// than by the request. JSON-RPC errors, like reverted calls, are valid answers
+// and are not retried.
+func isTransportError(err error) bool {
+	if err == nil || errors.Is(err, ethereum.NotFound) {
+		return false
+	}
+	var rpcErr gethrpc.Error
+	return !errors.As(err, &rpcErr)
+}
+
+// IsRevert reports whether the contract call was reverted, e.g. by a require
+// of the contract, rather than failed to reach the chain.
+func IsRevert(err error) bool {
+	var rpcErr gethrpc.Error
+	return errors.As(err, &rpcErr) && strings.Contains(rpcErr.Error(), "execution reverted")
+}
+
+func (c *Client) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) (code []byte, err error) {
+	err = c.do(ctx, "eth_getCode", func(client *ethclient.Client) error {
+		code, err = client.CodeAt(ctx, contract, blockNumber)
+		return err
+	})
+	return code, err
+}
+
+func (c *Client) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) (result []byte, err error) {
+	err = c.do(ctx, "eth_call", func(client *ethclient.Client) error {
+		result, err = client.CallContract(ctx, call, blockNumber)
+		return err
+	})
+	return result, err
+}
+
+func (c *Client) BlockNumber(ctx context.Context) (block uint64, err error) {
+	err = c.do(ctx, "eth_blockNumber", func(client *ethclient.Client) error {
+		block, err = client.BlockNumber(ctx)
+		return err
+	})
+	return block, err
+}
+
+func (c *Client) HeaderByNumber(ctx context.Context, number *big.Int) (header *types.Header, err error) {
+	err = c.do(ctx, "eth_getBlockByNumber", func(client *ethclient.Client) error {
+		header, err = client.HeaderByNumber(ctx, number)
+		return err
+	})
+	return header, err
+}
+
+// CheckFreshness checks that the latest block is at most maxBlockAge old,
+// so that the endpoints are not stuck behind the chain. A zero maxBlockAge
+// checks only that the latest block is served, e.g. for the chains that
+// mine on demand.
+func (c *Client) CheckFreshness(ctx context.Context, maxBlockAge time.Duration) error {
+	header, err := c.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if maxBlockAge <= 0 {
+		return nil
+	}
+	//nolint:gosec // block timestamps fit int64
+	age := time.Since(time.Unix(int64(header.Time), 0))
+	if age > maxBlockAge {
+		return errors.Errorf("latest block %s is %s old, max age is %s",
+			header.Number, age.Round(time.Second), maxBlockAge)
+	}
+	return nil
+}
+
+func (c *Client) FilterLogs(ctx context.Context, q ethereum.FilterQuery) (logs []types.Log, err error) {
+	err = c.do(ctx, "eth_getLogs", func(client *ethclient.Client) error {
+		logs, err = client.FilterLogs(ctx, q)
+		return err
+	})
+	return logs, err
+}
+
+func (c *Client) TransactionByHash(ctx context.Context, hash common.Hash) (tx *types.Transaction, isPending bool, err error) {
+	err = c.do(ctx, "eth_getTransactionByHash", func(client *ethclient.Client) error {
+		tx, isPending, err = client.TransactionByHash(ctx, hash)
+		return err
+	})
+	return tx, isPending, err
+}
+
+// RedactURL removes the path, query and credentials from the url,
+// since rpc providers usually keep api keys there.
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "[REDACTED]"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string { return e.msg }
+
+func (e *redactedError) Unwrap() error { return e.err }
+
+// RedactError hides the url in the error message, since go-ethereum
+// puts the full url, with the api keys, in the transport errors.
+func RedactError(err error, rawURL string) error {
+	if err == nil || rawURL == "" || !strings.Contains(err.Error(), rawURL) {
+		return err
+	}
+	return &redactedError{
+		err: err,
+		msg: strings.ReplaceAll(err.Error(), rawURL, RedactURL(rawURL)),
+	}
+}
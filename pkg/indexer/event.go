@@ -0,0 +1,168 @@
+package indexer
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/iden3/go-service-template/pkg/contracts/onchainissuer"
+	"github.com/pkg/errors"
+)
+
+type EventType string
+
+const (
+	EventOwnershipTransferred EventType = "OwnershipTransferred"
+	EventInitialized          EventType = "Initialized"
+	EventStateUpdated         EventType = "StateUpdated"
+	EventCredentialIssued     EventType = "CredentialIssued"
+	EventCredentialRevoked    EventType = "CredentialRevoked"
+)
+
+// Event is an indexed event related to an issuer contract.
+type Event struct {
+	Type        EventType         `json:"type"`
+	BlockNumber uint64            `json:"blockNumber"`
+	BlockHash   string            `json:"blockHash"`
+	TxHash      string            `json:"txHash"`
+	LogIndex    uint              `json:"logIndex"`
+	Contract    string            `json:"contract"`
+	Data        map[string]string `json:"data"`
+}
+
+// stateEventsABI describes the State contract events that
+// are not part of the published State contract bindings.
+const stateEventsABI = `[{
+	"anonymous": false,
+	"inputs": [
+		{"indexed": false, "internalType": "uint256", "name": "id", "type": "uint256"},
+		{"indexed": false, "internalType": "uint256", "name": "blockN", "type": "uint256"},
+		{"indexed": false, "internalType": "uint256", "name": "timestamp", "type": "uint256"},
+		{"indexed": false, "internalType": "uint256", "name": "state", "type": "uint256"}
+	],
+	"name": "StateUpdated",
+	"type": "event"
+}]`
+
+var stateABI = mustParseABI(stateEventsABI)
+
+func mustParseABI(s string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(s))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+var (
+	ownershipTransferredEvent = onchainissuer.ABI.Events["OwnershipTransferred"]
+	initializedEvent          = onchainissuer.ABI.Events["Initialized"]
+	stateUpdatedEvent         = stateABI.Events["StateUpdated"]
+
+	issueCredentialMethod = onchainissuer.ABI.Methods["issueCredential"]
+	revokeClaimMethod     = onchainissuer.ABI.Methods["revokeClaimAndTransit"]
+)
+
+func newEvent(t EventType, l *types.Log) Event {
+	return Event{
+		Type:        t,
+		BlockNumber: l.BlockNumber,
+		BlockHash:   l.BlockHash.Hex(),
+		TxHash:      l.TxHash.Hex(),
+		LogIndex:    l.Index,
+		Contract:    l.Address.Hex(),
+		Data:        map[string]string{},
+	}
+}
+
+func decodeOwnershipTransferred(l *types.Log) (Event, error) {
+	if len(l.Topics) != 3 {
+		return Event{}, errors.Errorf("unexpected topics count for OwnershipTransferred: %d", len(l.Topics))
+	}
+	e := newEvent(EventOwnershipTransferred, l)
+	e.Data["previousOwner"] = common.BytesToAddress(l.Topics[1].Bytes()).Hex()
+	e.Data["newOwner"] = common.BytesToAddress(l.Topics[2].Bytes()).Hex()
+	return e, nil
+}
+
+func decodeInitialized(l *types.Log) (Event, error) {
+	values, err := initializedEvent.Inputs.Unpack(l.Data)
+	if err != nil {
+		return Event{}, errors.Wrap(err, "failed to unpack Initialized event")
+	}
+	e := newEvent(EventInitialized, l)
+	if len(values) == 1 {
+		if v, ok := values[0].(uint8); ok {
+			e.Data["version"] = strconv.Itoa(int(v))
+		}
+	}
+	return e, nil
+}
+
+// decodeStateUpdated returns the event and the identity ID the state belongs to.
+func decodeStateUpdated(l *types.Log) (Event, *big.Int, error) {
+	values, err := stateUpdatedEvent.Inputs.Unpack(l.Data)
+	if err != nil {
+		return Event{}, nil, errors.Wrap(err, "failed to unpack StateUpdated event")
+	}
+	if len(values) != 4 {
+		return Event{}, nil, errors.Errorf("unexpected StateUpdated values count: %d", len(values))
+	}
+	id, _ := values[0].(*big.Int)
+	blockN, _ := values[1].(*big.Int)
+	timestamp, _ := values[2].(*big.Int)
+	state, _ := values[3].(*big.Int)
+	if id == nil || blockN == nil || timestamp == nil || state == nil {
+		return Event{}, nil, errors.New("unexpected StateUpdated values types")
+	}
+
+	e := newEvent(EventStateUpdated, l)
+	e.Data["id"] = id.String()
+	e.Data["blockN"] = blockN.String()
+	e.Data["timestamp"] = timestamp.String()
+	e.Data["state"] = state.String()
+	return e, id, nil
+}
+
+// decodeCredentialCall derives a credential event from the transaction
+// that caused an issuer state transition. It returns false when the
+// transaction is not a credential issuance or revocation call.
+func decodeCredentialCall(stateEvent Event, tx *types.Transaction, contract common.Address) (Event, bool) {
+	if tx.To() == nil || *tx.To() != contract || len(tx.Data()) < 4 {
+		return Event{}, false
+	}
+
+	selector, args := tx.Data()[:4], tx.Data()[4:]
+	e := stateEvent
+	e.Data = map[string]string{"state": stateEvent.Data["state"]}
+	switch {
+	case string(selector) == string(issueCredentialMethod.ID):
+		values, err := issueCredentialMethod.Inputs.Unpack(args)
+		if err != nil || len(values) != 1 {
+			return Event{}, false
+		}
+		userID, ok := values[0].(*big.Int)
+		if !ok {
+			return Event{}, false
+		}
+		e.Type = EventCredentialIssued
+		e.Data["userId"] = userID.String()
+	case string(selector) == string(revokeClaimMethod.ID):
+		values, err := revokeClaimMethod.Inputs.Unpack(args)
+		if err != nil || len(values) != 1 {
+			return Event{}, false
+		}
+		nonce, ok := values[0].(uint64)
+		if !ok {
+			return Event{}, false
+		}
+		e.Type = EventCredentialRevoked
+		e.Data["revocationNonce"] = strconv.FormatUint(nonce, 10)
+	default:
+		return Event{}, false
+	}
+	return e, true
+}
@@ -0,0 +1,399 @@
+package indexer
+
+import (
+	"context"
+	"log/slog"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/iden3/go-service-template/pkg/metrics"
+	"github.com/pkg/errors"
+)
+
+// Backend is the subset of the ethereum client used by the indexer.
+type Backend interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
+	TransactionByHash(ctx context.Context, hash common.Hash) (tx *types.Transaction, isPending bool, err error)
+}
+
+// Target is an issuer contract to index.
+type Target struct {
+	IssuerDID     string
+	IssuerID      *big.Int
+	Contract      common.Address
+	StateContract common.Address
+	StartBlock    uint64
+	Backend       Backend
+}
+
+type Indexer struct {
+	store        Store
+	targets      []Target
+	pollInterval time.Duration
+	batchSize    uint64
+	reorgDepth   int
+	onState      func(id *big.Int)
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type Option func(*Indexer)
+
+func WithPollInterval(interval time.Duration) Option {
+	return func(i *Indexer) {
+		i.pollInterval = interval
+	}
+}
+
+func WithBatchSize(size uint64) Option {
+	return func(i *Indexer) {
+		i.batchSize = size
+	}
+}
+
+// WithReorgDepth sets how many processed blocks are remembered to find
+// the common ancestor after a chain reorganization.
+func WithReorgDepth(depth int) Option {
+	return func(i *Indexer) {
+		i.reorgDepth = depth
+	}
+}
+
+// WithStateUpdateHook sets the function called for every
+// indexed issuer state transition.
+func WithStateUpdateHook(hook func(id *big.Int)) Option {
+	return func(i *Indexer) {
+		i.onState = hook
+	}
+}
+
+func New(store Store, targets []Target, opts ...Option) *Indexer {
+	i := &Indexer{
+		store:        store,
+		targets:      targets,
+		pollInterval: 15 * time.Second,
+		batchSize:    2000,
+		reorgDepth:   64,
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
+}
+
+// Start runs one indexing loop per target until Shutdown is called.
+func (i *Indexer) Start() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.start()
+}
+
+func (i *Indexer) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	i.cancel = cancel
+	for _, t := range i.targets {
+		i.wg.Add(1)
+		go func(t Target) {
+			defer i.wg.Done()
+			i.run(ctx, t)
+		}(t)
+	}
+}
+
+// Reload replaces the targets. A started indexer stops the loops of the
+// previous targets and resumes from the stored checkpoints.
+func (i *Indexer) Reload(ctx context.Context, targets []Target) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	running := i.cancel != nil
+	if running {
+		if err := i.stop(ctx); err != nil {
+			return err
+		}
+	}
+	i.targets = targets
+	if running {
+		i.start()
+	}
+	return nil
+}
+
+func (i *Indexer) Shutdown(ctx context.Context) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.stop(ctx)
+}
+
+func (i *Indexer) stop(ctx context.Context) error {
+	if i.cancel == nil {
+		return nil
+	}
+	i.cancel()
+	i.cancel = nil
+	done := make(chan struct{})
+	go func() {
+		i.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (i *Indexer) run(ctx context.Context, t Target) {
+	logger.Info("indexer started",
+		slog.String("issuer", t.IssuerDID),
+		slog.Uint64("startBlock", t.StartBlock))
+	for {
+		more, err := i.Sync(ctx, t)
+		if err != nil && ctx.Err() == nil {
+			logger.WithError(err).Error("indexer sync failed", slog.String("issuer", t.IssuerDID))
+		}
+		// the next batch is synced at once until the head is reached
+		if !more || err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(i.pollInterval):
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+	}
+}
+
+// Sync processes the next batch of blocks for the target.
+// It returns true when more blocks are left up to the chain head.
+func (i *Indexer) Sync(ctx context.Context, t Target) (bool, error) {
+	cp, found, err := i.store.Checkpoint(ctx, t.IssuerDID)
+	if err != nil {
+		return false, err
+	}
+	from := t.StartBlock
+	if found {
+		if cp, err = i.handleReorg(ctx, t, cp); err != nil {
+			return false, err
+		}
+		from = cp.Block + 1
+	}
+
+	head, err := t.Backend.BlockNumber(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get head block")
+	}
+	if from > head {
+		return false, nil
+	}
+	to := from + i.batchSize - 1
+	if to > head {
+		to = head
+	}
+
+	// the header is fetched before the logs, so that a reorg that happens
+	// in between is detected on the next sync.
+	header, err := t.Backend.HeaderByNumber(ctx, new(big.Int).SetUint64(to))
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to get header %d", to)
+	}
+
+	events, err := i.fetchEvents(ctx, t, from, to)
+	if err != nil {
+		return false, err
+	}
+
+	cp.Block = to
+	cp.Recent = append(cp.Recent, BlockRef{
+		Number: to,
+		Hash:   header.Hash().Hex(),
+		Parent: header.ParentHash.Hex(),
+	})
+	if len(cp.Recent) > i.reorgDepth {
+		cp.Recent = cp.Recent[len(cp.Recent)-i.reorgDepth:]
+	}
+	if err := i.store.Save(ctx, t.IssuerDID, events, cp); err != nil {
+		return false, err
+	}
+	for _, e := range events {
+		metrics.IssuerEvents.WithLabelValues(t.IssuerDID, string(e.Type)).Inc()
+		if i.onState != nil && e.Type == EventStateUpdated {
+			i.onState(t.IssuerID)
+		}
+	}
+	if len(events) > 0 {
+		logger.Debug("indexer saved events",
+			slog.String("issuer", t.IssuerDID),
+			slog.Int("count", len(events)),
+			slog.Uint64("toBlock", to))
+	}
+	return to < head, nil
+}
+
+// handleReorg rolls back the checkpoint to the latest block that
+// is still part of the canonical chain.
+func (i *Indexer) handleReorg(ctx context.Context, t Target, cp Checkpoint) (Checkpoint, error) {
+	for n := len(cp.Recent) - 1; n >= 0; n-- {
+		ref := cp.Recent[n]
+		ok, err := isCanonical(ctx, t.Backend, ref.Number, ref.Hash)
+		if err != nil {
+			return cp, err
+		}
+		if ok {
+			if n == len(cp.Recent)-1 {
+				return cp, nil
+			}
+			return i.rollback(ctx, t, ref.Number)
+		}
+	}
+	if len(cp.Recent) == 0 {
+		return cp, nil
+	}
+
+	// the reorg is deeper than the remembered blocks
+	ancestor, err := i.findAncestor(ctx, t, cp.Recent[0])
+	if err != nil {
+		return cp, err
+	}
+	logger.Warn("chain reorganization is deeper than the indexer reorg depth",
+		slog.String("issuer", t.IssuerDID),
+		slog.Uint64("rollbackTo", ancestor))
+	return i.rollback(ctx, t, ancestor)
+}
+
+// findAncestor walks back from the oldest remembered block to a block
+// that is still part of the canonical chain: the parent of the oldest
+// block, then the blocks of the stored events. The indexing restarts
+// from the start block when none of them is.
+func (i *Indexer) findAncestor(ctx context.Context, t Target, oldest BlockRef) (uint64, error) {
+	if oldest.Number > t.StartBlock && oldest.Parent != "" {
+		ok, err := isCanonical(ctx, t.Backend, oldest.Number-1, oldest.Parent)
+		if err != nil || ok {
+			return oldest.Number - 1, err
+		}
+	}
+
+	_, total, err := i.store.Events(ctx, t.IssuerDID, 0, 0)
+	if err != nil {
+		return 0, err
+	}
+	const pageSize = 100
+	checked := make(map[uint64]bool)
+	for end := total; end > 0; end -= pageSize {
+		offset := end - pageSize
+		if offset < 0 {
+			offset = 0
+		}
+		events, _, err := i.store.Events(ctx, t.IssuerDID, offset, end-offset)
+		if err != nil {
+			return 0, err
+		}
+		for n := len(events) - 1; n >= 0; n-- {
+			e := events[n]
+			if e.BlockNumber >= oldest.Number || checked[e.BlockNumber] {
+				continue
+			}
+			checked[e.BlockNumber] = true
+			ok, err := isCanonical(ctx, t.Backend, e.BlockNumber, e.BlockHash)
+			if err != nil || ok {
+				return e.BlockNumber, err
+			}
+		}
+	}
+
+	if t.StartBlock > 0 {
+		return t.StartBlock - 1, nil
+	}
+	return 0, nil
+}
+
+func isCanonical(ctx context.Context, backend Backend, number uint64, hash string) (bool, error) {
+	header, err := backend.HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to get header %d", number)
+	}
+	return header.Hash().Hex() == hash, nil
+}
+
+func (i *Indexer) rollback(ctx context.Context, t Target, block uint64) (Checkpoint, error) {
+	logger.Warn("chain reorganization detected",
+		slog.String("issuer", t.IssuerDID),
+		slog.Uint64("rollbackTo", block))
+	if err := i.store.Rollback(ctx, t.IssuerDID, block); err != nil {
+		return Checkpoint{}, err
+	}
+	cp, _, err := i.store.Checkpoint(ctx, t.IssuerDID)
+	return cp, err
+}
+
+func (i *Indexer) fetchEvents(ctx context.Context, t Target, from, to uint64) ([]Event, error) {
+	logs, err := t.Backend.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(from),
+		ToBlock:   new(big.Int).SetUint64(to),
+		Addresses: []common.Address{t.Contract, t.StateContract},
+		Topics: [][]common.Hash{{
+			ownershipTransferredEvent.ID,
+			initializedEvent.ID,
+			stateUpdatedEvent.ID,
+		}},
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to filter logs in blocks %d-%d", from, to)
+	}
+
+	var events []Event
+	for idx := range logs {
+		l := &logs[idx]
+		if l.Removed || len(l.Topics) == 0 {
+			continue
+		}
+		switch {
+		case l.Address == t.Contract && l.Topics[0] == ownershipTransferredEvent.ID:
+			e, err := decodeOwnershipTransferred(l)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, e)
+		case l.Address == t.Contract && l.Topics[0] == initializedEvent.ID:
+			e, err := decodeInitialized(l)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, e)
+		case l.Address == t.StateContract && l.Topics[0] == stateUpdatedEvent.ID:
+			e, id, err := decodeStateUpdated(l)
+			if err != nil {
+				return nil, err
+			}
+			// the id of StateUpdated is not an indexed parameter of the State
+			// contract, so the logs can't be narrowed to the issuer by topic
+			if id.Cmp(t.IssuerID) != 0 {
+				continue
+			}
+			events = append(events, e)
+
+			tx, _, err := t.Backend.TransactionByHash(ctx, l.TxHash)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get transaction %s", l.TxHash.Hex())
+			}
+			if credentialEvent, ok := decodeCredentialCall(e, tx, t.Contract); ok {
+				events = append(events, credentialEvent)
+			}
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,310 @@
+package indexer_test
+
+import (
+	"context"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/iden3/go-service-template/pkg/indexer"
+	"github.com/iden3/go-service-template/pkg/logger"
+)
+
+var (
+	contract      = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	stateContract = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	ownershipID   = crypto.Keccak256Hash([]byte("OwnershipTransferred(address,address)"))
+)
+
+func TestMain(m *testing.M) {
+	if err := logger.SetDefaultLogger(logger.EnvDevelopment, slog.LevelError); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+type fakeChain struct {
+	head uint64
+	// fork changes the hashes of all blocks starting from forkBlock
+	fork      string
+	forkBlock uint64
+	logs      []types.Log
+}
+
+func (c *fakeChain) BlockNumber(_ context.Context) (uint64, error) {
+	return c.head, nil
+}
+
+func (c *fakeChain) HeaderByNumber(_ context.Context, number *big.Int) (*types.Header, error) {
+	return c.header(number.Uint64()), nil
+}
+
+func (c *fakeChain) header(number uint64) *types.Header {
+	h := &types.Header{Number: new(big.Int).SetUint64(number), Difficulty: big.NewInt(0)}
+	if number > 0 {
+		h.ParentHash = c.header(number - 1).Hash()
+	}
+	if number >= c.forkBlock {
+		h.Extra = []byte(c.fork)
+	}
+	return h
+}
+
+func (c *fakeChain) FilterLogs(_ context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	var logs []types.Log
+	for _, l := range c.logs {
+		if l.BlockNumber >= q.FromBlock.Uint64() && l.BlockNumber <= q.ToBlock.Uint64() {
+			logs = append(logs, l)
+		}
+	}
+	return logs, nil
+}
+
+func (c *fakeChain) TransactionByHash(_ context.Context, _ common.Hash) (*types.Transaction, bool, error) {
+	return nil, false, ethereum.NotFound
+}
+
+func (c *fakeChain) ownershipLog(block uint64) types.Log {
+	l := ownershipLog(block)
+	l.BlockHash = c.header(block).Hash()
+	return l
+}
+
+func ownershipLog(block uint64) types.Log {
+	return types.Log{
+		Address: contract,
+		Topics: []common.Hash{
+			ownershipID,
+			common.BytesToHash(common.HexToAddress("0x01").Bytes()),
+			common.BytesToHash(common.HexToAddress("0x02").Bytes()),
+		},
+		BlockNumber: block,
+	}
+}
+
+func syncAll(t *testing.T, i *indexer.Indexer, target indexer.Target) {
+	t.Helper()
+	for {
+		more, err := i.Sync(context.Background(), target)
+		if err != nil {
+			t.Fatalf("sync failed: %v", err)
+		}
+		if !more {
+			return
+		}
+	}
+}
+
+func TestSyncResumesFromCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	chain := &fakeChain{head: 10, logs: []types.Log{ownershipLog(3), ownershipLog(8)}}
+	target := indexer.Target{
+		IssuerDID:     "did:iden3:test",
+		IssuerID:      big.NewInt(1),
+		Contract:      contract,
+		StateContract: stateContract,
+		StartBlock:    1,
+		Backend:       chain,
+	}
+
+	store, err := indexer.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncAll(t, indexer.New(store, []indexer.Target{target}, indexer.WithBatchSize(4)), target)
+
+	chain.head = 12
+	chain.logs = append(chain.logs, ownershipLog(12))
+
+	// a new store reads the persisted checkpoint
+	restored, err := indexer.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncAll(t, indexer.New(restored, []indexer.Target{target}, indexer.WithBatchSize(4)), target)
+
+	events, total, err := restored.Events(context.Background(), target.IssuerDID, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 {
+		t.Fatalf("expected 3 events, got %d", total)
+	}
+	if events[0].Type != indexer.EventOwnershipTransferred ||
+		events[0].Data["newOwner"] != common.HexToAddress("0x02").Hex() {
+		t.Fatalf("unexpected event: %+v", events[0])
+	}
+}
+
+func TestSyncRollsBackReorganizedBlocks(t *testing.T) {
+	chain := &fakeChain{head: 10, logs: []types.Log{ownershipLog(3), ownershipLog(9)}}
+	target := indexer.Target{
+		IssuerDID:     "did:iden3:test",
+		IssuerID:      big.NewInt(1),
+		Contract:      contract,
+		StateContract: stateContract,
+		Backend:       chain,
+	}
+	store, err := indexer.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := indexer.New(store, []indexer.Target{target}, indexer.WithBatchSize(2))
+	syncAll(t, i, target)
+
+	// blocks from 7 were replaced and the log from block 9 is gone
+	chain.fork = "fork"
+	chain.forkBlock = 7
+	chain.logs = []types.Log{ownershipLog(3)}
+	syncAll(t, i, target)
+
+	_, total, err := store.Events(context.Background(), target.IssuerDID, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 {
+		t.Fatalf("expected 1 event after reorg, got %d", total)
+	}
+	cp, _, err := store.Checkpoint(context.Background(), target.IssuerDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Block != 10 {
+		t.Fatalf("expected checkpoint at block 10, got %d", cp.Block)
+	}
+}
+
+func TestSyncWalksBackDeepReorganization(t *testing.T) {
+	chain := &fakeChain{head: 10}
+	chain.logs = []types.Log{chain.ownershipLog(3), chain.ownershipLog(5), chain.ownershipLog(9)}
+	target := indexer.Target{
+		IssuerDID:     "did:iden3:test",
+		IssuerID:      big.NewInt(1),
+		Contract:      contract,
+		StateContract: stateContract,
+		Backend:       chain,
+	}
+	store, err := indexer.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only blocks 8 and 10 are remembered
+	i := indexer.New(store, []indexer.Target{target}, indexer.WithBatchSize(2), indexer.WithReorgDepth(2))
+	syncAll(t, i, target)
+
+	// blocks from 4 were replaced, below the parent of block 8, so the
+	// indexer walks back to the event of block 3
+	chain.fork = "fork"
+	chain.forkBlock = 4
+	chain.logs = []types.Log{chain.ownershipLog(3), chain.ownershipLog(6)}
+	syncAll(t, i, target)
+
+	events, total, err := store.Events(context.Background(), target.IssuerDID, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || events[0].BlockNumber != 3 || events[1].BlockNumber != 6 {
+		t.Fatalf("unexpected events after reorg: %+v", events)
+	}
+}
+
+func TestFileStoreDropsUnsavedEvents(t *testing.T) {
+	dir := t.TempDir()
+	store, err := indexer.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	saved := []indexer.Event{{Type: indexer.EventInitialized, BlockNumber: 2}}
+	if err := store.Save(ctx, "did:iden3:test", saved, indexer.Checkpoint{Block: 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a batch above the checkpoint and an append cut by a crash
+	f, err := os.OpenFile(filepath.Join(dir, "did_iden3_test.events.jsonl"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"type":"Initialized","blockNumber":6}` + "\n" + `{"type":"Init`); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := indexer.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, total, err := restored.Events(ctx, "did:iden3:test", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || events[0].BlockNumber != 2 {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+
+	// the next batch is appended after the saved events
+	next := []indexer.Event{{Type: indexer.EventInitialized, BlockNumber: 5}}
+	if err := restored.Save(ctx, "did:iden3:test", next, indexer.Checkpoint{Block: 5}); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := indexer.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, total, err := reopened.Events(ctx, "did:iden3:test", 0, 10); err != nil || total != 2 {
+		t.Fatalf("expected 2 events, got %d: %v", total, err)
+	}
+}
+
+func TestFileStoreRetriesBatchAfterFailedCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	store, err := indexer.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	first := []indexer.Event{{Type: indexer.EventInitialized, BlockNumber: 2}}
+	if err := store.Save(ctx, "did:iden3:test", first, indexer.Checkpoint{Block: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a directory in place of the checkpoint fails its write after the append
+	checkpoint := filepath.Join(dir, "did_iden3_test.checkpoint.json")
+	if err := os.Remove(checkpoint); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(checkpoint, "blocked"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	next := []indexer.Event{{Type: indexer.EventInitialized, BlockNumber: 4, TxHash: "0x4"}}
+	if err := store.Save(ctx, "did:iden3:test", next, indexer.Checkpoint{Block: 4}); err == nil {
+		t.Fatal("expected the checkpoint write to fail")
+	}
+	if err := os.RemoveAll(checkpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	// the retried batch replaces the events appended by the failed one
+	if err := store.Save(ctx, "did:iden3:test", next, indexer.Checkpoint{Block: 4}); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := indexer.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, total, err := reopened.Events(ctx, "did:iden3:test", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || events[0].BlockNumber != 2 || events[1].TxHash != "0x4" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
@@ -0,0 +1,327 @@
+package indexer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// BlockRef is a processed block used to detect chain reorganizations.
+type BlockRef struct {
+	Number uint64 `json:"number"`
+	Hash   string `json:"hash"`
+	// Parent is the hash of the previous block, to check the block
+	// below the remembered ones after a deep reorganization.
+	Parent string `json:"parent,omitempty"`
+}
+
+// Checkpoint is the indexing progress for an issuer.
+type Checkpoint struct {
+	// Block is the last processed block.
+	Block uint64 `json:"block"`
+	// Recent is the list of latest processed blocks, ordered by number.
+	Recent []BlockRef `json:"recent"`
+}
+
+type Store interface {
+	// Checkpoint returns the checkpoint of the issuer, or false if
+	// the issuer was never indexed.
+	Checkpoint(ctx context.Context, issuerDID string) (Checkpoint, bool, error)
+	// Save appends events and moves the checkpoint atomically.
+	Save(ctx context.Context, issuerDID string, events []Event, cp Checkpoint) error
+	// Rollback removes events after the block and resets the checkpoint to it.
+	Rollback(ctx context.Context, issuerDID string, block uint64) error
+	// Events returns a page of issuer events and the total events count.
+	Events(ctx context.Context, issuerDID string, offset, limit int) ([]Event, int, error)
+}
+
+type issuerRecord struct {
+	Checkpoint *Checkpoint
+	Events     []Event
+	// Size is the length of the log with the events
+	Size int64
+}
+
+// fileCheckpoint is the checkpoint with the length of the events log
+// it covers. The log is truncated to it, so that the events appended
+// without moving the checkpoint are not kept, or appended twice.
+type fileCheckpoint struct {
+	Checkpoint
+	Size int64 `json:"eventsSize"`
+}
+
+// FileStore keeps indexed events in memory and persists them per issuer
+// to a directory: the events are appended to a log with one JSON event
+// per line, and the checkpoint is replaced in a small JSON file next to it.
+type FileStore struct {
+	dir     string
+	mu      sync.RWMutex
+	records map[string]*issuerRecord
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, errors.Wrapf(err, "failed to create indexer data dir '%s'", dir)
+	}
+	return &FileStore{
+		dir:     dir,
+		records: make(map[string]*issuerRecord),
+	}, nil
+}
+
+func (s *FileStore) Checkpoint(_ context.Context, issuerDID string) (Checkpoint, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, err := s.load(issuerDID)
+	if err != nil {
+		return Checkpoint{}, false, err
+	}
+	if r.Checkpoint == nil {
+		return Checkpoint{}, false, nil
+	}
+	return *r.Checkpoint, true, nil
+}
+
+// Save appends the events to the log before it moves the checkpoint.
+// The events of a batch interrupted in between are past the size of
+// the log in the checkpoint, and are cut by the next append or load.
+func (s *FileStore) Save(_ context.Context, issuerDID string, events []Event, cp Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, err := s.load(issuerDID)
+	if err != nil {
+		return err
+	}
+	size, err := s.appendEvents(issuerDID, r.Size, events)
+	if err != nil {
+		return err
+	}
+	if err := s.writeCheckpoint(issuerDID, fileCheckpoint{Checkpoint: cp, Size: size}); err != nil {
+		return err
+	}
+	s.records[issuerDID] = &issuerRecord{
+		Checkpoint: &cp,
+		Events:     append(r.Events[:len(r.Events):len(r.Events)], events...),
+		Size:       size,
+	}
+	return nil
+}
+
+func (s *FileStore) Rollback(_ context.Context, issuerDID string, block uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, err := s.load(issuerDID)
+	if err != nil {
+		return err
+	}
+
+	events := make([]Event, 0, len(r.Events))
+	for _, e := range r.Events {
+		if e.BlockNumber <= block {
+			events = append(events, e)
+		}
+	}
+	cp := Checkpoint{Block: block}
+	if r.Checkpoint != nil {
+		for _, ref := range r.Checkpoint.Recent {
+			if ref.Number <= block {
+				cp.Recent = append(cp.Recent, ref)
+			}
+		}
+	}
+
+	// the events are ordered by block, so the kept ones start the log
+	content, err := encodeEvents(events)
+	if err != nil {
+		return err
+	}
+	size := int64(len(content))
+	// the checkpoint is moved first, the load cuts the log when the truncate fails
+	if err := s.writeCheckpoint(issuerDID, fileCheckpoint{Checkpoint: cp, Size: size}); err != nil {
+		return err
+	}
+	if err := s.truncateEvents(issuerDID, size); err != nil {
+		return err
+	}
+	s.records[issuerDID] = &issuerRecord{Checkpoint: &cp, Events: events, Size: size}
+	return nil
+}
+
+func (s *FileStore) Events(_ context.Context, issuerDID string, offset, limit int) ([]Event, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, err := s.load(issuerDID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total := len(r.Events)
+	if offset >= total {
+		return []Event{}, total, nil
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	page := make([]Event, end-offset)
+	copy(page, r.Events[offset:end])
+	return page, total, nil
+}
+
+// load must be called with the lock held.
+func (s *FileStore) load(issuerDID string) (*issuerRecord, error) {
+	if r, ok := s.records[issuerDID]; ok {
+		return r, nil
+	}
+
+	r := &issuerRecord{}
+	content, err := os.ReadFile(s.path(issuerDID, checkpointExt))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, errors.Wrapf(err, "failed to read indexer checkpoint for '%s'", issuerDID)
+	default:
+		var cp fileCheckpoint
+		if err := json.Unmarshal(content, &cp); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode indexer checkpoint for '%s'", issuerDID)
+		}
+		r.Checkpoint, r.Size = &cp.Checkpoint, cp.Size
+	}
+
+	// the events past the checkpoint are from a batch that wasn't saved,
+	// the last of them may be cut by a crash in the middle of the append
+	if err := s.truncateEvents(issuerDID, r.Size); err != nil {
+		return nil, err
+	}
+	if r.Events, err = s.readEvents(issuerDID); err != nil {
+		return nil, err
+	}
+	s.records[issuerDID] = r
+	return r, nil
+}
+
+// readEvents reads the log of the issuer.
+func (s *FileStore) readEvents(issuerDID string) ([]Event, error) {
+	f, err := os.Open(s.path(issuerDID, eventsExt))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read indexer events for '%s'", issuerDID)
+	}
+	defer f.Close()
+
+	var events []Event
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var e Event
+		err := dec.Decode(&e)
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode indexer events for '%s'", issuerDID)
+		}
+		events = append(events, e)
+	}
+}
+
+// appendEvents writes the events at the size of the log, over anything
+// appended without moving the checkpoint. It returns the new size.
+func (s *FileStore) appendEvents(issuerDID string, size int64, events []Event) (int64, error) {
+	content, err := encodeEvents(events)
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(s.path(issuerDID, eventsExt), os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to open indexer events")
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return 0, errors.Wrap(err, "failed to truncate indexer events")
+	}
+	if _, err := f.WriteAt(content, size); err != nil {
+		f.Close()
+		return 0, errors.Wrap(err, "failed to append indexer events")
+	}
+	if err := f.Close(); err != nil {
+		return 0, errors.Wrap(err, "failed to append indexer events")
+	}
+	return size + int64(len(content)), nil
+}
+
+// truncateEvents cuts the log to the size, when it is longer.
+func (s *FileStore) truncateEvents(issuerDID string, size int64) error {
+	info, err := os.Stat(s.path(issuerDID, eventsExt))
+	if errors.Is(err, os.ErrNotExist) {
+		if size > 0 {
+			return errors.Errorf("indexer events for '%s' are missing", issuerDID)
+		}
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to read indexer events for '%s'", issuerDID)
+	}
+	if info.Size() < size {
+		return errors.Errorf("indexer events for '%s' are shorter than the checkpoint", issuerDID)
+	}
+	if info.Size() == size {
+		return nil
+	}
+	return errors.Wrapf(os.Truncate(s.path(issuerDID, eventsExt), size),
+		"failed to truncate indexer events for '%s'", issuerDID)
+}
+
+func (s *FileStore) writeCheckpoint(issuerDID string, cp fileCheckpoint) error {
+	content, err := json.Marshal(cp)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode indexer checkpoint")
+	}
+	return s.replace(s.path(issuerDID, checkpointExt), content)
+}
+
+func encodeEvents(events []Event) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return nil, errors.Wrap(err, "failed to encode indexer events")
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// replace writes the file atomically.
+func (s *FileStore) replace(path string, content []byte) error {
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary indexer file")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "failed to write indexer data")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "failed to write indexer data")
+	}
+	return errors.Wrap(os.Rename(tmp.Name(), path), "failed to replace indexer data")
+}
+
+const (
+	checkpointExt = ".checkpoint.json"
+	eventsExt     = ".events.jsonl"
+)
+
+func (s *FileStore) path(issuerDID, ext string) string {
+	return filepath.Join(s.dir, strings.ReplaceAll(issuerDID, ":", "_")+ext)
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type stackTracer interface {
@@ -53,14 +54,20 @@ func (l *logger) Fatal(msg string, attrs ...slog.Attr) {
 }
 
 func (l *logger) WithContext(ctx context.Context) *logger {
-	reqID := middleware.GetReqID(ctx)
-	if reqID == "" {
+	var attrs []any
+	if reqID := middleware.GetReqID(ctx); reqID != "" {
+		attrs = append(attrs, slog.String("request_id", reqID))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		attrs = append(attrs,
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	if len(attrs) == 0 {
 		return l
 	}
-	childlog := l.provider.With(
-		slog.String("request_id", reqID),
-	)
-	return &logger{childlog, ctx}
+	return &logger{l.provider.With(attrs...), ctx}
 }
 
 func (l *logger) WithError(err error) *logger {
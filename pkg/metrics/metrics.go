@@ -0,0 +1,199 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "issuer_demo"
+
+// Verification results. An error is a verification that couldn't run,
+// e.g. the rpc is down, unlike a failure, that rejects the response.
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	ResultError   = "error"
+)
+
+// State cache lookup results.
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests by route pattern, method and status.",
+	}, []string{"route", "method", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of HTTP requests by route pattern and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "rate_limited_total",
+		Help:      "Number of HTTP requests rejected by the rate limit rule.",
+	}, []string{"rule"})
+
+	AuthRequests = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "requests_created_total",
+		Help:      "Number of created authorization requests.",
+	})
+
+	AuthVerifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "verifications_total",
+		Help:      "Number of verified authorization responses by result and failure reason.",
+	}, []string{"result", "reason"})
+
+	RPCDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "call_duration_seconds",
+		Help:      "Duration of the rpc calls by chain, method and result, including the retries.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"chain", "method", "result"})
+
+	StateCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "state_cache",
+		Name:      "lookups_total",
+		Help:      "Number of the resolved state lookups by cache, latest or historic, and result, hit or miss.",
+	}, []string{"cache", "result"})
+
+	IssuerEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "issuer",
+		Name:      "events_total",
+		Help:      "Number of indexed issuer contract events, like issued and revoked credentials.",
+	}, []string{"issuer", "type"})
+)
+
+var sessionCount atomic.Pointer[func() int]
+
+// SetSessionCount sets the function that reports the number of the
+// auth sessions in the cache.
+func SetSessionCount(count func() int) {
+	sessionCount.Store(&count)
+}
+
+// RPCEndpoint is the health of an rpc endpoint of a chain.
+type RPCEndpoint struct {
+	Chain       string
+	URL         string
+	Healthy     bool
+	Latency     time.Duration
+	BlockNumber uint64
+}
+
+var rpcEndpoints atomic.Pointer[func() []RPCEndpoint]
+
+// SetRPCEndpoints sets the function that reports the health
+// of the rpc endpoints of the running clients.
+func SetRPCEndpoints(endpoints func() []RPCEndpoint) {
+	rpcEndpoints.Store(&endpoints)
+}
+
+var (
+	rpcEndpointUp = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "rpc", "endpoint_up"),
+		"Whether the last health check of the rpc endpoint succeeded.",
+		[]string{"chain", "url"}, nil)
+	rpcEndpointLatency = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "rpc", "endpoint_latency_seconds"),
+		"Moving average of the rpc endpoint latency.",
+		[]string{"chain", "url"}, nil)
+	rpcEndpointBlock = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "rpc", "endpoint_block_number"),
+		"Latest block reported by the rpc endpoint.",
+		[]string{"chain", "url"}, nil)
+)
+
+// rpcEndpointsCollector reads the endpoints on every scrape,
+// so that the removed endpoints are not reported after a reload.
+type rpcEndpointsCollector struct{}
+
+func (rpcEndpointsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- rpcEndpointUp
+	ch <- rpcEndpointLatency
+	ch <- rpcEndpointBlock
+}
+
+func (rpcEndpointsCollector) Collect(ch chan<- prometheus.Metric) {
+	endpoints := rpcEndpoints.Load()
+	if endpoints == nil {
+		return
+	}
+	for _, e := range (*endpoints)() {
+		var up float64
+		if e.Healthy {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(rpcEndpointUp, prometheus.GaugeValue, up, e.Chain, e.URL)
+		ch <- prometheus.MustNewConstMetric(rpcEndpointLatency, prometheus.GaugeValue,
+			e.Latency.Seconds(), e.Chain, e.URL)
+		ch <- prometheus.MustNewConstMetric(rpcEndpointBlock, prometheus.GaugeValue,
+			float64(e.BlockNumber), e.Chain, e.URL)
+	}
+}
+
+var registerOnce sync.Once
+
+// Register registers the collectors served by the Handler. Only the first
+// call registers them, so that the tests can call it too.
+func Register() {
+	registerOnce.Do(register)
+}
+
+func register() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		RateLimited,
+		AuthRequests,
+		AuthVerifications,
+		RPCDuration,
+		StateCacheLookups,
+		IssuerEvents,
+		rpcEndpointsCollector{},
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "auth",
+			Name:      "sessions",
+			Help:      "Number of the auth sessions in the cache, pending and authenticated.",
+		}, func() float64 {
+			count := sessionCount.Load()
+			if count == nil {
+				return 0
+			}
+			return float64((*count)())
+		}),
+	)
+}
+
+// Handler serves the metrics in the Prometheus format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
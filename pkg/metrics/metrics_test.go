@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRPCEndpointsCollector(t *testing.T) {
+	// nothing is reported before the clients are set
+	require.Zero(t, testutil.CollectAndCount(rpcEndpointsCollector{}))
+
+	SetRPCEndpoints(func() []RPCEndpoint {
+		return []RPCEndpoint{
+			{Chain: "80002", URL: "https://rpc-a", Healthy: true, Latency: 250 * time.Millisecond, BlockNumber: 100},
+			{Chain: "80002", URL: "https://rpc-b"},
+		}
+	})
+	t.Cleanup(func() { rpcEndpoints.Store(nil) })
+
+	expected := `
+# HELP issuer_demo_rpc_endpoint_up Whether the last health check of the rpc endpoint succeeded.
+# TYPE issuer_demo_rpc_endpoint_up gauge
+issuer_demo_rpc_endpoint_up{chain="80002",url="https://rpc-a"} 1
+issuer_demo_rpc_endpoint_up{chain="80002",url="https://rpc-b"} 0
+# HELP issuer_demo_rpc_endpoint_block_number Latest block reported by the rpc endpoint.
+# TYPE issuer_demo_rpc_endpoint_block_number gauge
+issuer_demo_rpc_endpoint_block_number{chain="80002",url="https://rpc-a"} 100
+issuer_demo_rpc_endpoint_block_number{chain="80002",url="https://rpc-b"} 0
+# HELP issuer_demo_rpc_endpoint_latency_seconds Moving average of the rpc endpoint latency.
+# TYPE issuer_demo_rpc_endpoint_latency_seconds gauge
+issuer_demo_rpc_endpoint_latency_seconds{chain="80002",url="https://rpc-a"} 0.25
+issuer_demo_rpc_endpoint_latency_seconds{chain="80002",url="https://rpc-b"} 0
+`
+	require.NoError(t, testutil.CollectAndCompare(rpcEndpointsCollector{}, strings.NewReader(expected)))
+}
@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/iden3/go-service-template/pkg/metrics"
+	"github.com/iden3/go-service-template/pkg/router/http/problem"
+	"github.com/iden3/go-service-template/pkg/services/authentication"
+)
+
+// KeyFunc returns the client of the request that a rule limits,
+// or an empty string when the rule doesn't apply to the request.
+type KeyFunc func(r *http.Request) string
+
+// Rule limits the requests of every key separately.
+type Rule struct {
+	Name  string
+	Limit Limit
+	Key   KeyFunc
+}
+
+// Limiter rejects the requests over any of the rules
+// with 429 Too Many Requests.
+type Limiter struct {
+	store Store
+	rules []Rule
+}
+
+// New creates the limiter. Rules with a zero rate are disabled.
+func New(store Store, rules ...Rule) *Limiter {
+	l := &Limiter{store: store}
+	for _, rule := range rules {
+		if rule.Limit.Rate > 0 && rule.Limit.Burst > 0 {
+			l.rules = append(l.rules, rule)
+		}
+	}
+	return l
+}
+
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		for _, rule := range l.rules {
+			key := rule.Key(r)
+			if key == "" {
+				continue
+			}
+			allowed, retryAfter, err := l.store.Take(r.Context(), rule.Name+":"+key, rule.Limit)
+			if err != nil {
+				// the service stays available when the shared store is down
+				logger.WithContext(r.Context()).WithError(err).Error("rate limit store failed",
+					slog.String("rule", rule.Name))
+				continue
+			}
+			if allowed {
+				continue
+			}
+
+			metrics.RateLimited.WithLabelValues(rule.Name).Inc()
+			logger.WithContext(r.Context()).Warn("rate limit exceeded",
+				slog.String("rule", rule.Name),
+				slog.String("key", key))
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(retryAfter.Seconds())))))
+			problem.Write(w, r, problem.CodeRateLimited,
+				fmt.Sprintf("too many requests per %s, retry in %s", rule.Name, retryAfter.Round(100*time.Millisecond)))
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// ClientIP is the address of the client. The RealIP middleware has to run
+// before the limiter when the service is behind a proxy.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Query is the value of the query parameter.
+func Query(name string) KeyFunc {
+	return func(r *http.Request) string {
+		return r.URL.Query().Get(name)
+	}
+}
+
+// OnPath applies the key only to the requests of the path.
+func OnPath(path string, key KeyFunc) KeyFunc {
+	return func(r *http.Request) string {
+		if r.URL.Path != path {
+			return ""
+		}
+		return key(r)
+	}
+}
+
+// JWZSender is the DID that the JWZ token in the body claims to be sent from.
+// The claim is not verified yet, the limit prevents one DID from keeping the
+// proof verification busy. At most maxBytes of the body are read, and the
+// body is kept for the handler.
+func JWZSender(maxBytes int64) KeyFunc {
+	return func(r *http.Request) string {
+		if r.Body == nil {
+			return ""
+		}
+		head, err := io.ReadAll(io.LimitReader(r.Body, maxBytes))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+		if err != nil {
+			return ""
+		}
+
+		_, msg, err := authentication.ParseToken(string(head))
+		if err != nil {
+			return ""
+		}
+		return msg.From
+	}
+}
@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/iden3/go-service-template/pkg/router/http/problem"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	if err := logger.SetDefaultLogger(logger.EnvDevelopment, slog.LevelError); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestMemoryStore_TokenBucket(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := Limit{Rate: 0.5, Burst: 2}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		allowed, _, err := store.Take(ctx, "a", limit)
+		require.NoError(t, err)
+		require.True(t, allowed)
+	}
+	allowed, retryAfter, err := store.Take(ctx, "a", limit)
+	require.NoError(t, err)
+	require.False(t, allowed)
+	require.Equal(t, 2*time.Second, retryAfter)
+
+	// other keys have their own buckets
+	allowed, _, err = store.Take(ctx, "b", limit)
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	now = now.Add(2 * time.Second)
+	allowed, _, err = store.Take(ctx, "a", limit)
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	// the full buckets are dropped
+	now = now.Add(time.Hour)
+	_, _, err = store.Take(ctx, "c", limit)
+	require.NoError(t, err)
+	require.Len(t, store.buckets, 1)
+}
+
+func TestRedisStore_TokenBucket(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store, err := NewRedisStore("redis://" + mr.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Shutdown(context.Background()) })
+	limit := Limit{Rate: 0.5, Burst: 2}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		allowed, _, err := store.Take(ctx, "a", limit)
+		require.NoError(t, err)
+		require.True(t, allowed)
+	}
+	allowed, retryAfter, err := store.Take(ctx, "a", limit)
+	require.NoError(t, err)
+	require.False(t, allowed)
+	require.InDelta(t, 2*time.Second, retryAfter, float64(100*time.Millisecond))
+	require.True(t, mr.Exists("ratelimit:a"))
+	require.Greater(t, mr.TTL("ratelimit:a"), time.Duration(0))
+}
+
+func TestLimiter_Middleware(t *testing.T) {
+	var handled int
+	limiter := New(NewMemoryStore(),
+		Rule{Name: "ip", Limit: Limit{Rate: 100, Burst: 100}, Key: ClientIP},
+		Rule{Name: "session", Limit: Limit{Rate: 0.1, Burst: 1}, Key: OnPath("/callback", Query("sessionId"))},
+		Rule{Name: "disabled", Key: ClientIP},
+	)
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handled++
+	}))
+	call := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, http.NoBody)
+		req.RemoteAddr = "10.0.0.1:5000"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	require.Equal(t, http.StatusOK, call("/callback?sessionId=1").Code)
+	require.Equal(t, http.StatusOK, call("/callback?sessionId=2").Code)
+	require.Equal(t, http.StatusOK, call("/status?sessionId=1").Code)
+
+	rec := call("/callback?sessionId=1")
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Equal(t, "10", rec.Header().Get("Retry-After"))
+	var p problem.Problem
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&p))
+	require.Equal(t, problem.CodeRateLimited, p.Code)
+	require.Equal(t, 3, handled)
+}
+
+func TestJWZSender_KeepsBody(t *testing.T) {
+	body := strings.Repeat("x", 100)
+	req := httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader(body))
+	require.Empty(t, JWZSender(10)(req))
+
+	read, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	require.Equal(t, body, string(read))
+}
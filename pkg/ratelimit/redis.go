@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript refills and takes from the bucket atomically, so that
+// all the instances of the service share the limit.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(bucket[1])
+local last = tonumber(bucket[2])
+if tokens == nil or last == nil then
+	tokens = burst
+	last = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - last) / 1000000 * rate)
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = (1 - tokens) / rate
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'last', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, tostring(wait)}
+`)
+
+// RedisStore keeps the buckets in Redis, shared by the instances.
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisStore creates the store from a redis:// or rediss:// url.
+func NewRedisStore(rawURL string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid redis url")
+	}
+	return &RedisStore{
+		client: redis.NewClient(opts),
+		prefix: "ratelimit:",
+	}, nil
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	now := time.Now().UnixMicro()
+	res, err := takeScript.Run(ctx, s.client, []string{s.prefix + key},
+		limit.Rate, limit.Burst, now).Slice()
+	if err != nil {
+		return false, 0, errors.Wrap(err, "failed to take rate limit token")
+	}
+	if len(res) != 2 {
+		return false, 0, errors.Errorf("unexpected rate limit script result %v", res)
+	}
+	allowed, _ := res[0].(int64)
+	waitStr, _ := res[1].(string)
+	wait, err := strconv.ParseFloat(waitStr, 64)
+	if err != nil {
+		return false, 0, errors.Wrap(err, "invalid rate limit wait")
+	}
+	return allowed == 1, time.Duration(wait * float64(time.Second)), nil
+}
+
+// Shutdown closes the connections.
+func (s *RedisStore) Shutdown(_ context.Context) error {
+	return s.client.Close()
+}
@@ -0,0 +1,201 @@
+package reload
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/pkg/errors"
+)
+
+// Func applies the configuration again.
+type Func func(ctx context.Context) error
+
+// Watcher calls the reload function on SIGHUP and
+// when the content of the config file changes.
+type Watcher struct {
+	path     string
+	reload   Func
+	debounce time.Duration
+	timeout  time.Duration
+
+	mu       sync.Mutex
+	lastHash []byte
+
+	signals chan os.Signal
+	fsw     *fsnotify.Watcher
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+type Option func(*Watcher)
+
+// WithDebounce sets how long the file has to stay unchanged before
+// the reload, since editors often write a file in several steps.
+func WithDebounce(d time.Duration) Option {
+	return func(w *Watcher) {
+		w.debounce = d
+	}
+}
+
+// WithTimeout limits the time of a single reload.
+func WithTimeout(timeout time.Duration) Option {
+	return func(w *Watcher) {
+		w.timeout = timeout
+	}
+}
+
+// New creates a watcher. The file is not watched when the path is empty.
+func New(path string, reload Func, opts ...Option) *Watcher {
+	w := &Watcher{
+		path:     path,
+		reload:   reload,
+		debounce: 500 * time.Millisecond,
+		timeout:  time.Minute,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+func (w *Watcher) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+
+	var events <-chan fsnotify.Event
+	if w.path != "" {
+		w.lastHash, _ = w.hash()
+		fsw, err := fsnotify.NewWatcher()
+		if err != nil {
+			cancel()
+			return errors.Wrap(err, "failed to create file watcher")
+		}
+		// the directory is watched, so that files replaced by a rename,
+		// like mounted config maps, are still tracked
+		if err := fsw.Add(filepath.Dir(w.path)); err != nil {
+			cancel()
+			_ = fsw.Close()
+			return errors.Wrapf(err, "failed to watch '%s'", w.path)
+		}
+		w.fsw = fsw
+		events = fsw.Events
+	}
+
+	w.signals = make(chan os.Signal, 1)
+	signal.Notify(w.signals, syscall.SIGHUP)
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.run(ctx, events)
+	}()
+	return nil
+}
+
+func (w *Watcher) run(ctx context.Context, events <-chan fsnotify.Event) {
+	var (
+		timer   *time.Timer
+		changed <-chan time.Time
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-w.signals:
+			logger.Info("reload requested by SIGHUP")
+			_ = w.Reload(ctx)
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.NewTimer(w.debounce)
+			changed = timer.C
+		case <-changed:
+			changed = nil
+			hash, err := w.hash()
+			if err != nil {
+				logger.WithError(err).Warn("failed to read config file", slog.String("path", w.path))
+				continue
+			}
+			w.mu.Lock()
+			same := bytes.Equal(hash, w.lastHash)
+			w.mu.Unlock()
+			if same {
+				continue
+			}
+			logger.Info("config file changed", slog.String("path", w.path))
+			_ = w.Reload(ctx)
+		}
+	}
+}
+
+// Reload calls the reload function. Concurrent calls are serialized.
+// The error is logged and returned, e.g. for the admin reload route.
+func (w *Watcher) Reload(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.path != "" {
+		// a file that fails to apply is not retried until it changes again
+		if hash, err := w.hash(); err == nil {
+			w.lastHash = hash
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+	start := time.Now()
+	if err := w.reload(ctx); err != nil {
+		logger.WithError(err).Error("config reload failed, the previous config is kept")
+		return err
+	}
+	logger.Info("config reloaded", slog.Duration("duration", time.Since(start)))
+	return nil
+}
+
+func (w *Watcher) hash() ([]byte, error) {
+	content, err := os.ReadFile(w.path)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(content)
+	return sum[:], nil
+}
+
+func (w *Watcher) Shutdown(ctx context.Context) error {
+	if w.cancel == nil {
+		return nil
+	}
+	signal.Stop(w.signals)
+	w.cancel()
+	if w.fsw != nil {
+		_ = w.fsw.Close()
+	}
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,62 @@
+package reload
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	if err := logger.SetDefaultLogger(logger.EnvDevelopment, slog.LevelError); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func startWatcher(t *testing.T, path string) *atomic.Int32 {
+	t.Helper()
+	var calls atomic.Int32
+	w := New(path, func(context.Context) error {
+		calls.Add(1)
+		return nil
+	}, WithDebounce(20*time.Millisecond))
+	require.NoError(t, w.Start())
+	t.Cleanup(func() {
+		require.NoError(t, w.Shutdown(context.Background()))
+	})
+	return &calls
+}
+
+func TestWatcher_FileChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("log:\n  level: INFO\n"), 0o600))
+	calls := startWatcher(t, path)
+
+	require.NoError(t, os.WriteFile(path, []byte("log:\n  level: DEBUG\n"), 0o600))
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, 2*time.Second, 10*time.Millisecond)
+
+	// a write with the same content is not a change
+	require.NoError(t, os.WriteFile(path, []byte("log:\n  level: DEBUG\n"), 0o600))
+	time.Sleep(100 * time.Millisecond)
+	require.EqualValues(t, 1, calls.Load())
+
+	// files replaced by a rename are still tracked
+	tmp := filepath.Join(filepath.Dir(path), "config.yaml.tmp")
+	require.NoError(t, os.WriteFile(tmp, []byte("log:\n  level: WARN\n"), 0o600))
+	require.NoError(t, os.Rename(tmp, path))
+	require.Eventually(t, func() bool { return calls.Load() == 2 }, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestWatcher_SIGHUP(t *testing.T) {
+	calls := startWatcher(t, "")
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, 2*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,76 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/iden3/go-service-template/pkg/metrics"
+	"github.com/iden3/go-service-template/pkg/router/http/handlers"
+	"github.com/iden3/go-service-template/pkg/router/http/middleware"
+	"github.com/iden3/go-service-template/pkg/router/http/problem"
+)
+
+// AdminHandlers are the handlers of the internal listener:
+// the probes, the metrics, pprof and the admin routes.
+type AdminHandlers struct {
+	systemHandler handlers.SystemHandler
+	adminHandler  handlers.AdminHandlers
+}
+
+func NewAdminHandlers(
+	systemHandler handlers.SystemHandler,
+	adminHandler handlers.AdminHandlers,
+) AdminHandlers {
+	return AdminHandlers{
+		systemHandler: systemHandler,
+		adminHandler:  adminHandler,
+	}
+}
+
+// AdminClientCertPaths are the prefixes of all the admin routes but the
+// probes, that the kubelet calls without a client certificate.
+var AdminClientCertPaths = []string{"/metrics", "/version", "/debug", "/admin"}
+
+// NewRouter serves the probes without auth. The metrics and the version need
+// the bearer token when it is set. The admin routes and pprof need it, and are
+// off without one.
+func (h *AdminHandlers) NewRouter(token string, opts ...Option) http.Handler {
+	r := chi.NewRouter()
+
+	r.Use(chimiddleware.RequestID)
+	r.Use(middleware.Recoverer)
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, problem.CodeNotFound, "")
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, problem.CodeMethodNotAllowed, "")
+	})
+
+	r.Get("/startup", h.systemHandler.Startup)
+	r.Get("/readiness", h.systemHandler.Readiness)
+	r.Get("/liveness", h.systemHandler.Liveness)
+	r.Group(func(r chi.Router) {
+		if token != "" {
+			r.Use(middleware.BearerToken(token))
+		}
+		r.Method(http.MethodGet, "/metrics", metrics.Handler())
+		r.Get("/version", h.systemHandler.Version)
+	})
+
+	if token == "" {
+		return r
+	}
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequestLog)
+		r.Use(middleware.BearerToken(token))
+		r.Mount("/debug", chimiddleware.Profiler())
+		r.Get("/admin/config", h.adminHandler.Config)
+		r.Post("/admin/reload", h.adminHandler.Reload)
+	})
+	return r
+}
@@ -0,0 +1,186 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/iden3/go-service-template/pkg/router/http/handlers"
+	"github.com/iden3/go-service-template/pkg/router/http/problem"
+	"github.com/iden3/go-service-template/pkg/services/system"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAdminRouter(t *testing.T, token string, opts ...Option) http.Handler {
+	t.Helper()
+	startup := system.NewStartupService()
+	startup.Run(context.Background())
+	return newTestAdminRouterWithStartup(t, token, startup, opts...)
+}
+
+func newTestAdminRouterWithStartup(
+	t *testing.T,
+	token string,
+	startup *system.StartupService,
+	opts ...Option,
+) http.Handler {
+	t.Helper()
+	h := NewAdminHandlers(
+		handlers.NewSystemHandler(
+			system.NewReadinessService(nil),
+			system.NewLivenessService(),
+			startup,
+			system.NewVersionService(system.ReadBuildInfo(), func() system.Deployment {
+				return system.Deployment{Chains: []string{"80002"}, Issuers: []string{testIssuer}}
+			}),
+		),
+		handlers.NewAdminHandlers(
+			func(w io.Writer) error {
+				_, err := io.WriteString(w, "log:\n  level: INFO\n")
+				return err
+			},
+			func(ctx context.Context) error {
+				if ctx.Value(failReload{}) != nil {
+					return errors.New("invalid config")
+				}
+				return nil
+			},
+		),
+	)
+	return h.NewRouter(token, opts...)
+}
+
+type failReload struct{}
+
+func serveAdmin(router http.Handler, method, target, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, http.NoBody)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminRouter_OpenRoutes(t *testing.T) {
+	router := newTestAdminRouter(t, "")
+	for _, target := range []string{"/startup", "/readiness", "/liveness", "/metrics", "/version"} {
+		require.Equal(t, http.StatusOK, serveAdmin(router, http.MethodGet, target, "").Code, target)
+	}
+
+	rec := serveAdmin(router, http.MethodGet, "/readiness", "")
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	require.JSONEq(t, `{"status":"ok","checks":[]}`, rec.Body.String())
+
+	// the privileged routes are off without a token
+	require.Equal(t, http.StatusNotFound, serveAdmin(router, http.MethodGet, "/admin/config", "").Code)
+	require.Equal(t, http.StatusNotFound, serveAdmin(router, http.MethodGet, "/debug/pprof/", "").Code)
+}
+
+func TestAdminRouter_Startup(t *testing.T) {
+	startup := system.NewStartupService()
+	router := newTestAdminRouterWithStartup(t, "", startup)
+	require.Equal(t, http.StatusServiceUnavailable, serveAdmin(router, http.MethodGet, "/startup", "").Code)
+
+	startup.Run(context.Background(), system.WarmUp{
+		Name: "rpc",
+		Run:  func(context.Context) error { return errors.New("connection refused") },
+	})
+	rec := serveAdmin(router, http.MethodGet, "/startup", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var report system.StartupReport
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&report))
+	require.Equal(t, system.StatusStarted, report.Status)
+	require.Equal(t, system.StatusFailed, report.Steps[0].Status)
+	require.Equal(t, "connection refused", report.Steps[0].Error)
+}
+
+func TestAdminRouter_Version(t *testing.T) {
+	rec := serveAdmin(newTestAdminRouter(t, ""), http.MethodGet, "/version", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var version system.Version
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&version))
+	require.Equal(t, "github.com/iden3/go-service-template", version.Build.Module)
+	require.Equal(t, runtime.Version(), version.Build.GoVersion)
+	require.NotEmpty(t, version.Build.Dependencies["github.com/iden3/go-iden3-auth/v2"])
+	require.NotEmpty(t, version.Build.Dependencies["github.com/iden3/iden3comm/v2"])
+	require.Equal(t, []string{"80002"}, version.Deployment.Chains)
+	require.Equal(t, []string{testIssuer}, version.Deployment.Issuers)
+	require.Positive(t, version.Runtime.Goroutines)
+	require.False(t, version.StartedAt.IsZero())
+}
+
+func TestAdminRouter_Token(t *testing.T) {
+	router := newTestAdminRouter(t, "secret")
+
+	for _, token := range []string{"", "wrong"} {
+		rec := serveAdmin(router, http.MethodGet, "/admin/config", token)
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+		require.Equal(t, `Bearer realm="admin"`, rec.Header().Get("WWW-Authenticate"))
+		var p problem.Problem
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&p))
+		require.Equal(t, problem.CodeUnauthorized, p.Code)
+	}
+	for _, target := range []string{"/debug/pprof/", "/metrics", "/version"} {
+		require.Equal(t, http.StatusUnauthorized, serveAdmin(router, http.MethodGet, target, "").Code, target)
+	}
+	require.Equal(t, http.StatusOK, serveAdmin(router, http.MethodGet, "/readiness", "").Code)
+	require.Equal(t, http.StatusOK, serveAdmin(router, http.MethodGet, "/metrics", "secret").Code)
+	require.Equal(t, http.StatusOK, serveAdmin(router, http.MethodGet, "/version", "secret").Code)
+
+	rec := serveAdmin(router, http.MethodGet, "/admin/config", "secret")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/yaml", rec.Header().Get("Content-Type"))
+	require.Equal(t, "log:\n  level: INFO\n", rec.Body.String())
+
+	require.Equal(t, http.StatusOK, serveAdmin(router, http.MethodGet, "/debug/pprof/", "secret").Code)
+	require.Equal(t, http.StatusNoContent, serveAdmin(router, http.MethodPost, "/admin/reload", "secret").Code)
+}
+
+func TestAdminRouter_ReloadFailure(t *testing.T) {
+	router := newTestAdminRouter(t, "secret")
+	req := httptest.NewRequest(http.MethodPost, "/admin/reload", http.NoBody)
+	req = req.WithContext(context.WithValue(req.Context(), failReload{}, true))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	var p problem.Problem
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&p))
+	require.Equal(t, problem.CodeReloadFailed, p.Code)
+	require.Equal(t, "invalid config", p.Detail)
+}
+
+func TestAdminRouter_ClientCert(t *testing.T) {
+	router := newTestAdminRouter(t, "secret", WithClientCertPaths(AdminClientCertPaths...))
+	serve := func(target string, state *tls.ConnectionState) int {
+		req := httptest.NewRequest(http.MethodGet, target, http.NoBody)
+		req.Header.Set("Authorization", "Bearer secret")
+		req.TLS = state
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// the kubelet calls the probes without a client certificate
+	for _, target := range []string{"/startup", "/readiness", "/liveness"} {
+		require.Equal(t, http.StatusOK, serve(target, nil), target)
+	}
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+	for _, target := range []string{"/metrics", "/version", "/debug/pprof/", "/admin/config"} {
+		require.Equal(t, http.StatusForbidden, serve(target, nil), target)
+		require.Equal(t, http.StatusOK, serve(target, verified), target)
+	}
+}
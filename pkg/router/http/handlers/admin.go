@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/iden3/go-service-template/pkg/router/http/problem"
+)
+
+type AdminHandlers struct {
+	dumpConfig func(w io.Writer) error
+	reload     func(ctx context.Context) error
+}
+
+// NewAdminHandlers creates the admin handlers. dumpConfig writes the
+// running config with the secrets redacted as YAML, and reload
+// applies the config file again.
+func NewAdminHandlers(
+	dumpConfig func(w io.Writer) error,
+	reload func(ctx context.Context) error,
+) AdminHandlers {
+	return AdminHandlers{
+		dumpConfig: dumpConfig,
+		reload:     reload,
+	}
+}
+
+func (h *AdminHandlers) Config(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	if err := h.dumpConfig(&buf); err != nil {
+		logger.WithContext(r.Context()).WithError(err).Error("error encoding config")
+		problem.Write(w, r, problem.CodeInternal, "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		logger.WithContext(r.Context()).WithError(err).Error("failed to write response")
+	}
+}
+
+func (h *AdminHandlers) Reload(w http.ResponseWriter, r *http.Request) {
+	if err := h.reload(r.Context()); err != nil {
+		problem.Write(w, r, problem.CodeReloadFailed, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -5,10 +5,15 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
 
 	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/iden3/go-service-template/pkg/router/http/problem"
 	"github.com/iden3/go-service-template/pkg/services/authentication"
+	"github.com/iden3/go-service-template/pkg/stateresolver"
+	"github.com/iden3/iden3comm/v2/packers"
+	"github.com/pkg/errors"
 )
 
 type AuthenticationHandlers struct {
@@ -29,18 +34,28 @@ func NewAuthenticationHandlers(
 func (h *AuthenticationHandlers) CreateAuthenticationRequest(w http.ResponseWriter, r *http.Request) {
 	issuerDIDStr := r.URL.Query().Get("issuer")
 	if issuerDIDStr == "" {
-		logger.Error("issuer is required")
-		w.WriteHeader(http.StatusBadRequest)
+		logger.WithContext(r.Context()).Error("issuer is required")
+		problem.Write(w, r, problem.CodeIssuerRequired, "the issuer query parameter is required")
 		return
 	}
 
 	uri := fmt.Sprintf("%s/api/v1/callback", h.callbackURL)
-	request, sessionID := h.authenticationService.NewAuthenticationRequest(uri, issuerDIDStr)
+	request, sessionID, err := h.authenticationService.NewAuthenticationRequest(uri, issuerDIDStr)
+	if err != nil {
+		logger.WithContext(r.Context()).WithError(err).Error("error creating auth request")
+		if errors.Is(err, authentication.ErrShuttingDown) {
+			problem.Write(w, r, problem.CodeShuttingDown, "")
+		} else {
+			problem.Write(w, r, problem.CodeInternal, "")
+		}
+		return
+	}
 	w.Header().Set("Access-Control-Expose-Headers", "x-id")
 	w.Header().Set("x-id", sessionID)
 	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(request); err != nil {
-		logger.WithError(err).Error("error marshalizing response", slog.Any("request", request))
+		logger.WithContext(r.Context()).WithError(err).Error("error marshalizing response", slog.Any("request", request))
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -48,44 +63,95 @@ func (h *AuthenticationHandlers) CreateAuthenticationRequest(w http.ResponseWrit
 
 func (h *AuthenticationHandlers) Callback(w http.ResponseWriter, r *http.Request) {
 	sessionID := r.URL.Query().Get("sessionId")
+	if sessionID == "" {
+		logger.WithContext(r.Context()).Error("session id is required")
+		problem.Write(w, r, problem.CodeSessionRequired, "the sessionId query parameter is required")
+		return
+	}
+	if !isTokenMediaType(r.Header.Get("Content-Type")) {
+		logger.WithContext(r.Context()).Error("unsupported content type",
+			slog.String("contentType", r.Header.Get("Content-Type")))
+		problem.Write(w, r, problem.CodeMediaType,
+			fmt.Sprintf("the token must be sent as %s or text/plain", packers.MediaTypeZKPMessage))
+		return
+	}
 	tokenBytes, err := io.ReadAll(r.Body)
 	if err != nil {
-		logger.WithError(err).Error("error reading body")
-		w.WriteHeader(http.StatusInternalServerError)
+		logger.WithContext(r.Context()).WithError(err).Error("error reading body")
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			problem.Write(w, r, problem.CodeBodyTooLarge,
+				fmt.Sprintf("the request body must not exceed %d bytes", maxBytesErr.Limit))
+			return
+		}
+		problem.Write(w, r, problem.CodeBodyUnreadable, "")
 		return
 	}
 
 	userID, err := h.authenticationService.Verify(r.Context(), sessionID, tokenBytes)
 	if err != nil {
-		logger.WithError(err).Error("error verifying token", slog.String("sessionID", sessionID))
-		w.WriteHeader(http.StatusInternalServerError)
+		logger.WithContext(r.Context()).WithError(err).Error("error verifying token", slog.String("sessionID", sessionID))
+		switch {
+		case errors.Is(err, authentication.ErrSessionNotFound):
+			problem.Write(w, r, problem.CodeSessionNotFound, "")
+		case errors.Is(err, authentication.ErrSessionUsed):
+			problem.Write(w, r, problem.CodeSessionUsed, "")
+		case errors.Is(err, authentication.ErrSessionExpired):
+			problem.Write(w, r, problem.CodeSessionExpired, err.Error())
+		case errors.Is(err, authentication.ErrThreadIDReused):
+			problem.Write(w, r, problem.CodeThreadIDReused, "")
+		case errors.Is(err, authentication.ErrTokenMalformed):
+			problem.Write(w, r, problem.CodeTokenMalformed, err.Error())
+		case errors.Is(err, authentication.ErrProofInvalid):
+			problem.Write(w, r, problem.CodeProofInvalid, err.Error())
+		case errors.Is(err, stateresolver.ErrUnavailable):
+			problem.Write(w, r, problem.CodeUnavailable, "the state contract can't be reached, try again")
+		default:
+			problem.Write(w, r, problem.CodeInternal, "")
+		}
 		return
 	}
 
 	response := map[string]string{
 		"id": userID,
 	}
+	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		logger.WithError(err).Error("error marshalizing response", slog.Any("response", response))
+		logger.WithContext(r.Context()).WithError(err).Error("error marshalizing response", slog.Any("response", response))
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 }
 
+// isTokenMediaType accepts the JWZ media type of iden3comm,
+// and text/plain for the clients that post the raw token.
+func isTokenMediaType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == string(packers.MediaTypeZKPMessage) || mediaType == "text/plain"
+}
+
 func (h *AuthenticationHandlers) AuthenticationRequestStatus(w http.ResponseWriter, r *http.Request) {
 	sessionID := r.URL.Query().Get("id")
-	userID, err := h.authenticationService.AuthenticationRequestStatus(sessionID)
+	userID, err := h.authenticationService.AuthenticationRequestStatus(r.Context(), sessionID)
 	if err != nil {
-		logger.WithError(err).Error("error getting session", slog.String("sessionID", sessionID))
-		w.WriteHeader(http.StatusNotFound)
+		logger.WithContext(r.Context()).WithError(err).Error("error getting session", slog.String("sessionID", sessionID))
+		if errors.Is(err, authentication.ErrSessionPending) {
+			problem.Write(w, r, problem.CodeSessionPending, "")
+		} else {
+			problem.Write(w, r, problem.CodeSessionNotFound, "")
+		}
 		return
 	}
 
 	response := map[string]string{
 		"id": userID,
 	}
+	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		logger.WithError(err).Error("error marshalizing response", slog.Any("sessionID", sessionID))
+		logger.WithContext(r.Context()).WithError(err).Error("error marshalizing response", slog.Any("sessionID", sessionID))
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
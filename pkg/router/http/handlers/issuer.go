@@ -2,10 +2,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"log/slog"
 	"net/http"
+	"strconv"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/iden3/go-service-template/pkg/router/http/problem"
 	"github.com/iden3/go-service-template/pkg/services/issuer"
+	"github.com/pkg/errors"
 )
 
 type IssuerHandlers struct {
@@ -27,3 +32,125 @@ func (h *IssuerHandlers) GetIssuersList(w http.ResponseWriter, r *http.Request)
 			Error("error marshalizing response")
 	}
 }
+
+func (h *IssuerHandlers) GetIssuer(w http.ResponseWriter, r *http.Request) {
+	issuerDID := chi.URLParam(r, "did")
+	info, err := h.issuerService.GetIssuer(r.Context(), issuerDID)
+	if err != nil {
+		logger.WithContext(r.Context()).WithError(err).
+			Error("error getting issuer", slog.String("issuer", issuerDID))
+		writeIssuerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		logger.WithContext(r.Context()).WithError(err).
+			Error("error marshalizing response")
+	}
+}
+
+func (h *IssuerHandlers) GetIssuerState(w http.ResponseWriter, r *http.Request) {
+	issuerDID := chi.URLParam(r, "did")
+	state, err := h.issuerService.GetIssuerState(r.Context(), issuerDID)
+	if err != nil {
+		logger.WithContext(r.Context()).WithError(err).
+			Error("error getting issuer state", slog.String("issuer", issuerDID))
+		writeIssuerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(state); err != nil {
+		logger.WithContext(r.Context()).WithError(err).
+			Error("error marshalizing response")
+	}
+}
+
+func (h *IssuerHandlers) GetIssuerRootsByState(w http.ResponseWriter, r *http.Request) {
+	issuerDID := chi.URLParam(r, "did")
+	state := chi.URLParam(r, "state")
+	roots, err := h.issuerService.GetRootsByState(r.Context(), issuerDID, state)
+	if err != nil {
+		logger.WithContext(r.Context()).WithError(err).
+			Error("error getting issuer roots by state",
+				slog.String("issuer", issuerDID), slog.String("state", state))
+		writeIssuerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(roots); err != nil {
+		logger.WithContext(r.Context()).WithError(err).
+			Error("error marshalizing response")
+	}
+}
+
+func (h *IssuerHandlers) GetIssuerEvents(w http.ResponseWriter, r *http.Request) {
+	issuerDID := chi.URLParam(r, "did")
+	offset, err := queryInt(r, "offset")
+	if err != nil {
+		logger.WithContext(r.Context()).WithError(err).Error("invalid offset")
+		problem.Write(w, r, problem.CodePageInvalid, err.Error())
+		return
+	}
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		logger.WithContext(r.Context()).WithError(err).Error("invalid limit")
+		problem.Write(w, r, problem.CodePageInvalid, err.Error())
+		return
+	}
+
+	events, err := h.issuerService.GetIssuerEvents(r.Context(), issuerDID, offset, limit)
+	if err != nil {
+		logger.WithContext(r.Context()).WithError(err).
+			Error("error getting issuer events", slog.String("issuer", issuerDID))
+		writeIssuerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(events); err != nil {
+		logger.WithContext(r.Context()).WithError(err).
+			Error("error marshalizing response")
+	}
+}
+
+func queryInt(r *http.Request, name string) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid query parameter '%s'", name)
+	}
+	return i, nil
+}
+
+// writeIssuerError responds with the problem of the issuer service error.
+// Internal and upstream errors have no detail, since it may expose the infrastructure.
+func writeIssuerError(w http.ResponseWriter, r *http.Request, err error) {
+	code := problem.CodeInternal
+	switch {
+	case errors.Is(err, issuer.ErrIssuerNotFound):
+		code = problem.CodeIssuerUnknown
+	case errors.Is(err, issuer.ErrInvalidIssuerDID):
+		code = problem.CodeIssuerDIDInvalid
+	case errors.Is(err, issuer.ErrInvalidState):
+		code = problem.CodeStateInvalid
+	case errors.Is(err, issuer.ErrStateNotFound):
+		code = problem.CodeStateNotFound
+	case errors.Is(err, issuer.ErrInvalidPage):
+		code = problem.CodePageInvalid
+	case errors.Is(err, issuer.ErrUnsupportedChain):
+		code = problem.CodeChainUnsupported
+	case errors.Is(err, issuer.ErrUnavailable):
+		code = problem.CodeUnavailable
+	}
+	var detail string
+	if code != problem.CodeInternal && code != problem.CodeUnavailable {
+		detail = err.Error()
+	}
+	problem.Write(w, r, code, detail)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/iden3/go-service-template/pkg/logger"
@@ -10,25 +11,60 @@ import (
 type SystemHandler struct {
 	readinessService *system.ReadinessService
 	livenessService  *system.LivenessService
+	startupService   *system.StartupService
+	versionService   *system.VersionService
 }
 
 func NewSystemHandler(
 	readinessService *system.ReadinessService,
 	livenessService *system.LivenessService,
+	startupService *system.StartupService,
+	versionService *system.VersionService,
 ) SystemHandler {
 	return SystemHandler{
 		readinessService: readinessService,
 		livenessService:  livenessService,
+		startupService:   startupService,
+		versionService:   versionService,
 	}
 }
 
+// Version responds with the build, the deployment and the uptime.
+func (sh *SystemHandler) Version(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sh.versionService.Version()); err != nil {
+		logger.WithError(err).Error("failed to write response")
+	}
+}
+
+// Startup responds with the progress of the warm-up, with 503 until
+// it has finished and the required steps have succeeded.
+func (sh *SystemHandler) Startup(w http.ResponseWriter, _ *http.Request) {
+	report := sh.startupService.Report()
+	status := http.StatusOK
+	if report.Status != system.StatusStarted {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		logger.WithError(err).Error("failed to write response")
+	}
+}
+
+// Readiness responds with the results of the checks, with 503
+// when one of them is failing or the service is shutting down.
 func (sh *SystemHandler) Readiness(w http.ResponseWriter, _ *http.Request) {
+	report := sh.readinessService.Report()
 	status := http.StatusOK
-	if !sh.readinessService.IsReady() {
+	if report.Status != system.StatusOK {
 		status = http.StatusServiceUnavailable
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
 	w.WriteHeader(status)
-	if _, err := w.Write([]byte("OK")); err != nil {
+	if err := json.NewEncoder(w).Encode(report); err != nil {
 		logger.WithError(err).Error("failed to write response")
 	}
 }
@@ -38,6 +74,7 @@ func (sh *SystemHandler) Liveness(w http.ResponseWriter, _ *http.Request) {
 	if !sh.livenessService.IsLive() {
 		status = http.StatusServiceUnavailable
 	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(status)
 	if _, err := w.Write([]byte("OK")); err != nil {
 		logger.WithError(err).Error("failed to write response")
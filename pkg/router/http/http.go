@@ -7,21 +7,20 @@ import (
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
 	"github.com/iden3/go-service-template/pkg/router/http/handlers"
 	"github.com/iden3/go-service-template/pkg/router/http/middleware"
+	"github.com/iden3/go-service-template/pkg/router/http/openapi"
+	"github.com/iden3/go-service-template/pkg/router/http/problem"
 )
 
 type Handlers struct {
-	systemHandler         handlers.SystemHandler
 	authenticationHandler handlers.AuthenticationHandlers
 	issuerHandler         handlers.IssuerHandlers
 }
 
 func NewHandlers(
-	systemHandler handlers.SystemHandler,
 	authHendler handlers.AuthenticationHandlers,
 	issuerHandler handlers.IssuerHandlers,
 ) Handlers {
 	return Handlers{
-		systemHandler:         systemHandler,
 		authenticationHandler: authHendler,
 		issuerHandler:         issuerHandler,
 	}
@@ -30,14 +29,27 @@ func NewHandlers(
 func (h *Handlers) NewRouter(opts ...Option) http.Handler {
 	r := chi.NewRouter()
 
+	r.Use(chimiddleware.RequestID)
+	r.Use(middleware.Tracing)
+	r.Use(chimiddleware.RealIP)
+	r.Use(middleware.RequestLog)
+	r.Use(middleware.Metrics)
+	r.Use(middleware.Recoverer)
+
+	// the options run after RealIP, so that the rate
+	// limits and the cors see the address of the client
 	for _, opt := range opts {
 		opt(r)
 	}
 
-	r.Use(chimiddleware.RequestID)
-	r.Use(chimiddleware.RealIP)
-	r.Use(middleware.RequestLog)
-	r.Use(chimiddleware.Recoverer)
+	r.Use(mustOpenAPIValidator().Middleware)
+
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, problem.CodeNotFound, "")
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, problem.CodeMethodNotAllowed, "")
+	})
 
 	h.basicRouters(r)
 	h.authRouters(r)
@@ -46,9 +58,20 @@ func (h *Handlers) NewRouter(opts ...Option) http.Handler {
 	return r
 }
 
+// mustOpenAPIValidator panics on an invalid document. The document is
+// embedded, so it can only break with a code change, that tests catch.
+func mustOpenAPIValidator() *openapi.Validator {
+	v, err := openapi.NewValidator()
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// basicRouters are the public routes that are not the API. The probes and
+// the metrics are served by the admin router on the internal listener.
 func (h Handlers) basicRouters(r *chi.Mux) {
-	r.Get("/readiness", h.systemHandler.Readiness)
-	r.Get("/liveness", h.systemHandler.Liveness)
+	r.Get(openapi.Path, openapi.Handler)
 }
 
 func (h Handlers) authRouters(r *chi.Mux) {
@@ -60,5 +83,9 @@ func (h Handlers) authRouters(r *chi.Mux) {
 func (h Handlers) apiRouters(r *chi.Mux) {
 	r.Route("/api/v1", func(r chi.Router) {
 		r.Get("/issuers", h.issuerHandler.GetIssuersList)
+		r.Get("/issuers/{did}", h.issuerHandler.GetIssuer)
+		r.Get("/issuers/{did}/state", h.issuerHandler.GetIssuerState)
+		r.Get("/issuers/{did}/states/{state}/roots", h.issuerHandler.GetIssuerRootsByState)
+		r.Get("/issuers/{did}/events", h.issuerHandler.GetIssuerEvents)
 	})
 }
@@ -0,0 +1,361 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/go-chi/chi/v5"
+	"github.com/iden3/go-iden3-auth/v2/pubsignals"
+	"github.com/iden3/go-service-template/pkg/indexer"
+	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/iden3/go-service-template/pkg/metrics"
+	"github.com/iden3/go-service-template/pkg/router/http/handlers"
+	"github.com/iden3/go-service-template/pkg/router/http/openapi"
+	"github.com/iden3/go-service-template/pkg/router/http/problem"
+	"github.com/iden3/go-service-template/pkg/services/authentication"
+	"github.com/iden3/go-service-template/pkg/services/issuer"
+	"github.com/iden3/go-service-template/pkg/stateresolver"
+	"github.com/iden3/iden3comm/v2/protocol"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const testIssuer = "did:iden3:polygon:amoy:x6x5sor7zpxsu478u36QvEgaRUfPjmzqFo5PHHzbb"
+
+func TestMain(m *testing.M) {
+	if err := logger.SetDefaultLogger(logger.EnvDevelopment, slog.LevelError); err != nil {
+		panic(err)
+	}
+	// the issuers list is served as JSON-LD
+	openapi3filter.RegisterBodyDecoder("application/ld+json",
+		openapi3filter.RegisteredBodyDecoder("application/json"))
+	metrics.Register()
+	os.Exit(m.Run())
+}
+
+type eventStore struct{}
+
+func (eventStore) Events(_ context.Context, _ string, _, _ int) ([]indexer.Event, int, error) {
+	return []indexer.Event{{
+		Type:        indexer.EventStateUpdated,
+		BlockNumber: 10,
+		BlockHash:   "0x01",
+		TxHash:      "0x02",
+		Contract:    "0x03",
+		Data:        map[string]string{"state": "1"},
+	}}, 1, nil
+}
+
+func newTestRouter(t *testing.T, opts ...Option) http.Handler {
+	t.Helper()
+	h := NewHandlers(
+		handlers.NewAuthenticationHandlers("http://localhost", authentication.NewAuthenticationService(nil)),
+		handlers.NewIssuerHandlers(issuer.NewIssuerService([]string{testIssuer}, nil, nil, eventStore{})),
+	)
+	return h.NewRouter(opts...)
+}
+
+// TestOpenAPI_Routes fails when a route is added to the router
+// but not to the document, or the other way around.
+func TestOpenAPI_Routes(t *testing.T) {
+	routes, ok := newTestRouter(t).(chi.Routes)
+	require.True(t, ok)
+
+	var registered []string
+	err := chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		registered = append(registered, method+" "+strings.TrimSuffix(route, "/"))
+		return nil
+	})
+	require.NoError(t, err)
+
+	spec, err := openapi.Load()
+	require.NoError(t, err)
+	var documented []string
+	for path, item := range spec.Paths.Map() {
+		for method := range item.Operations() {
+			documented = append(documented, method+" "+path)
+		}
+	}
+
+	sort.Strings(registered)
+	sort.Strings(documented)
+	require.Equal(t, documented, registered)
+}
+
+// TestOpenAPI_Responses checks the responses of the handlers
+// against the document.
+func TestOpenAPI_Responses(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{"openapi", http.MethodGet, openapi.Path, "", http.StatusOK},
+		{"auth request", http.MethodGet, "/api/v1/requests/auth?issuer=" + testIssuer, "", http.StatusOK},
+		{"callback unknown session", http.MethodPost, "/api/v1/callback?sessionId=0", "token", http.StatusNotFound},
+		{"status unknown session", http.MethodGet, "/api/v1/status?id=0", "", http.StatusNotFound},
+		{"issuers", http.MethodGet, "/api/v1/issuers", "", http.StatusOK},
+		{"unknown issuer", http.MethodGet, "/api/v1/issuers/did:iden3:unknown", "", http.StatusNotFound},
+		{"unresolvable issuer", http.MethodGet, "/api/v1/issuers/" + testIssuer, "", http.StatusBadRequest},
+		{"unresolvable issuer state", http.MethodGet, "/api/v1/issuers/" + testIssuer + "/state", "", http.StatusBadRequest},
+		{"unresolvable issuer roots", http.MethodGet, "/api/v1/issuers/" + testIssuer + "/states/1/roots", "", http.StatusBadRequest},
+		{"events", http.MethodGet, "/api/v1/issuers/" + testIssuer + "/events?limit=10", "", http.StatusOK},
+	}
+
+	router := newTestRouter(t)
+	validator, err := openapi.NewValidator()
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/iden3-zkp-json")
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			require.Equal(t, tt.status, rec.Code, rec.Body.String())
+
+			route, params, err := validator.Route(req)
+			require.NoError(t, err)
+			err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: &openapi3filter.RequestValidationInput{
+					Request:    req,
+					PathParams: params,
+					Route:      route,
+				},
+				Status: rec.Code,
+				Header: rec.Header(),
+				Body:   io.NopCloser(bytes.NewReader(rec.Body.Bytes())),
+				Options: &openapi3filter.Options{
+					IncludeResponseStatus: true,
+					MultiError:            true,
+				},
+			})
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestOpenAPI_InvalidRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+	}{
+		{"no issuer", "/api/v1/requests/auth"},
+		{"no session id", "/api/v1/status"},
+		{"limit is not a number", "/api/v1/issuers/" + testIssuer + "/events?limit=ten"},
+		{"limit is too large", "/api/v1/issuers/" + testIssuer + "/events?limit=1000"},
+		{"negative offset", "/api/v1/issuers/" + testIssuer + "/events?offset=-1"},
+	}
+
+	router := newTestRouter(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, http.NoBody))
+			require.Equal(t, http.StatusBadRequest, rec.Code)
+			require.Equal(t, problem.ContentType, rec.Header().Get("Content-Type"))
+
+			var p problem.Problem
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&p))
+			require.Equal(t, problem.CodeBadRequest, p.Code)
+		})
+	}
+}
+
+func TestRouter_CallbackRejectsBadInput(t *testing.T) {
+	router := newTestRouter(t, WithBodyLimits(1024, map[string]int64{"/api/v1/callback": 256}))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/requests/auth?issuer="+testIssuer, http.NoBody))
+	require.Equal(t, http.StatusOK, rec.Code)
+	callback := "/api/v1/callback?sessionId=" + rec.Header().Get("x-id")
+
+	tests := []struct {
+		name        string
+		body        io.Reader
+		contentType string
+		code        problem.Code
+	}{
+		{"oversized", strings.NewReader(strings.Repeat("a", 257)), "application/iden3-zkp-json", problem.CodeBodyTooLarge},
+		{"oversized without length", io.MultiReader(strings.NewReader(strings.Repeat("a", 257))),
+			"application/iden3-zkp-json", problem.CodeBodyTooLarge},
+		{"json", strings.NewReader("{}"), "application/json", problem.CodeMediaType},
+		{"no content type", strings.NewReader("token"), "", problem.CodeMediaType},
+		{"malformed token", strings.NewReader("token"), "application/iden3-zkp-json", problem.CodeTokenMalformed},
+		{"malformed headers", strings.NewReader("e30.e30.e30"), "text/plain; charset=utf-8", problem.CodeTokenMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, callback, tt.body)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			require.Equal(t, problem.Status(tt.code), rec.Code, rec.Body.String())
+
+			var p problem.Problem
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&p))
+			require.Equal(t, tt.code, p.Code)
+		})
+	}
+}
+
+func TestRouter_AuthRequestsStopOnShutdown(t *testing.T) {
+	auth := authentication.NewAuthenticationService(nil)
+	h := NewHandlers(
+		handlers.NewAuthenticationHandlers("http://localhost", auth),
+		handlers.NewIssuerHandlers(issuer.NewIssuerService([]string{testIssuer}, nil, nil, eventStore{})),
+	)
+	router := h.NewRouter()
+	auth.StopIssuing()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/requests/auth?issuer="+testIssuer, http.NoBody))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	var p problem.Problem
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&p))
+	require.Equal(t, problem.CodeShuttingDown, p.Code)
+}
+
+// unavailableVerifier fails like a verifier whose state contract can't be reached.
+type unavailableVerifier struct{}
+
+func (unavailableVerifier) FullVerify(
+	context.Context,
+	string,
+	protocol.AuthorizationRequestMessage,
+	...pubsignals.VerifyOpt,
+) (*protocol.AuthorizationResponseMessage, error) {
+	return nil, errors.Wrap(stateresolver.ErrUnavailable, "context deadline exceeded")
+}
+
+func TestRouter_CallbackUpstreamUnavailable(t *testing.T) {
+	h := NewHandlers(
+		handlers.NewAuthenticationHandlers("http://localhost", authentication.NewAuthenticationService(unavailableVerifier{})),
+		handlers.NewIssuerHandlers(issuer.NewIssuerService([]string{testIssuer}, nil, nil, eventStore{})),
+	)
+	router := h.NewRouter()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/requests/auth?issuer="+testIssuer, http.NoBody))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var request protocol.AuthorizationRequestMessage
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&request))
+
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	token := strings.Join([]string{
+		encode(`{"alg":"groth16","circuitId":"authV2","crit":["circuitId"],"typ":"application/iden3-zkp-json"}`),
+		encode(`{"id":"1","typ":"application/iden3-zkp-json",` +
+			`"type":"https://iden3-communication.io/authorization/1.0/response",` +
+			`"thid":"` + request.ThreadID + `","from":"` + testIssuer + `","body":{}}`),
+		encode(`{"proof":{"pi_a":["1"],"pi_b":[["1"]],"pi_c":["1"],"protocol":"groth16"},"pub_signals":["1"]}`),
+	}, ".")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/callback?sessionId="+rec.Header().Get("x-id"), strings.NewReader(token))
+	req.Header.Set("Content-Type", "application/iden3-zkp-json")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code, rec.Body.String())
+	var p problem.Problem
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&p))
+	require.Equal(t, problem.CodeUnavailable, p.Code)
+}
+
+func TestRouter_ClientCertPaths(t *testing.T) {
+	router := newTestRouter(t, WithClientCertPaths("/api/v1/issuers"))
+	serve := func(target string, state *tls.ConnectionState) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, http.NoBody)
+		req.TLS = state
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("/api/v1/issuers", nil)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	var p problem.Problem
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&p))
+	require.Equal(t, problem.CodeClientCertRequired, p.Code)
+
+	require.Equal(t, http.StatusForbidden, serve("/api/v1/issuers", &tls.ConnectionState{}).Code)
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+	require.Equal(t, http.StatusOK, serve("/api/v1/issuers", verified).Code)
+	require.Equal(t, http.StatusOK, serve(openapi.Path, nil).Code)
+}
+
+func TestRouter_NotFound(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newTestRouter(t).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/unknown", http.NoBody))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.Equal(t, problem.ContentType, rec.Header().Get("Content-Type"))
+}
+
+func TestRouter_MetricsByRoutePattern(t *testing.T) {
+	route := "/api/v1/issuers/{did}/events"
+	counter := metrics.HTTPRequests.WithLabelValues(route, http.MethodGet, "200")
+	before := testutil.ToFloat64(counter)
+
+	router := newTestRouter(t)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/issuers/"+testIssuer+"/events", http.NoBody))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, before+1, testutil.ToFloat64(counter))
+
+	rec = httptest.NewRecorder()
+	newTestAdminRouter(t, "").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `issuer_demo_http_requests_total{method="GET",route="`+route+`",status="200"}`)
+}
+
+func TestRouter_TracingContinuesCallerTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/issuers/"+testIssuer+"/events", http.NoBody)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	newTestRouter(t).ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var server sdktrace.ReadOnlySpan
+	for _, s := range recorder.Ended() {
+		if s.SpanKind() == trace.SpanKindServer {
+			server = s
+		}
+	}
+	require.NotNil(t, server)
+	require.Equal(t, "GET /api/v1/issuers/{did}/events", server.Name())
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+}
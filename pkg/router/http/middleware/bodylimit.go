@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/iden3/go-service-template/pkg/router/http/problem"
+)
+
+// BodyLimit limits the request bodies to limit bytes, or to the limit of the
+// path in routes. A body that declares a larger Content-Length is rejected
+// before it is read, and the reads of the handlers fail past the limit
+// with *http.MaxBytesError.
+func BodyLimit(limit int64, routes map[string]int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			max := limit
+			if l, ok := routes[r.URL.Path]; ok {
+				max = l
+			}
+			if r.ContentLength > max {
+				problem.Write(w, r, problem.CodeBodyTooLarge,
+					fmt.Sprintf("the request body must not exceed %d bytes", max))
+				return
+			}
+			if r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, max)
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/iden3/go-service-template/pkg/router/http/problem"
+)
+
+// RequireClientCert rejects the requests to the paths with one of the
+// prefixes, unless the client sent a certificate that the TLS server
+// verified against its client CAs.
+func RequireClientCert(prefixes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			for _, prefix := range prefixes {
+				if !strings.HasPrefix(r.URL.Path, prefix) {
+					continue
+				}
+				if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+					problem.Write(w, r, problem.CodeClientCertRequired, "")
+					return
+				}
+				break
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	logger "github.com/iden3/go-service-template/pkg/logger"
+	"github.com/iden3/go-service-template/pkg/router/http/problem"
+)
+
+// Recoverer recovers from panics in the handlers, logs them and
+// responds with an internal error problem.
+func Recoverer(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rvr := recover()
+			if rvr == nil {
+				return
+			}
+			if rvr == http.ErrAbortHandler { //nolint:errorlint // the panic value is compared, as net/http does
+				panic(rvr)
+			}
+			logger.WithContext(r.Context()).Error("panic in http handler",
+				slog.String("panic", fmt.Sprint(rvr)),
+				slog.String("stack", string(debug.Stack())))
+			if r.Header.Get("Connection") != "Upgrade" {
+				problem.Write(w, r, problem.CodeInternal, "")
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,102 @@
+package openapi
+
+import (
+	"context"
+	_ "embed"
+	"log/slog"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/iden3/go-service-template/pkg/router/http/problem"
+	"github.com/pkg/errors"
+)
+
+// Path is where the document is served.
+const Path = "/api/v1/openapi.json"
+
+//go:embed openapi.json
+var document []byte
+
+// Load parses and validates the OpenAPI document of the API.
+func Load() (*openapi3.T, error) {
+	loader := openapi3.NewLoader()
+	spec, err := loader.LoadFromData(document)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse openapi document")
+	}
+	if err := spec.Validate(context.Background()); err != nil {
+		return nil, errors.Wrap(err, "invalid openapi document")
+	}
+	return spec, nil
+}
+
+// Handler serves the OpenAPI document.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(document); err != nil {
+		logger.WithContext(r.Context()).WithError(err).Error("failed to write response")
+	}
+}
+
+// Validator checks the requests against the OpenAPI document
+// and rejects the invalid ones with a bad request problem.
+type Validator struct {
+	router routers.Router
+}
+
+// NewValidator creates the validator of the API requests.
+func NewValidator() (*Validator, error) {
+	spec, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	// the servers of the document are ignored, so that the routes
+	// match on any host the service is deployed to
+	spec.Servers = nil
+	router, err := gorillamux.NewRouter(spec)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create openapi router")
+	}
+	return &Validator{router: router}, nil
+}
+
+// Route finds the operation of the request in the document.
+func (v *Validator) Route(r *http.Request) (*routers.Route, map[string]string, error) {
+	return v.router.FindRoute(r)
+}
+
+// Middleware validates the path, query and header parameters. Requests
+// to the routes that are not in the document are passed as is. The
+// request bodies are not checked, since the JWZ token of the callback
+// is verified by the handler.
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		route, params, err := v.router.FindRoute(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: params,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				ExcludeRequestBody: true,
+				MultiError:         true,
+			},
+		}
+		if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			logger.WithContext(r.Context()).WithError(err).Warn("invalid request",
+				slog.String("operation", route.Operation.OperationID))
+			problem.Write(w, r, problem.CodeBadRequest, err.Error())
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
@@ -3,6 +3,8 @@ package http
 import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/cors"
+	"github.com/iden3/go-service-template/pkg/ratelimit"
+	"github.com/iden3/go-service-template/pkg/router/http/middleware"
 )
 
 type Option func(r *chi.Mux)
@@ -27,3 +29,25 @@ func WithCors(corsOption cors.Options) Option {
 		r.Use(c.Handler)
 	}
 }
+
+func WithRateLimiter(limiter *ratelimit.Limiter) Option {
+	return func(r *chi.Mux) {
+		r.Use(limiter.Middleware)
+	}
+}
+
+// WithBodyLimits limits the request bodies to limit bytes,
+// and the bodies of the paths in routes to their own limits.
+func WithBodyLimits(limit int64, routes map[string]int64) Option {
+	return func(r *chi.Mux) {
+		r.Use(middleware.BodyLimit(limit, routes))
+	}
+}
+
+// WithClientCertPaths requires a verified client certificate
+// for the paths with one of the prefixes.
+func WithClientCertPaths(prefixes ...string) Option {
+	return func(r *chi.Mux) {
+		r.Use(middleware.RequireClientCert(prefixes...))
+	}
+}
@@ -0,0 +1,137 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/iden3/go-service-template/pkg/logger"
+)
+
+// ContentType is the media type of the RFC 7807 error bodies.
+const ContentType = "application/problem+json"
+
+// Code is the machine-readable error code of a problem.
+type Code string
+
+const (
+	CodeBadRequest         Code = "bad_request"
+	CodeNotFound           Code = "not_found"
+	CodeMethodNotAllowed   Code = "method_not_allowed"
+	CodeInternal           Code = "internal_error"
+	CodeRateLimited        Code = "rate_limited"
+	CodeBodyTooLarge       Code = "body_too_large"
+	CodeMediaType          Code = "media_type_unsupported"
+	CodeClientCertRequired Code = "client_certificate_required"
+	CodeUnauthorized       Code = "unauthorized"
+	CodeReloadFailed       Code = "reload_failed"
+	CodeShuttingDown       Code = "shutting_down"
+	CodeUnavailable        Code = "upstream_unavailable"
+
+	CodeIssuerRequired   Code = "issuer_required"
+	CodeSessionRequired  Code = "session_id_required"
+	CodeSessionNotFound  Code = "session_not_found"
+	CodeSessionPending   Code = "session_pending"
+	CodeSessionUsed      Code = "session_used"
+	CodeSessionExpired   Code = "session_expired"
+	CodeThreadIDReused   Code = "thread_id_reused"
+	CodeBodyUnreadable   Code = "body_unreadable"
+	CodeTokenMalformed   Code = "token_malformed"
+	CodeProofInvalid     Code = "proof_invalid"
+	CodeIssuerUnknown    Code = "issuer_unknown"
+	CodeIssuerDIDInvalid Code = "issuer_did_invalid"
+	CodeChainUnsupported Code = "chain_unsupported"
+	CodeStateInvalid     Code = "state_invalid"
+	CodeStateNotFound    Code = "state_not_found"
+	CodePageInvalid      Code = "page_invalid"
+)
+
+type definition struct {
+	status int
+	title  string
+}
+
+var definitions = map[Code]definition{
+	CodeBadRequest:         {http.StatusBadRequest, "Bad request"},
+	CodeNotFound:           {http.StatusNotFound, "Not found"},
+	CodeMethodNotAllowed:   {http.StatusMethodNotAllowed, "Method not allowed"},
+	CodeInternal:           {http.StatusInternalServerError, "Internal server error"},
+	CodeRateLimited:        {http.StatusTooManyRequests, "Too many requests"},
+	CodeBodyTooLarge:       {http.StatusRequestEntityTooLarge, "Request body is too large"},
+	CodeMediaType:          {http.StatusUnsupportedMediaType, "Media type is not supported"},
+	CodeClientCertRequired: {http.StatusForbidden, "Client certificate is required"},
+	CodeUnauthorized:       {http.StatusUnauthorized, "Unauthorized"},
+	CodeReloadFailed:       {http.StatusUnprocessableEntity, "Config reload failed"},
+	CodeShuttingDown:       {http.StatusServiceUnavailable, "Service is shutting down"},
+	CodeUnavailable:        {http.StatusServiceUnavailable, "Upstream is unavailable"},
+
+	CodeIssuerRequired:  {http.StatusBadRequest, "Issuer is required"},
+	CodeSessionRequired: {http.StatusBadRequest, "Session ID is required"},
+	CodeSessionNotFound: {http.StatusNotFound, "Session not found"},
+	// the client polls the status until it stops getting 404
+	CodeSessionPending:   {http.StatusNotFound, "Session is not authenticated yet"},
+	CodeSessionUsed:      {http.StatusConflict, "Session is already used"},
+	CodeSessionExpired:   {http.StatusGone, "Session is expired"},
+	CodeThreadIDReused:   {http.StatusConflict, "Thread ID is already used"},
+	CodeBodyUnreadable:   {http.StatusBadRequest, "Request body can't be read"},
+	CodeTokenMalformed:   {http.StatusBadRequest, "Token is malformed"},
+	CodeProofInvalid:     {http.StatusBadRequest, "Proof is invalid"},
+	CodeIssuerUnknown:    {http.StatusNotFound, "Issuer is unknown"},
+	CodeIssuerDIDInvalid: {http.StatusBadRequest, "Issuer DID is invalid"},
+	CodeChainUnsupported: {http.StatusBadRequest, "Chain is not supported"},
+	CodeStateInvalid:     {http.StatusBadRequest, "State is invalid"},
+	CodeStateNotFound:    {http.StatusNotFound, "State not found"},
+	CodePageInvalid:      {http.StatusBadRequest, "Page is invalid"},
+}
+
+// Problem is the RFC 7807 error body.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      Code   `json:"code"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// Status returns the HTTP status of the code.
+func Status(code Code) int {
+	if d, ok := definitions[code]; ok {
+		return d.status
+	}
+	return http.StatusInternalServerError
+}
+
+// New creates the problem for the request.
+func New(r *http.Request, code Code, detail string) Problem {
+	d, ok := definitions[code]
+	if !ok {
+		d = definitions[CodeInternal]
+	}
+	return Problem{
+		Type:      "/problems/" + string(code),
+		Title:     d.title,
+		Status:    d.status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: chimiddleware.GetReqID(r.Context()),
+	}
+}
+
+// Write responds with the problem. The detail is shown to the client,
+// so it must not have internal information.
+func Write(w http.ResponseWriter, r *http.Request, code Code, detail string) {
+	WriteProblem(w, New(r, code, detail))
+}
+
+// WriteProblem responds with the problem as is.
+func WriteProblem(w http.ResponseWriter, p Problem) {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Del("Content-Length")
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		logger.WithError(err).Error("failed to write problem response")
+	}
+}
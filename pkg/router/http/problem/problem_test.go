@@ -0,0 +1,39 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Write(w, r, CodeProofInvalid, "token is expired")
+	})
+	handler = chimiddleware.RequestID(handler)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/callback?sessionId=1", http.NoBody))
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Equal(t, ContentType, rec.Header().Get("Content-Type"))
+
+	var p Problem
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&p))
+	require.Equal(t, "/problems/proof_invalid", p.Type)
+	require.Equal(t, CodeProofInvalid, p.Code)
+	require.Equal(t, http.StatusBadRequest, p.Status)
+	require.Equal(t, "token is expired", p.Detail)
+	require.Equal(t, "/api/v1/callback", p.Instance)
+	require.NotEmpty(t, p.RequestID)
+}
+
+func TestNew_UnknownCode(t *testing.T) {
+	p := New(httptest.NewRequest(http.MethodGet, "/", http.NoBody), Code("unknown"), "")
+	require.Equal(t, http.StatusInternalServerError, p.Status)
+	require.Equal(t, http.StatusInternalServerError, Status(Code("unknown")))
+}
@@ -3,74 +3,383 @@ package authentication
 import (
 	"context"
 	"fmt"
-	"math/rand"
-	"strconv"
+	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	auth "github.com/iden3/go-iden3-auth/v2"
+	"github.com/iden3/go-iden3-auth/v2/pubsignals"
+	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/iden3/go-service-template/pkg/metrics"
+	"github.com/iden3/go-service-template/pkg/stateresolver"
+	"github.com/iden3/go-service-template/pkg/tracing"
 	"github.com/iden3/iden3comm/v2/protocol"
 	"github.com/patrickmn/go-cache"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
-	userSessionTracker = cache.New(60*time.Minute, 60*time.Minute)
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionExists   = errors.New("session already exists")
+	ErrSessionPending  = errors.New("session is not authenticated")
+	ErrSessionUsed     = errors.New("session is already used")
+	ErrSessionExpired  = errors.New("session is expired")
+	ErrThreadIDReused  = errors.New("thread id is already used")
+	ErrProofInvalid    = errors.New("proof is invalid")
+	ErrShuttingDown    = errors.New("service is shutting down")
 )
 
+const (
+	sessionTTL = 60 * time.Minute
+	// drainInterval is how often the pending sessions are counted on drain
+	drainInterval = 100 * time.Millisecond
+)
+
+// Verifier verifies the JWZ token with the authorization response.
+type Verifier interface {
+	FullVerify(
+		ctx context.Context,
+		token string,
+		request protocol.AuthorizationRequestMessage,
+		opts ...pubsignals.VerifyOpt,
+	) (*protocol.AuthorizationResponseMessage, error)
+}
+
 type AuthenticationService struct {
-	verifier *auth.Verifier
+	verifier atomic.Pointer[Verifier]
+	sessions *sessionStore
+	// threads are the thread IDs of the responses that were verified
+	threads *cache.Cache
+	maxAge  time.Duration
+	now     func() time.Time
+	// newID generates the session IDs, they are random UUIDs
+	newID func() string
+
+	// shared keeps the sessions handed off on shutdown, it may be nil
+	shared      SharedStore
+	gracePeriod time.Duration
+	draining    atomic.Bool
+}
+
+type Option func(*AuthenticationService)
+
+// WithMaxAge sets how long after the request a response is accepted.
+func WithMaxAge(maxAge time.Duration) Option {
+	return func(a *AuthenticationService) {
+		a.maxAge = maxAge
+	}
 }
 
-func NewAuthenticationService(verifier *auth.Verifier) *AuthenticationService {
-	return &AuthenticationService{
-		verifier: verifier,
+// WithSharedStore sets the store the sessions are handed off to on shutdown,
+// and read from when they are not found in this instance.
+func WithSharedStore(store SharedStore) Option {
+	return func(a *AuthenticationService) {
+		a.shared = store
 	}
 }
 
+// WithGracePeriod sets how long the drain waits for the pending sessions.
+func WithGracePeriod(gracePeriod time.Duration) Option {
+	return func(a *AuthenticationService) {
+		a.gracePeriod = gracePeriod
+	}
+}
+
+func NewAuthenticationService(verifier Verifier, opts ...Option) *AuthenticationService {
+	a := &AuthenticationService{
+		sessions:    newSessionStore(sessionTTL),
+		threads:     cache.New(sessionTTL, sessionTTL),
+		maxAge:      5 * time.Minute,
+		now:         time.Now,
+		newID:       uuid.NewString,
+		gracePeriod: 30 * time.Second,
+	}
+	a.verifier.Store(&verifier)
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// SetVerifier replaces the verifier, e.g. after the state resolvers
+// were rebuilt. Sessions are kept, so pending logins are not dropped.
+func (a *AuthenticationService) SetVerifier(verifier Verifier) {
+	a.verifier.Store(&verifier)
+}
+
+// NewAuthenticationRequest creates the request of a new session.
+// It returns ErrShuttingDown once the drain has started, and
+// ErrSessionExists when the session ID is already taken.
 func (a *AuthenticationService) NewAuthenticationRequest(
 	serviceURL string,
 	issuer string,
-) (request protocol.AuthorizationRequestMessage, sessionID string) {
-	//nolint:gosec // this is not a security issue
-	sessionID = strconv.Itoa(rand.Intn(1000000))
+) (request protocol.AuthorizationRequestMessage, sessionID string, err error) {
+	if a.draining.Load() {
+		return protocol.AuthorizationRequestMessage{}, "", ErrShuttingDown
+	}
+	sessionID = a.newID()
 	uri := fmt.Sprintf("%s?sessionId=%s", serviceURL, sessionID)
 	request = auth.CreateAuthorizationRequestWithMessage(
 		"login to website", "", issuer, uri,
 	)
 	request.ID = uuid.New().String()
 	request.ThreadID = uuid.New().String()
-	userSessionTracker.Set(sessionID, request, cache.DefaultExpiration)
-	return request, sessionID
+	if err = a.sessions.add(sessionID, session{request: request, createdAt: a.now()}); err != nil {
+		return protocol.AuthorizationRequestMessage{}, "", err
+	}
+	metrics.AuthRequests.Inc()
+	return request, sessionID, nil
 }
 
+// Verify verifies the response to the request of the session. A request is
+// answered once: the session is locked while the response is verified, and
+// it is released for another attempt only when the verification fails.
 func (a *AuthenticationService) Verify(ctx context.Context,
-	sessionID string, tokenBytes []byte) (string, error) {
-	request, found := userSessionTracker.Get(sessionID)
+	sessionID string, tokenBytes []byte) (userID string, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "AuthenticationService.Verify",
+		trace.WithAttributes(attribute.String("auth.session_id", sessionID)))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	sess, shared, found := a.session(ctx, sessionID)
 	if !found {
-		return "", errors.Errorf("auth request was not found for session ID: %s", sessionID)
+		metrics.AuthVerifications.WithLabelValues(metrics.ResultFailure, "session_not_found").Inc()
+		return "", errors.Wrapf(ErrSessionNotFound, "auth request was not found for session ID: %s", sessionID)
 	}
-	authResponse, err := a.verifier.FullVerify(
-		ctx,
-		string(tokenBytes),
-		request.(protocol.AuthorizationRequestMessage),
-	)
+	if sess.state != statePending {
+		metrics.AuthVerifications.WithLabelValues(metrics.ResultFailure, "session_used").Inc()
+		return "", errors.Wrapf(ErrSessionUsed, "session ID: %s", sessionID)
+	}
+	if age := a.now().Sub(sess.createdAt); age > a.maxAge {
+		metrics.AuthVerifications.WithLabelValues(metrics.ResultFailure, "session_expired").Inc()
+		return "", errors.Wrapf(ErrSessionExpired, "the request was created %s ago, max age is %s",
+			age.Round(time.Second), a.maxAge)
+	}
+	_, msg, err := ParseToken(string(tokenBytes))
 	if err != nil {
-		return "", errors.Errorf("error verifying token: %v", err)
+		metrics.AuthVerifications.WithLabelValues(metrics.ResultFailure, "token_malformed").Inc()
+		return "", err
+	}
+	// go-iden3-auth doesn't bind the response to the request,
+	// so a response to another request would pass the verification
+	if msg.ThreadID != sess.request.ThreadID {
+		metrics.AuthVerifications.WithLabelValues(metrics.ResultFailure, "proof_invalid").Inc()
+		return "", errors.Wrapf(ErrProofInvalid, "thread ID '%s' doesn't match the request", msg.ThreadID)
 	}
-	userSessionTracker.Set(sessionID, authResponse.From, cache.DefaultExpiration)
+
+	swapped, err := a.swap(ctx, shared, sessionID, statePending, stateVerifying, "")
+	if err != nil {
+		metrics.AuthVerifications.WithLabelValues(metrics.ResultError, "session_store").Inc()
+		return "", err
+	}
+	if !swapped {
+		metrics.AuthVerifications.WithLabelValues(metrics.ResultFailure, "session_used").Inc()
+		return "", errors.Wrapf(ErrSessionUsed, "session ID: %s", sessionID)
+	}
+	if err := a.threads.Add(msg.ThreadID, struct{}{}, cache.DefaultExpiration); err != nil {
+		a.release(ctx, shared, sessionID)
+		metrics.AuthVerifications.WithLabelValues(metrics.ResultFailure, "thread_id_reused").Inc()
+		return "", errors.Wrapf(ErrThreadIDReused, "thread ID: %s", msg.ThreadID)
+	}
+
+	authResponse, err := a.fullVerify(ctx, string(tokenBytes), sess.request)
+	if err != nil {
+		a.threads.Delete(msg.ThreadID)
+		a.release(ctx, shared, sessionID)
+		// the proof is rejected only by the verification itself, the
+		// response is not invalid when the chain or the keys are unavailable
+		switch {
+		case errors.Is(err, stateresolver.ErrUnavailable):
+			metrics.AuthVerifications.WithLabelValues(metrics.ResultError, "state_unavailable").Inc()
+			return "", errors.Wrap(err, "error verifying token")
+		case errors.Is(err, ErrKeyUnavailable):
+			metrics.AuthVerifications.WithLabelValues(metrics.ResultError, "key_unavailable").Inc()
+			return "", errors.Wrap(err, "error verifying token")
+		}
+		metrics.AuthVerifications.WithLabelValues(metrics.ResultFailure, "proof_invalid").Inc()
+		return "", errors.Wrapf(ErrProofInvalid, "error verifying token: %v", err)
+	}
+	if _, err := a.swap(ctx, shared, sessionID, stateVerifying, stateAuthenticated, authResponse.From); err != nil {
+		// the proof is valid, but the status polls of the other
+		// instances won't see the login
+		logger.WithContext(ctx).WithError(err).Error("failed to store the authenticated session",
+			slog.String("sessionID", sessionID))
+	}
+	metrics.AuthVerifications.WithLabelValues(metrics.ResultSuccess, "").Inc()
 	return authResponse.From, nil
 }
 
-func (a *AuthenticationService) AuthenticationRequestStatus(sessionID string) (string, error) {
-	session, found := userSessionTracker.Get(sessionID)
+// swap moves the session from the old state to the new one, in this
+// instance or, for a session handed off by another one, in the shared store.
+func (a *AuthenticationService) swap(
+	ctx context.Context,
+	shared bool,
+	sessionID string,
+	old, state sessionState,
+	userID string,
+) (bool, error) {
+	if !shared {
+		return a.sessions.compareAndSwap(sessionID, old, state, userID), nil
+	}
+	data, err := a.shared.Get(ctx, sessionID)
+	if err != nil || data == nil {
+		return false, err
+	}
+	sess, err := unmarshalSession(data)
+	if err != nil {
+		return false, errors.Wrapf(err, "invalid session '%s' in the shared store", sessionID)
+	}
+	if sess.state != old {
+		return false, nil
+	}
+	sess.state = state
+	sess.userID = userID
+	next, err := marshalSession(sess)
+	if err != nil {
+		return false, err
+	}
+	return a.shared.CompareAndSwap(ctx, sessionID, data, next)
+}
+
+// release moves the session back to pending after a failed
+// verification, so that the wallet can try again.
+func (a *AuthenticationService) release(ctx context.Context, shared bool, sessionID string) {
+	if _, err := a.swap(ctx, shared, sessionID, stateVerifying, statePending, ""); err != nil {
+		logger.WithContext(ctx).WithError(err).Error("failed to release the session",
+			slog.String("sessionID", sessionID))
+	}
+}
+
+func (a *AuthenticationService) fullVerify(
+	ctx context.Context,
+	token string,
+	request protocol.AuthorizationRequestMessage,
+) (*protocol.AuthorizationResponseMessage, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "auth.Verifier.FullVerify")
+	defer span.End()
+	authResponse, err := (*a.verifier.Load()).FullVerify(ctx, token, request)
+	tracing.RecordError(span, err)
+	return authResponse, err
+}
+
+// SessionCount returns the number of the pending and authenticated sessions.
+func (a *AuthenticationService) SessionCount() int {
+	return a.sessions.count()
+}
+
+func (a *AuthenticationService) AuthenticationRequestStatus(ctx context.Context, sessionID string) (string, error) {
+	sess, _, found := a.session(ctx, sessionID)
 	if !found {
-		return "", errors.Errorf("session not found: %s", sessionID)
+		return "", errors.Wrapf(ErrSessionNotFound, "session ID: %s", sessionID)
+	}
+	if sess.state != stateAuthenticated {
+		return "", errors.Wrapf(ErrSessionPending, "session ID: %s", sessionID)
+	}
+	return sess.userID, nil
+}
+
+// session returns the session of this instance, or else the session
+// handed off by another one to the shared store. It is read only: the
+// state of a shared session changes in the store, by the callback.
+func (a *AuthenticationService) session(ctx context.Context, sessionID string) (sess session, shared, found bool) {
+	if sess, found := a.sessions.get(sessionID); found {
+		return sess, false, true
+	}
+	if a.shared == nil {
+		return session{}, false, false
+	}
+	data, err := a.shared.Get(ctx, sessionID)
+	if err != nil {
+		logger.WithContext(ctx).WithError(err).Error("failed to get the session from the shared store",
+			slog.String("sessionID", sessionID))
+		return session{}, false, false
+	}
+	if data == nil {
+		return session{}, false, false
+	}
+	sess, err = unmarshalSession(data)
+	if err != nil {
+		logger.WithContext(ctx).WithError(err).Error("invalid session in the shared store",
+			slog.String("sessionID", sessionID))
+		return session{}, false, false
+	}
+	return sess, true, true
+}
+
+// StopIssuing makes the new authentication requests fail with ErrShuttingDown,
+// the callbacks of the sessions are still verified.
+func (a *AuthenticationService) StopIssuing() {
+	a.draining.Store(true)
+}
+
+// Drain stops issuing the requests and waits until the pending sessions
+// are answered, for the grace period at most.
+func (a *AuthenticationService) Drain(ctx context.Context) error {
+	a.StopIssuing()
+	graceCtx, cancel := context.WithTimeout(ctx, a.gracePeriod)
+	defer cancel()
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+	for {
+		pending := a.sessions.pending(a.maxAge, a.now())
+		if pending == 0 {
+			logger.Info("auth sessions drained")
+			return nil
+		}
+		select {
+		case <-graceCtx.Done():
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			logger.Info("auth grace period is over", slog.Int("pending", pending))
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Shutdown hands off the sessions to the shared store, so that another
+// instance verifies their callbacks and answers their status. The sessions
+// are dropped when there is no shared store.
+func (a *AuthenticationService) Shutdown(ctx context.Context) error {
+	a.StopIssuing()
+	items := a.sessions.items()
+	if a.shared == nil {
+		if len(items) > 0 {
+			logger.Warn("auth sessions are dropped, no shared store is set", slog.Int("sessions", len(items)))
+		}
+		return nil
+	}
+
+	now := a.now()
+	var handedOff, skipped int
+	var errs []error
+	for id, item := range items {
+		ttl := item.expiresAt.Sub(now)
+		// a response verified at the shutdown is not handed off half done
+		if item.state == stateVerifying || ttl <= 0 {
+			skipped++
+			continue
+		}
+		data, err := marshalSession(item.session)
+		if err == nil {
+			err = a.shared.Put(ctx, id, data, ttl)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		handedOff++
 	}
-	switch s := session.(type) {
-	case string:
-		return s, nil
-	default:
-		return "", errors.Errorf("session didn't pass authentification")
+	logger.Info("auth sessions handed off",
+		slog.Int("sessions", handedOff), slog.Int("skipped", skipped), slog.Int("failed", len(errs)))
+	if len(errs) > 0 {
+		return errors.Wrapf(errs[0], "failed to hand off %d sessions", len(errs))
 	}
+	return nil
 }
@@ -0,0 +1,343 @@
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/iden3/go-iden3-auth/v2/pubsignals"
+	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/iden3/go-service-template/pkg/stateresolver"
+	"github.com/iden3/iden3comm/v2/protocol"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	if err := logger.SetDefaultLogger(logger.EnvDevelopment, slog.LevelError); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+const testUser = "did:iden3:polygon:amoy:x6x5sor7zpxsu478u36QvEgaRUfPjmzqFo5PHHzbb"
+
+// fakeVerifier accepts the tokens after the release channel is closed,
+// or at once when it is nil.
+type fakeVerifier struct {
+	err     error
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (v *fakeVerifier) FullVerify(
+	_ context.Context,
+	token string,
+	_ protocol.AuthorizationRequestMessage,
+	_ ...pubsignals.VerifyOpt,
+) (*protocol.AuthorizationResponseMessage, error) {
+	v.calls.Add(1)
+	if v.release != nil {
+		<-v.release
+	}
+	if v.err != nil {
+		return nil, v.err
+	}
+	_, msg, err := ParseToken(token)
+	return msg, err
+}
+
+func newRequest(t *testing.T, a *AuthenticationService) (protocol.AuthorizationRequestMessage, string) {
+	t.Helper()
+	request, sessionID, err := a.NewAuthenticationRequest("http://localhost/callback", testUser)
+	require.NoError(t, err)
+	return request, sessionID
+}
+
+// responseToken is the token with the response to the request.
+func responseToken(t *testing.T, request protocol.AuthorizationRequestMessage) []byte {
+	t.Helper()
+	var payload map[string]any
+	require.NoError(t, json.Unmarshal([]byte(testPayload), &payload))
+	payload["thid"] = request.ThreadID
+	b, err := json.Marshal(payload)
+	require.NoError(t, err)
+	return []byte(compactToken(testHeader, string(b), testProof))
+}
+
+func TestVerify_SingleUse(t *testing.T) {
+	verifier := &fakeVerifier{}
+	a := NewAuthenticationService(verifier)
+	request, sessionID := newRequest(t, a)
+	token := responseToken(t, request)
+
+	_, err := a.AuthenticationRequestStatus(context.Background(), sessionID)
+	require.ErrorIs(t, err, ErrSessionPending)
+
+	userID, err := a.Verify(context.Background(), sessionID, token)
+	require.NoError(t, err)
+	require.Equal(t, testUser, userID)
+
+	_, err = a.Verify(context.Background(), sessionID, token)
+	require.ErrorIs(t, err, ErrSessionUsed)
+	require.EqualValues(t, 1, verifier.calls.Load())
+
+	userID, err = a.AuthenticationRequestStatus(context.Background(), sessionID)
+	require.NoError(t, err)
+	require.Equal(t, testUser, userID)
+}
+
+func TestVerify_Concurrent(t *testing.T) {
+	verifier := &fakeVerifier{release: make(chan struct{})}
+	a := NewAuthenticationService(verifier)
+	request, sessionID := newRequest(t, a)
+	token := responseToken(t, request)
+
+	const attempts = 10
+	var (
+		wg        sync.WaitGroup
+		succeeded atomic.Int32
+		used      atomic.Int32
+	)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := a.Verify(context.Background(), sessionID, token)
+			switch {
+			case err == nil:
+				succeeded.Add(1)
+			case errors.Is(err, ErrSessionUsed):
+				used.Add(1)
+			}
+		}()
+	}
+	require.Eventually(t, func() bool {
+		return used.Load() == attempts-1
+	}, time.Second, time.Millisecond)
+	close(verifier.release)
+	wg.Wait()
+
+	require.EqualValues(t, 1, succeeded.Load())
+	require.EqualValues(t, 1, verifier.calls.Load())
+}
+
+func TestVerify_FailureReleasesSession(t *testing.T) {
+	verifier := &fakeVerifier{err: errors.New("state is not found")}
+	a := NewAuthenticationService(verifier)
+	request, sessionID := newRequest(t, a)
+	token := responseToken(t, request)
+
+	_, err := a.Verify(context.Background(), sessionID, token)
+	require.ErrorIs(t, err, ErrProofInvalid)
+
+	verifier.err = nil
+	userID, err := a.Verify(context.Background(), sessionID, token)
+	require.NoError(t, err)
+	require.Equal(t, testUser, userID)
+}
+
+func TestVerify_UnavailableIsNotInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"state", errors.Wrap(stateresolver.ErrUnavailable, "context deadline exceeded")},
+		{"key", errors.Wrap(ErrKeyUnavailable, "no such file or directory")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := &fakeVerifier{err: tt.err}
+			a := NewAuthenticationService(verifier)
+			request, sessionID := newRequest(t, a)
+			token := responseToken(t, request)
+
+			_, err := a.Verify(context.Background(), sessionID, token)
+			require.ErrorIs(t, err, errors.Cause(tt.err))
+			require.NotErrorIs(t, err, ErrProofInvalid)
+
+			// the session is released for another attempt
+			verifier.err = nil
+			_, err = a.Verify(context.Background(), sessionID, token)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestVerify_ThreadIDs(t *testing.T) {
+	verifier := &fakeVerifier{}
+	a := NewAuthenticationService(verifier)
+	request, sessionID := newRequest(t, a)
+	other, otherSessionID := newRequest(t, a)
+
+	// the response to one request doesn't authenticate another session
+	_, err := a.Verify(context.Background(), otherSessionID, responseToken(t, request))
+	require.ErrorIs(t, err, ErrProofInvalid)
+	require.Zero(t, verifier.calls.Load())
+
+	_, err = a.Verify(context.Background(), sessionID, responseToken(t, request))
+	require.NoError(t, err)
+
+	// a request that reuses a thread ID is rejected
+	other.ThreadID = request.ThreadID
+	sess, _ := a.sessions.get(otherSessionID)
+	sess.request = other
+	a.sessions.cache.SetDefault(otherSessionID, sess)
+	_, err = a.Verify(context.Background(), otherSessionID, responseToken(t, other))
+	require.ErrorIs(t, err, ErrThreadIDReused)
+	_, err = a.AuthenticationRequestStatus(context.Background(), otherSessionID)
+	require.ErrorIs(t, err, ErrSessionPending)
+}
+
+func TestNewAuthenticationRequest_SessionIDCollision(t *testing.T) {
+	a := NewAuthenticationService(&fakeVerifier{})
+	request, sessionID := newRequest(t, a)
+
+	// a colliding ID doesn't replace the session of another user
+	a.newID = func() string { return sessionID }
+	_, _, err := a.NewAuthenticationRequest("http://localhost/callback", testUser)
+	require.ErrorIs(t, err, ErrSessionExists)
+	sess, found := a.sessions.get(sessionID)
+	require.True(t, found)
+	require.Equal(t, request.ThreadID, sess.request.ThreadID)
+}
+
+func TestVerify_MaxAge(t *testing.T) {
+	now := time.Now()
+	a := NewAuthenticationService(&fakeVerifier{}, WithMaxAge(time.Minute))
+	a.now = func() time.Time { return now }
+	request, sessionID := newRequest(t, a)
+
+	now = now.Add(time.Minute + time.Second)
+	_, err := a.Verify(context.Background(), sessionID, responseToken(t, request))
+	require.ErrorIs(t, err, ErrSessionExpired)
+	require.Contains(t, err.Error(), "max age is 1m0s")
+}
+
+func TestVerify_MalformedToken(t *testing.T) {
+	verifier := &fakeVerifier{}
+	a := NewAuthenticationService(verifier)
+	_, sessionID := newRequest(t, a)
+
+	_, err := a.Verify(context.Background(), sessionID, []byte("token"))
+	require.ErrorIs(t, err, ErrTokenMalformed)
+	require.Zero(t, verifier.calls.Load())
+}
+
+func TestDrain_WaitsForPendingSessions(t *testing.T) {
+	a := NewAuthenticationService(&fakeVerifier{}, WithGracePeriod(time.Minute))
+	request, sessionID := newRequest(t, a)
+
+	drained := make(chan error, 1)
+	go func() {
+		drained <- a.Drain(context.Background())
+	}()
+	require.Eventually(t, a.draining.Load, time.Second, 10*time.Millisecond)
+	_, _, err := a.NewAuthenticationRequest("http://localhost/callback", testUser)
+	require.ErrorIs(t, err, ErrShuttingDown)
+
+	// the callback of the pending session is still verified
+	select {
+	case <-drained:
+		t.Fatal("drain returned with a pending session")
+	case <-time.After(2 * drainInterval):
+	}
+	_, err = a.Verify(context.Background(), sessionID, responseToken(t, request))
+	require.NoError(t, err)
+	require.NoError(t, <-drained)
+}
+
+func TestDrain_StopsAfterGracePeriod(t *testing.T) {
+	a := NewAuthenticationService(&fakeVerifier{}, WithGracePeriod(50*time.Millisecond))
+	newRequest(t, a)
+
+	start := time.Now()
+	require.NoError(t, a.Drain(context.Background()))
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestShutdown_HandsOffSessions(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store, err := NewRedisStore("redis://" + mr.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Shutdown(context.Background()) })
+
+	old := NewAuthenticationService(&fakeVerifier{}, WithSharedStore(store))
+	request, pendingID := newRequest(t, old)
+	authenticated, authenticatedID := newRequest(t, old)
+	_, err = old.Verify(context.Background(), authenticatedID, responseToken(t, authenticated))
+	require.NoError(t, err)
+	require.NoError(t, old.Shutdown(context.Background()))
+
+	next := NewAuthenticationService(&fakeVerifier{}, WithSharedStore(store))
+	userID, err := next.AuthenticationRequestStatus(context.Background(), authenticatedID)
+	require.NoError(t, err)
+	require.Equal(t, testUser, userID)
+
+	userID, err = next.Verify(context.Background(), pendingID, responseToken(t, request))
+	require.NoError(t, err)
+	require.Equal(t, testUser, userID)
+
+	// a session is verified by one instance only
+	other := NewAuthenticationService(&fakeVerifier{}, WithSharedStore(store))
+	_, err = other.Verify(context.Background(), pendingID, responseToken(t, request))
+	require.ErrorIs(t, err, ErrSessionUsed)
+}
+
+func TestRedisStore_PutKeepsExistingSession(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store, err := NewRedisStore("redis://" + mr.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Shutdown(context.Background()) })
+
+	require.NoError(t, store.Put(context.Background(), "1", []byte("first"), time.Minute))
+	err = store.Put(context.Background(), "1", []byte("second"), time.Minute)
+	require.ErrorIs(t, err, ErrSessionExists)
+	data, err := store.Get(context.Background(), "1")
+	require.NoError(t, err)
+	require.Equal(t, "first", string(data))
+}
+
+func TestShutdown_PollAndCallbackOnOtherInstances(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store, err := NewRedisStore("redis://" + mr.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Shutdown(context.Background()) })
+
+	old := NewAuthenticationService(&fakeVerifier{}, WithSharedStore(store))
+	request, sessionID := newRequest(t, old)
+	require.NoError(t, old.Shutdown(context.Background()))
+
+	// the status polls go to one instance, the callback to another
+	polled := NewAuthenticationService(&fakeVerifier{}, WithSharedStore(store))
+	called := NewAuthenticationService(&fakeVerifier{}, WithSharedStore(store))
+
+	_, err = polled.AuthenticationRequestStatus(context.Background(), sessionID)
+	require.ErrorIs(t, err, ErrSessionPending)
+	_, err = polled.AuthenticationRequestStatus(context.Background(), sessionID)
+	require.ErrorIs(t, err, ErrSessionPending)
+
+	// a failed verification releases the session for another attempt
+	failing := NewAuthenticationService(&fakeVerifier{err: errors.New("invalid proof")}, WithSharedStore(store))
+	_, err = failing.Verify(context.Background(), sessionID, responseToken(t, request))
+	require.ErrorIs(t, err, ErrProofInvalid)
+	_, err = polled.AuthenticationRequestStatus(context.Background(), sessionID)
+	require.ErrorIs(t, err, ErrSessionPending)
+
+	userID, err := called.Verify(context.Background(), sessionID, responseToken(t, request))
+	require.NoError(t, err)
+	require.Equal(t, testUser, userID)
+
+	userID, err = polled.AuthenticationRequestStatus(context.Background(), sessionID)
+	require.NoError(t, err)
+	require.Equal(t, testUser, userID)
+
+	_, err = polled.Verify(context.Background(), sessionID, responseToken(t, request))
+	require.ErrorIs(t, err, ErrSessionUsed)
+}
@@ -0,0 +1,91 @@
+package authentication
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/iden3/go-circuits/v2"
+	"github.com/iden3/go-iden3-auth/v2/loaders"
+	"github.com/pkg/errors"
+)
+
+// ErrKeyUnavailable is returned when a verification key fails to load,
+// e.g. its file is missing, which is not a fault of the proof.
+var ErrKeyUnavailable = errors.New("verification key is unavailable")
+
+// CheckVerificationKey checks that the verification key of the authV2
+// circuit loads, e.g. for the readiness, since the responses can't be
+// verified without it.
+func CheckVerificationKey(loader loaders.VerificationKeyLoader) error {
+	key, err := loader.Load(circuits.AuthV2CircuitID)
+	if err != nil {
+		return errors.Wrap(err, "failed to load the authV2 verification key")
+	}
+	if !json.Valid(key) {
+		return errors.New("the authV2 verification key is not JSON")
+	}
+	return nil
+}
+
+// KeyCache keeps the verification keys in memory, so that they are read
+// once, e.g. at the startup, instead of on every verification.
+type KeyCache struct {
+	loader loaders.VerificationKeyLoader
+
+	mu   sync.RWMutex
+	keys map[circuits.CircuitID][]byte
+}
+
+func NewKeyCache(loader loaders.VerificationKeyLoader) *KeyCache {
+	return &KeyCache{
+		loader: loader,
+		keys:   make(map[circuits.CircuitID][]byte),
+	}
+}
+
+func (c *KeyCache) Load(id circuits.CircuitID) ([]byte, error) {
+	c.mu.RLock()
+	key, ok := c.keys[id]
+	c.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	key, err := c.loader.Load(id)
+	if err != nil {
+		return nil, errors.Wrapf(ErrKeyUnavailable, "circuit %s: %v", id, err)
+	}
+	c.mu.Lock()
+	c.keys[id] = key
+	c.mu.Unlock()
+	return key, nil
+}
+
+// Preload loads the keys of the circuits into the cache.
+func (c *KeyCache) Preload(ids ...circuits.CircuitID) error {
+	for _, id := range ids {
+		if _, err := c.Load(id); err != nil {
+			return errors.Wrapf(err, "failed to load the %s verification key", id)
+		}
+	}
+	return nil
+}
+
+// CircuitKeys returns authV2 and the other circuits
+// with a verification key in the directory.
+func CircuitKeys(dir string) ([]circuits.CircuitID, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read the keys directory '%s'", dir)
+	}
+	ids := []circuits.CircuitID{circuits.AuthV2CircuitID}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() || circuits.CircuitID(name) == circuits.AuthV2CircuitID {
+			continue
+		}
+		ids = append(ids, circuits.CircuitID(name))
+	}
+	return ids, nil
+}
@@ -0,0 +1,55 @@
+package authentication
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iden3/go-circuits/v2"
+	"github.com/iden3/go-iden3-auth/v2/loaders"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckVerificationKey(t *testing.T) {
+	dir := t.TempDir()
+	loader := loaders.FSKeyLoader{Dir: dir}
+	require.Error(t, CheckVerificationKey(loader))
+
+	path := filepath.Join(dir, "authV2.json")
+	require.NoError(t, os.WriteFile(path, []byte("not a key"), 0o600))
+	require.Error(t, CheckVerificationKey(loader))
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"protocol":"groth16"}`), 0o600))
+	require.NoError(t, CheckVerificationKey(loader))
+}
+
+// countingLoader counts the loads of the keys.
+type countingLoader struct {
+	loads int
+}
+
+func (l *countingLoader) Load(circuits.CircuitID) ([]byte, error) {
+	l.loads++
+	return []byte(`{}`), nil
+}
+
+func TestKeyCache(t *testing.T) {
+	loader := &countingLoader{}
+	cache := NewKeyCache(loader)
+	require.NoError(t, cache.Preload(circuits.AuthV2CircuitID, circuits.AtomicQueryV3CircuitID))
+	_, err := cache.Load(circuits.AuthV2CircuitID)
+	require.NoError(t, err)
+	require.Equal(t, 2, loader.loads)
+
+	require.Error(t, NewKeyCache(loaders.FSKeyLoader{Dir: t.TempDir()}).Preload(circuits.AuthV2CircuitID))
+}
+
+func TestCircuitKeys(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"authV2.json", "credentialAtomicQueryV3-beta.1.json", "README.md"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(`{}`), 0o600))
+	}
+	ids, err := CircuitKeys(dir)
+	require.NoError(t, err)
+	require.Equal(t, []circuits.CircuitID{circuits.AuthV2CircuitID, "credentialAtomicQueryV3-beta.1"}, ids)
+}
@@ -0,0 +1,139 @@
+package authentication
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/iden3/iden3comm/v2/protocol"
+	"github.com/patrickmn/go-cache"
+	"github.com/pkg/errors"
+)
+
+type sessionState int
+
+const (
+	statePending sessionState = iota
+	// stateVerifying is the state while a response is verified,
+	// other responses to the request are rejected meanwhile.
+	stateVerifying
+	stateAuthenticated
+)
+
+type session struct {
+	request   protocol.AuthorizationRequestMessage
+	createdAt time.Time
+	state     sessionState
+	userID    string
+}
+
+// sessionStore keeps the sessions by ID. The changes of a session
+// state are compare-and-set, so a request is verified only once.
+type sessionStore struct {
+	mu    sync.Mutex
+	cache *cache.Cache
+}
+
+func newSessionStore(ttl time.Duration) *sessionStore {
+	return &sessionStore{cache: cache.New(ttl, ttl)}
+}
+
+func (s *sessionStore) get(id string) (session, bool) {
+	v, found := s.cache.Get(id)
+	if !found {
+		return session{}, false
+	}
+	return v.(session), true
+}
+
+// add keeps the new session. It returns ErrSessionExists when
+// there is another session with the ID, that is kept.
+func (s *sessionStore) add(id string, sess session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.cache.Add(id, sess, cache.DefaultExpiration); err != nil {
+		return errors.Wrapf(ErrSessionExists, "session '%s'", id)
+	}
+	return nil
+}
+
+// compareAndSwap moves the session from the old state to the new one.
+// It returns false when the session is not found or not in the old state.
+func (s *sessionStore) compareAndSwap(id string, old, state sessionState, userID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, found := s.get(id)
+	if !found || sess.state != old {
+		return false
+	}
+	sess.state = state
+	sess.userID = userID
+	s.cache.Set(id, sess, cache.DefaultExpiration)
+	return true
+}
+
+func (s *sessionStore) count() int {
+	return s.cache.ItemCount()
+}
+
+// pending returns the number of the sessions that wait for
+// a response, or whose response is verified now.
+func (s *sessionStore) pending(maxAge time.Duration, now time.Time) int {
+	n := 0
+	for _, item := range s.cache.Items() {
+		sess := item.Object.(session)
+		if sess.state == stateVerifying ||
+			sess.state == statePending && now.Sub(sess.createdAt) <= maxAge {
+			n++
+		}
+	}
+	return n
+}
+
+// items returns the sessions with their expiration time.
+func (s *sessionStore) items() map[string]expiringSession {
+	items := s.cache.Items()
+	sessions := make(map[string]expiringSession, len(items))
+	for id, item := range items {
+		sessions[id] = expiringSession{
+			session:   item.Object.(session),
+			expiresAt: time.Unix(0, item.Expiration),
+		}
+	}
+	return sessions
+}
+
+type expiringSession struct {
+	session
+	expiresAt time.Time
+}
+
+// storedSession is the session in the shared store.
+type storedSession struct {
+	Request   protocol.AuthorizationRequestMessage `json:"request"`
+	CreatedAt time.Time                            `json:"createdAt"`
+	State     sessionState                         `json:"state"`
+	UserID    string                               `json:"userId,omitempty"`
+}
+
+func marshalSession(sess session) ([]byte, error) {
+	return json.Marshal(storedSession{
+		Request:   sess.request,
+		CreatedAt: sess.createdAt,
+		State:     sess.state,
+		UserID:    sess.userID,
+	})
+}
+
+func unmarshalSession(data []byte) (session, error) {
+	var stored storedSession
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return session{}, err
+	}
+	return session{
+		request:   stored.Request,
+		createdAt: stored.CreatedAt,
+		state:     stored.State,
+		userID:    stored.UserID,
+	}, nil
+}
@@ -0,0 +1,95 @@
+package authentication
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// SharedStore keeps the sessions handed off by the instances that shut down,
+// so that the other instances verify their callbacks and answer their status.
+// The state of a handed off session changes in the store only.
+type SharedStore interface {
+	// Put keeps the session until the ttl expires. It returns
+	// ErrSessionExists when there is another session with the ID.
+	Put(ctx context.Context, id string, data []byte, ttl time.Duration) error
+	// Get returns the session, or nil when it is not found.
+	Get(ctx context.Context, id string) ([]byte, error)
+	// CompareAndSwap replaces the session with data when it is still old,
+	// and keeps its expiration. It returns false when the session has
+	// changed or is gone.
+	CompareAndSwap(ctx context.Context, id string, old, data []byte) (bool, error)
+}
+
+// swapScript replaces the value atomically, so that only
+// one instance moves a session out of a state.
+var swapScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[2], 'KEEPTTL')
+	return 1
+end
+return 0
+`)
+
+// RedisStore keeps the handed off sessions in Redis.
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisStore creates the store from a redis:// or rediss:// url.
+func NewRedisStore(rawURL string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid redis url")
+	}
+	return &RedisStore{
+		client: redis.NewClient(opts),
+		prefix: "auth:session:",
+	}, nil
+}
+
+func (s *RedisStore) Put(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	added, err := s.client.SetNX(ctx, s.prefix+id, data, ttl).Result()
+	if err != nil {
+		return errors.Wrapf(err, "failed to put session '%s'", id)
+	}
+	if !added {
+		return errors.Wrapf(ErrSessionExists, "failed to put session '%s'", id)
+	}
+	return nil
+}
+
+func (s *RedisStore) Get(ctx context.Context, id string) ([]byte, error) {
+	data, err := s.client.Get(ctx, s.prefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get session '%s'", id)
+	}
+	return data, nil
+}
+
+func (s *RedisStore) CompareAndSwap(ctx context.Context, id string, old, data []byte) (bool, error) {
+	swapped, err := swapScript.Run(ctx, s.client, []string{s.prefix + id}, old, data).Int()
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to swap session '%s'", id)
+	}
+	return swapped == 1, nil
+}
+
+// Ping checks the connection, e.g. for the readiness.
+func (s *RedisStore) Ping(ctx context.Context) error {
+	if err := s.client.Ping(ctx).Err(); err != nil {
+		return errors.Wrap(err, "session store is unavailable")
+	}
+	return nil
+}
+
+// Shutdown closes the connections.
+func (s *RedisStore) Shutdown(_ context.Context) error {
+	return s.client.Close()
+}
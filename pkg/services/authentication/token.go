@@ -0,0 +1,61 @@
+package authentication
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/iden3/go-circuits/v2"
+	"github.com/iden3/go-jwz/v2"
+	"github.com/iden3/iden3comm/v2/protocol"
+	"github.com/pkg/errors"
+)
+
+var ErrTokenMalformed = errors.New("token is malformed")
+
+// ParseToken does the cheap checks of the JWZ token with the authorization
+// response, so that garbage is rejected before the proof verification,
+// that resolves the states on chain. The proof itself is not verified.
+func ParseToken(token string) (*jwz.Token, *protocol.AuthorizationResponseMessage, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, nil, errors.Wrap(ErrTokenMalformed, "empty token")
+	}
+
+	parsed, err := parseJWZ(token)
+	if err != nil {
+		return nil, nil, errors.Wrapf(ErrTokenMalformed, "%v", err)
+	}
+	if parsed.Alg != jwz.Groth16 {
+		return nil, nil, errors.Wrapf(ErrTokenMalformed, "unsupported alg '%s'", parsed.Alg)
+	}
+	if parsed.CircuitID != string(circuits.AuthV2CircuitID) {
+		return nil, nil, errors.Wrapf(ErrTokenMalformed, "unsupported circuit '%s'", parsed.CircuitID)
+	}
+	if parsed.ZkProof == nil || parsed.ZkProof.Proof == nil || len(parsed.ZkProof.PubSignals) == 0 {
+		return nil, nil, errors.Wrap(ErrTokenMalformed, "no proof")
+	}
+
+	var msg protocol.AuthorizationResponseMessage
+	if err := json.Unmarshal(parsed.GetPayload(), &msg); err != nil {
+		return nil, nil, errors.Wrapf(ErrTokenMalformed, "invalid payload: %v", err)
+	}
+	if msg.Type != protocol.AuthorizationResponseMessageType {
+		return nil, nil, errors.Wrapf(ErrTokenMalformed, "unexpected message type '%s'", msg.Type)
+	}
+	if msg.From == "" {
+		return nil, nil, errors.Wrap(ErrTokenMalformed, "no sender")
+	}
+	return parsed, &msg, nil
+}
+
+// parseJWZ recovers from the panics of jwz.Parse, that asserts
+// the types of the headers without checking them.
+func parseJWZ(token string) (parsed *jwz.Token, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid headers: %v", r)
+		}
+	}()
+	return jwz.Parse(token)
+}
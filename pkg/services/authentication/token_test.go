@@ -0,0 +1,61 @@
+package authentication
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testHeader  = `{"alg":"groth16","circuitId":"authV2","crit":["circuitId"],"typ":"application/iden3-zkp-json"}`
+	testPayload = `{"id":"1","typ":"application/iden3-zkp-json",` +
+		`"type":"https://iden3-communication.io/authorization/1.0/response","thid":"2",` +
+		`"from":"did:iden3:polygon:amoy:x6x5sor7zpxsu478u36QvEgaRUfPjmzqFo5PHHzbb","body":{}}`
+	testProof = `{"proof":{"pi_a":["1"],"pi_b":[["1"]],"pi_c":["1"],"protocol":"groth16"},"pub_signals":["1"]}`
+)
+
+func compactToken(parts ...string) string {
+	encoded := make([]string, len(parts))
+	for i, p := range parts {
+		encoded[i] = base64.RawURLEncoding.EncodeToString([]byte(p))
+	}
+	return strings.Join(encoded, ".")
+}
+
+func TestParseToken(t *testing.T) {
+	_, msg, err := ParseToken(compactToken(testHeader, testPayload, testProof))
+	require.NoError(t, err)
+	require.Equal(t, "did:iden3:polygon:amoy:x6x5sor7zpxsu478u36QvEgaRUfPjmzqFo5PHHzbb", msg.From)
+	require.Equal(t, "2", msg.ThreadID)
+}
+
+func TestParseToken_Malformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"empty", "  "},
+		{"not a token", "token"},
+		{"two segments", compactToken(testHeader, testPayload)},
+		{"not base64", "a.b.!"},
+		{"header is not json", compactToken("header", testPayload, testProof)},
+		{"no critical headers", compactToken(`{"alg":"groth16","circuitId":"authV2"}`, testPayload, testProof)},
+		{"no alg", compactToken(`{"circuitId":"authV2","crit":["circuitId"]}`, testPayload, testProof)},
+		{"alg is not a string", compactToken(`{"alg":1,"circuitId":"authV2","crit":["circuitId"]}`, testPayload, testProof)},
+		{"unsupported alg", compactToken(`{"alg":"plonk","circuitId":"authV2","crit":["circuitId"]}`, testPayload, testProof)},
+		{"unsupported circuit", compactToken(`{"alg":"groth16","circuitId":"credentialAtomicQueryV3","crit":["circuitId"]}`, testPayload, testProof)},
+		{"no proof", compactToken(testHeader, testPayload, `{}`)},
+		{"payload is not json", compactToken(testHeader, "payload", testProof)},
+		{"not a response", compactToken(testHeader, strings.Replace(testPayload, "1.0/response", "1.0/request", 1), testProof)},
+		{"no sender", compactToken(testHeader, strings.Replace(testPayload, `"from"`, `"to"`, 1), testProof)},
+		{"full serialization without payload", `{"protected":"e30"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ParseToken(tt.token)
+			require.ErrorIs(t, err, ErrTokenMalformed)
+		})
+	}
+}
@@ -2,20 +2,423 @@ package issuer
 
 import (
 	"context"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	stateabi "github.com/iden3/contracts-abi/state/go/abi"
+	core "github.com/iden3/go-iden3-core/v2"
+	"github.com/iden3/go-iden3-core/v2/w3c"
+	"github.com/iden3/go-service-template/pkg/contracts/onchainissuer"
+	"github.com/iden3/go-service-template/pkg/ethrpc"
+	"github.com/iden3/go-service-template/pkg/indexer"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrIssuerNotFound   = errors.New("issuer not found")
+	ErrInvalidIssuerDID = errors.New("invalid issuer did")
+	ErrUnsupportedChain = errors.New("unsupported chain")
+	ErrInvalidState     = errors.New("invalid state")
+	ErrStateNotFound    = errors.New("state not found")
+	ErrInvalidPage      = errors.New("invalid page")
+	// ErrUnavailable is returned when the contracts can't be read,
+	// e.g. the rpc timed out.
+	ErrUnavailable = errors.New("chain is unavailable")
 )
 
+const (
+	defaultEventsLimit = 50
+	maxEventsLimit     = 500
+)
+
+type EventStore interface {
+	Events(ctx context.Context, issuerDID string, offset, limit int) ([]indexer.Event, int, error)
+}
+
+// PublishedState is the latest state published by the issuer contract.
+type PublishedState struct {
+	State           string `json:"state"`
+	ClaimsRoot      string `json:"claimsRoot"`
+	RevocationsRoot string `json:"revocationsRoot"`
+	RootsRoot       string `json:"rootsRoot"`
+}
+
+// StateContractInfo is the view of the issuer state in the global State contract.
+type StateContractInfo struct {
+	Address             string `json:"address"`
+	State               string `json:"state"`
+	ReplacedByState     string `json:"replacedByState"`
+	CreatedAtTimestamp  string `json:"createdAtTimestamp"`
+	ReplacedAtTimestamp string `json:"replacedAtTimestamp"`
+	CreatedAtBlock      string `json:"createdAtBlock"`
+	ReplacedAtBlock     string `json:"replacedAtBlock"`
+}
+
+type IssuerState struct {
+	DID           string             `json:"did"`
+	ChainID       int                `json:"chainId"`
+	Contract      string             `json:"contract"`
+	Latest        PublishedState     `json:"latest"`
+	StateContract *StateContractInfo `json:"stateContract"`
+	// Consistent is true when the published roots hash to the latest state
+	// published by the issuer contract, and it is the latest state of the
+	// issuer in the global State contract.
+	Consistent bool `json:"consistent"`
+}
+
+type IssuerRoots struct {
+	DID             string             `json:"did"`
+	State           string             `json:"state"`
+	ClaimsRoot      string             `json:"claimsRoot"`
+	RevocationsRoot string             `json:"revocationsRoot"`
+	RootsRoot       string             `json:"rootsRoot"`
+	StateContract   *StateContractInfo `json:"stateContract"`
+	// Latest is true when the requested state was not replaced yet.
+	Latest bool `json:"latest"`
+}
+
+type IssuerEvents struct {
+	Events []indexer.Event `json:"events"`
+	Total  int             `json:"total"`
+	Offset int             `json:"offset"`
+	Limit  int             `json:"limit"`
+}
+
+// Metadata is the description of the issuer from the configuration.
+type Metadata struct {
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type IssuerInfo struct {
+	DID      string `json:"did"`
+	ChainID  int    `json:"chainId"`
+	Contract string `json:"contract"`
+	Metadata
+}
+
+// catalog is the set of the issuers and the chains they are on.
+// It is replaced as a whole on a config reload.
+type catalog struct {
+	issuers        []string
+	backends       map[string]bind.ContractCaller
+	stateContracts map[string]string
+	metadata       map[string]Metadata
+}
+
+func (c *catalog) has(issuerDID string) bool {
+	for _, i := range c.issuers {
+		if i == issuerDID {
+			return true
+		}
+	}
+	return false
+}
+
 type IssuerService struct {
-	issuers []string
+	catalog atomic.Pointer[catalog]
+	events  EventStore
+}
+
+type Option func(*catalog)
+
+// WithMetadata sets the metadata of the issuers by DID.
+func WithMetadata(metadata map[string]Metadata) Option {
+	return func(c *catalog) {
+		c.metadata = metadata
+	}
 }
 
 func NewIssuerService(
 	issuers []string,
+	backends map[string]bind.ContractCaller,
+	stateContracts map[string]string,
+	events EventStore,
+	opts ...Option,
 ) *IssuerService {
-	return &IssuerService{
-		issuers: issuers,
+	is := &IssuerService{
+		events: events,
 	}
+	is.Update(issuers, backends, stateContracts, opts...)
+	return is
+}
+
+// Update atomically replaces the issuers and the chains. Requests that
+// are in flight finish with the previous ones.
+func (is *IssuerService) Update(
+	issuers []string,
+	backends map[string]bind.ContractCaller,
+	stateContracts map[string]string,
+	opts ...Option,
+) {
+	c := &catalog{
+		issuers:        issuers,
+		backends:       backends,
+		stateContracts: stateContracts,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	is.catalog.Store(c)
 }
 
 func (is *IssuerService) GetIssuersList(_ context.Context) []string {
-	return is.issuers
+	return is.catalog.Load().issuers
+}
+
+func (is *IssuerService) GetIssuer(_ context.Context, issuerDID string) (*IssuerInfo, error) {
+	target, err := is.resolveIssuer(issuerDID)
+	if err != nil {
+		return nil, err
+	}
+	return &IssuerInfo{
+		DID:      issuerDID,
+		ChainID:  target.chainID,
+		Contract: target.contract.Hex(),
+		Metadata: target.metadata,
+	}, nil
+}
+
+func (is *IssuerService) GetIssuerState(ctx context.Context, issuerDID string) (*IssuerState, error) {
+	target, err := is.resolveIssuer(issuerDID)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &bind.CallOpts{Context: ctx}
+	caller := onchainissuer.NewIssuerCaller(target.contract, target.backend)
+	latestState, err := caller.GetLatestPublishedState(opts)
+	if err != nil {
+		return nil, issuerCallError(err)
+	}
+	claimsRoot, err := caller.GetLatestPublishedClaimsRoot(opts)
+	if err != nil {
+		return nil, issuerCallError(err)
+	}
+	revocationsRoot, err := caller.GetLatestPublishedRevocationsRoot(opts)
+	if err != nil {
+		return nil, issuerCallError(err)
+	}
+	rootsRoot, err := caller.GetLatestPublishedRootsRoot(opts)
+	if err != nil {
+		return nil, issuerCallError(err)
+	}
+
+	stateInfo, err := target.stateCaller.GetStateInfoById(opts, target.id.BigInt())
+	if err != nil {
+		return nil, callError(err, "failed to get state info from state contract")
+	}
+
+	// the state is the poseidon hash of the roots
+	rootsState, err := core.IdenState(claimsRoot, revocationsRoot, rootsRoot)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to hash the published roots")
+	}
+
+	return &IssuerState{
+		DID:      issuerDID,
+		ChainID:  target.chainID,
+		Contract: target.contract.Hex(),
+		Latest: PublishedState{
+			State:           latestState.String(),
+			ClaimsRoot:      claimsRoot.String(),
+			RevocationsRoot: revocationsRoot.String(),
+			RootsRoot:       rootsRoot.String(),
+		},
+		StateContract: newStateContractInfo(target.stateContract, stateInfo),
+		Consistent:    rootsState.Cmp(latestState) == 0 && stateInfo.State.Cmp(latestState) == 0,
+	}, nil
+}
+
+func (is *IssuerService) GetRootsByState(ctx context.Context, issuerDID, state string) (*IssuerRoots, error) {
+	s, ok := new(big.Int).SetString(state, 0)
+	if !ok {
+		return nil, errors.Wrapf(ErrInvalidState, "'%s'", state)
+	}
+	// the state is a uint256 of the contracts, that can't be packed otherwise
+	if s.Sign() < 0 || s.BitLen() > 256 {
+		return nil, errors.Wrapf(ErrInvalidState, "'%s' is out of the uint256 range", state)
+	}
+	target, err := is.resolveIssuer(issuerDID)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &bind.CallOpts{Context: ctx}
+	roots, err := onchainissuer.NewIssuerCaller(target.contract, target.backend).
+		GetRootsByState(opts, s)
+	if err != nil {
+		return nil, issuerCallError(err)
+	}
+
+	stateInfo, err := target.stateCaller.GetStateInfoByIdAndState(opts, target.id.BigInt(), s)
+	if err != nil {
+		return nil, callError(err, "failed to get state info from state contract")
+	}
+
+	return &IssuerRoots{
+		DID:             issuerDID,
+		State:           s.String(),
+		ClaimsRoot:      roots.ClaimsRoot.String(),
+		RevocationsRoot: roots.RevocationsRoot.String(),
+		RootsRoot:       roots.RootsRoot.String(),
+		StateContract:   newStateContractInfo(target.stateContract, stateInfo),
+		Latest:          stateInfo.ReplacedAtTimestamp.Sign() == 0,
+	}, nil
+}
+
+// issuerCallError is the error of a call to the issuer contract,
+// that is not deployed when the address has no code.
+func issuerCallError(err error) error {
+	if errors.Is(err, bind.ErrNoCode) {
+		return errors.Wrapf(ErrIssuerNotFound, "%v", err)
+	}
+	return callError(err, "failed to call the issuer contract")
+}
+
+// callError tells a revert, e.g. of a state that was never published,
+// from a failure to reach the chain.
+func callError(err error, msg string) error {
+	if ethrpc.IsRevert(err) {
+		return errors.Wrapf(ErrStateNotFound, "%s: %v", msg, err)
+	}
+	if errors.Is(err, bind.ErrNoCode) {
+		return errors.Wrap(err, msg)
+	}
+	return errors.Wrapf(ErrUnavailable, "%s: %v", msg, err)
+}
+
+// GetIssuerEvents returns a page of indexed issuer events.
+// Zero limit means the default page size.
+func (is *IssuerService) GetIssuerEvents(
+	ctx context.Context,
+	issuerDID string,
+	offset, limit int,
+) (*IssuerEvents, error) {
+	if !is.catalog.Load().has(issuerDID) {
+		return nil, errors.Wrapf(ErrIssuerNotFound, "'%s'", issuerDID)
+	}
+	if limit == 0 {
+		limit = defaultEventsLimit
+	}
+	if offset < 0 || limit < 0 || limit > maxEventsLimit {
+		return nil, errors.Wrapf(ErrInvalidPage, "offset %d, limit %d", offset, limit)
+	}
+
+	events, total, err := is.events.Events(ctx, issuerDID, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &IssuerEvents{
+		Events: events,
+		Total:  total,
+		Offset: offset,
+		Limit:  limit,
+	}, nil
+}
+
+// CheckContracts checks that the contract of every issuer is deployed
+// and reachable through the rpc of its chain, e.g. for the readiness.
+func (is *IssuerService) CheckContracts(ctx context.Context) error {
+	var failed []string
+	for _, issuerDID := range is.catalog.Load().issuers {
+		if err := is.checkContract(ctx, issuerDID); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", issuerDID, err))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("issuer contracts are unreachable: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func (is *IssuerService) checkContract(ctx context.Context, issuerDID string) error {
+	target, err := is.resolveIssuer(issuerDID)
+	if err != nil {
+		return err
+	}
+	code, err := target.backend.CodeAt(ctx, target.contract, nil)
+	if err != nil {
+		return err
+	}
+	if len(code) == 0 {
+		return errors.Errorf("no contract code at %s", target.contract.Hex())
+	}
+	return nil
+}
+
+type issuerTarget struct {
+	id            core.ID
+	chainID       int
+	contract      common.Address
+	backend       bind.ContractCaller
+	stateContract common.Address
+	stateCaller   *stateabi.StateCaller
+	metadata      Metadata
+}
+
+func (is *IssuerService) resolveIssuer(issuerDID string) (*issuerTarget, error) {
+	c := is.catalog.Load()
+	if !c.has(issuerDID) {
+		return nil, errors.Wrapf(ErrIssuerNotFound, "'%s'", issuerDID)
+	}
+
+	did, err := w3c.ParseDID(issuerDID)
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidIssuerDID, "'%s': %v", issuerDID, err)
+	}
+	id, err := core.IDFromDID(*did)
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidIssuerDID, "'%s': %v", issuerDID, err)
+	}
+	contract, err := core.EthAddressFromID(id)
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidIssuerDID, "'%s': %v", issuerDID, err)
+	}
+	chainID, err := core.ChainIDfromDID(*did)
+	if err != nil {
+		return nil, errors.Wrapf(ErrUnsupportedChain, "'%s': %v", issuerDID, err)
+	}
+
+	network := strconv.Itoa(int(chainID))
+	backend, ok := c.backends[network]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnsupportedChain, "no rpc for chain %s", network)
+	}
+	stateContract, ok := c.stateContracts[network]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnsupportedChain, "no state contract for chain %s", network)
+	}
+	stateAddress := common.HexToAddress(stateContract)
+	stateCaller, err := stateabi.NewStateCaller(stateAddress, backend)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create state contract caller")
+	}
+
+	return &issuerTarget{
+		id:            id,
+		chainID:       int(chainID),
+		contract:      common.Address(contract),
+		backend:       backend,
+		stateContract: stateAddress,
+		stateCaller:   stateCaller,
+		metadata:      c.metadata[issuerDID],
+	}, nil
+}
+
+func newStateContractInfo(address common.Address, info stateabi.IStateStateInfo) *StateContractInfo {
+	return &StateContractInfo{
+		Address:             address.Hex(),
+		State:               info.State.String(),
+		ReplacedByState:     info.ReplacedByState.String(),
+		CreatedAtTimestamp:  info.CreatedAtTimestamp.String(),
+		ReplacedAtTimestamp: info.ReplacedAtTimestamp.String(),
+		CreatedAtBlock:      info.CreatedAtBlock.String(),
+		ReplacedAtBlock:     info.ReplacedAtBlock.String(),
+	}
 }
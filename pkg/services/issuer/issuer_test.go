@@ -0,0 +1,309 @@
+package issuer_test
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	stateabi "github.com/iden3/contracts-abi/state/go/abi"
+	core "github.com/iden3/go-iden3-core/v2"
+	"github.com/iden3/go-service-template/pkg/contracts/onchainissuer"
+	"github.com/iden3/go-service-template/pkg/services/issuer"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testIssuer        = "did:iden3:polygon:amoy:x6x5sor7zpxfsYHpbTierJwS9WhUu3FGiG93H18rq"
+	testStateContract = "0x1a4cC30f2aA0377b0c3bc9848766D90cb4404124"
+)
+
+// revertError is the JSON-RPC error of a reverted call.
+type revertError struct {
+	reason string
+}
+
+func (e revertError) Error() string  { return "execution reverted: " + e.reason }
+func (e revertError) ErrorCode() int { return 3 }
+
+// fakeCaller answers the calls of the issuer and the State contracts
+// by method name. A method without a result returns no output, like
+// an address without a contract.
+type fakeCaller struct {
+	results map[string][]interface{}
+	errs    map[string]error
+	noCode  bool
+}
+
+func (c *fakeCaller) CodeAt(context.Context, common.Address, *big.Int) ([]byte, error) {
+	if c.noCode {
+		return nil, nil
+	}
+	return []byte{1}, nil
+}
+
+func (c *fakeCaller) CallContract(_ context.Context, call ethereum.CallMsg, _ *big.Int) ([]byte, error) {
+	method, err := methodByID(call.Data[:4])
+	if err != nil {
+		return nil, err
+	}
+	if err := c.errs[method.Name]; err != nil {
+		return nil, err
+	}
+	out, ok := c.results[method.Name]
+	if !ok {
+		return nil, nil
+	}
+	return method.Outputs.Pack(out...)
+}
+
+func methodByID(id []byte) (*abi.Method, error) {
+	stateABI, err := stateabi.StateMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range []*abi.ABI{&onchainissuer.ABI, stateABI} {
+		for _, m := range a.Methods {
+			if bytes.Equal(m.ID, id) {
+				m := m
+				return &m, nil
+			}
+		}
+	}
+	return nil, errors.Errorf("unknown method %x", id)
+}
+
+func stateInfo(state, replacedAt int64) stateabi.IStateStateInfo {
+	return stateabi.IStateStateInfo{
+		Id:                  big.NewInt(1),
+		State:               big.NewInt(state),
+		ReplacedByState:     big.NewInt(0),
+		CreatedAtTimestamp:  big.NewInt(1),
+		ReplacedAtTimestamp: big.NewInt(replacedAt),
+		CreatedAtBlock:      big.NewInt(1),
+		ReplacedAtBlock:     big.NewInt(0),
+	}
+}
+
+// published is the issuer contract with the roots 1, 2, 3 and their state.
+func published(t *testing.T) (*big.Int, map[string][]interface{}) {
+	t.Helper()
+	state, err := core.IdenState(big.NewInt(1), big.NewInt(2), big.NewInt(3))
+	require.NoError(t, err)
+	return state, map[string][]interface{}{
+		"getLatestPublishedState":           {state},
+		"getLatestPublishedClaimsRoot":      {big.NewInt(1)},
+		"getLatestPublishedRevocationsRoot": {big.NewInt(2)},
+		"getLatestPublishedRootsRoot":       {big.NewInt(3)},
+	}
+}
+
+func newService(caller bind.ContractCaller) *issuer.IssuerService {
+	return issuer.NewIssuerService(
+		[]string{testIssuer},
+		map[string]bind.ContractCaller{"80002": caller},
+		map[string]string{"80002": testStateContract},
+		nil,
+	)
+}
+
+func TestGetIssuerState(t *testing.T) {
+	state, results := published(t)
+	with := func(overrides map[string][]interface{}) map[string][]interface{} {
+		r := make(map[string][]interface{}, len(results)+len(overrides))
+		for k, v := range results {
+			r[k] = v
+		}
+		for k, v := range overrides {
+			r[k] = v
+		}
+		return r
+	}
+	latest := stateabi.IStateStateInfo{
+		Id:                  big.NewInt(1),
+		State:               state,
+		ReplacedByState:     big.NewInt(0),
+		CreatedAtTimestamp:  big.NewInt(1),
+		ReplacedAtTimestamp: big.NewInt(0),
+		CreatedAtBlock:      big.NewInt(1),
+		ReplacedAtBlock:     big.NewInt(0),
+	}
+
+	tests := []struct {
+		name       string
+		caller     *fakeCaller
+		chain      string
+		err        error
+		consistent bool
+	}{
+		{
+			name:       "consistent",
+			caller:     &fakeCaller{results: with(map[string][]interface{}{"getStateInfoById": {latest}})},
+			consistent: true,
+		},
+		{
+			name:   "state contract is behind",
+			caller: &fakeCaller{results: with(map[string][]interface{}{"getStateInfoById": {stateInfo(1, 0)}})},
+		},
+		{
+			name: "roots don't hash to the state",
+			caller: &fakeCaller{results: with(map[string][]interface{}{
+				"getStateInfoById":            {latest},
+				"getLatestPublishedRootsRoot": {big.NewInt(4)},
+			})},
+		},
+		{
+			name: "no published state",
+			caller: &fakeCaller{
+				results: with(map[string][]interface{}{"getStateInfoById": {latest}}),
+				errs:    map[string]error{"getLatestPublishedState": revertError{"no state"}},
+			},
+			err: issuer.ErrStateNotFound,
+		},
+		{
+			name: "identity is not in the state contract",
+			caller: &fakeCaller{
+				results: results,
+				errs:    map[string]error{"getStateInfoById": revertError{"Identity does not exist"}},
+			},
+			err: issuer.ErrStateNotFound,
+		},
+		{
+			name:   "issuer contract is not deployed",
+			caller: &fakeCaller{noCode: true},
+			err:    issuer.ErrIssuerNotFound,
+		},
+		{
+			name: "rpc is down",
+			caller: &fakeCaller{
+				errs: map[string]error{"getLatestPublishedState": context.DeadlineExceeded},
+			},
+			err: issuer.ErrUnavailable,
+		},
+		{
+			name:   "unsupported chain",
+			caller: &fakeCaller{},
+			chain:  "21000",
+			err:    issuer.ErrUnsupportedChain,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := "80002"
+			if tt.chain != "" {
+				chain = tt.chain
+			}
+			s := issuer.NewIssuerService(
+				[]string{testIssuer},
+				map[string]bind.ContractCaller{chain: tt.caller},
+				map[string]string{chain: testStateContract},
+				nil,
+			)
+
+			got, err := s.GetIssuerState(context.Background(), testIssuer)
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.consistent, got.Consistent)
+			require.Equal(t, state.String(), got.Latest.State)
+		})
+	}
+}
+
+func TestGetRootsByState(t *testing.T) {
+	roots := onchainissuer.Roots{
+		ClaimsRoot:      big.NewInt(1),
+		RevocationsRoot: big.NewInt(2),
+		RootsRoot:       big.NewInt(3),
+	}
+
+	tests := []struct {
+		name   string
+		state  string
+		caller *fakeCaller
+		err    error
+		latest bool
+	}{
+		{
+			name:  "latest",
+			state: "7",
+			caller: &fakeCaller{results: map[string][]interface{}{
+				"getRootsByState":          {roots},
+				"getStateInfoByIdAndState": {stateInfo(7, 0)},
+			}},
+			latest: true,
+		},
+		{
+			name:  "replaced",
+			state: "0x7",
+			caller: &fakeCaller{results: map[string][]interface{}{
+				"getRootsByState":          {roots},
+				"getStateInfoByIdAndState": {stateInfo(7, 100)},
+			}},
+		},
+		{
+			name:  "unknown state",
+			state: "7",
+			caller: &fakeCaller{
+				errs: map[string]error{"getRootsByState": revertError{"Roots for this state doesn't exist"}},
+			},
+			err: issuer.ErrStateNotFound,
+		},
+		{
+			name:  "state is not in the state contract",
+			state: "7",
+			caller: &fakeCaller{
+				results: map[string][]interface{}{"getRootsByState": {roots}},
+				errs:    map[string]error{"getStateInfoByIdAndState": revertError{"State does not exist"}},
+			},
+			err: issuer.ErrStateNotFound,
+		},
+		{
+			name:  "rpc is down",
+			state: "7",
+			caller: &fakeCaller{
+				errs: map[string]error{"getRootsByState": errors.New("connection refused")},
+			},
+			err: issuer.ErrUnavailable,
+		},
+		{
+			name:   "invalid state",
+			state:  "seven",
+			caller: &fakeCaller{},
+			err:    issuer.ErrInvalidState,
+		},
+		{
+			name:   "negative state",
+			state:  "-7",
+			caller: &fakeCaller{},
+			err:    issuer.ErrInvalidState,
+		},
+		{
+			name:   "state over 256 bits",
+			state:  "0x1" + strings.Repeat("0", 64),
+			caller: &fakeCaller{},
+			err:    issuer.ErrInvalidState,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newService(tt.caller).GetRootsByState(context.Background(), testIssuer, tt.state)
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "7", got.State)
+			require.Equal(t, "3", got.RootsRoot)
+			require.Equal(t, tt.latest, got.Latest)
+		})
+	}
+}
@@ -1,24 +1,251 @@
 package system
 
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iden3/go-service-template/pkg/logger"
+)
+
+// The statuses of the checks and of the report.
+const (
+	StatusOK           = "ok"
+	StatusFailing      = "failing"
+	StatusPending      = "pending"
+	StatusUnavailable  = "unavailable"
+	StatusShuttingDown = "shutting_down"
+)
+
+// ReadyChecker is a dependency the service needs to serve the traffic.
 type ReadyChecker interface {
-	IsReady() bool
+	// Name identifies the check in the report, e.g. rpc:80002.
+	Name() string
+	CheckReady(ctx context.Context) error
+}
+
+type check struct {
+	name string
+	f    func(context.Context) error
+}
+
+// NewCheck makes a checker of the function.
+func NewCheck(name string, f func(context.Context) error) ReadyChecker {
+	return check{name: name, f: f}
+}
+
+func (c check) Name() string {
+	return c.name
+}
+
+func (c check) CheckReady(ctx context.Context) error {
+	return c.f(ctx)
+}
+
+// CheckStatus is the result of the last run of a check.
+type CheckStatus struct {
+	Name        string     `json:"name"`
+	Status      string     `json:"status"`
+	LatencyMs   float64    `json:"latencyMs"`
+	CheckedAt   *time.Time `json:"checkedAt,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// Report is the readiness with the breakdown by check.
+type Report struct {
+	Status string        `json:"status"`
+	Checks []CheckStatus `json:"checks"`
 }
 
+// ReadinessService runs the checks in the background, so that
+// the probes don't load the dependencies, and keeps their results.
 type ReadinessService struct {
-	toCheck []ReadyChecker
+	interval time.Duration
+	timeout  time.Duration
+
+	mu       sync.RWMutex
+	checkers []ReadyChecker
+	results  map[string]CheckStatus
+
+	shuttingDown atomic.Bool
+	trigger      chan struct{}
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+}
+
+type Option func(*ReadinessService)
+
+// WithCheckInterval sets how often the checks run.
+func WithCheckInterval(interval time.Duration) Option {
+	return func(s *ReadinessService) {
+		s.interval = interval
+	}
 }
 
-func NewReadinessService(toCheck ...ReadyChecker) *ReadinessService {
-	return &ReadinessService{
-		toCheck: toCheck,
+// WithCheckTimeout limits the time of a single check.
+func WithCheckTimeout(timeout time.Duration) Option {
+	return func(s *ReadinessService) {
+		s.timeout = timeout
 	}
 }
 
+func NewReadinessService(toCheck []ReadyChecker, opts ...Option) *ReadinessService {
+	s := &ReadinessService{
+		interval: 10 * time.Second,
+		timeout:  5 * time.Second,
+		results:  make(map[string]CheckStatus),
+		trigger:  make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.Update(toCheck...)
+	return s
+}
+
+// Update replaces the checks, e.g. after a config reload. The results
+// of the checks that are kept stay until the next run, which starts at once.
+func (s *ReadinessService) Update(toCheck ...ReadyChecker) {
+	s.mu.Lock()
+	results := make(map[string]CheckStatus, len(toCheck))
+	for _, c := range toCheck {
+		result, ok := s.results[c.Name()]
+		if !ok {
+			result = CheckStatus{Name: c.Name(), Status: StatusPending}
+		}
+		results[c.Name()] = result
+	}
+	s.checkers = toCheck
+	s.results = results
+	s.mu.Unlock()
+
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs the checks at once and then every interval.
+func (s *ReadinessService) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		s.run(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-s.trigger:
+			}
+			s.run(ctx)
+		}
+	}()
+}
+
+// run runs the checks at once and waits for them.
+func (s *ReadinessService) run(ctx context.Context) {
+	s.mu.RLock()
+	checkers := s.checkers
+	s.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, c := range checkers {
+		wg.Add(1)
+		go func(c ReadyChecker) {
+			defer wg.Done()
+			s.runCheck(ctx, c)
+		}(c)
+	}
+	wg.Wait()
+}
+
+func (s *ReadinessService) runCheck(ctx context.Context, c ReadyChecker) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	start := time.Now()
+	err := c.CheckReady(ctx)
+	latency := time.Since(start)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result, ok := s.results[c.Name()]
+	if !ok {
+		// the check was removed by an update meanwhile
+		return
+	}
+	result.LatencyMs = float64(latency.Microseconds()) / 1000
+	result.CheckedAt = &start
+	if err != nil {
+		if result.Status != StatusFailing {
+			logger.WithError(err).Warn("readiness check is failing", slog.String("check", c.Name()))
+		}
+		result.Status = StatusFailing
+		result.LastError = err.Error()
+		result.LastErrorAt = &start
+	} else {
+		if result.Status == StatusFailing {
+			logger.Info("readiness check recovered", slog.String("check", c.Name()))
+		}
+		result.Status = StatusOK
+	}
+	s.results[c.Name()] = result
+}
+
+// Shutdown stops the checks.
+func (s *ReadinessService) Shutdown(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SetShuttingDown reports the service as not ready from now on,
+// so that no new traffic is routed to it during the shutdown.
+func (s *ReadinessService) SetShuttingDown() {
+	s.shuttingDown.Store(true)
+}
+
+// IsReady is true when all the checks passed their last run.
 func (s *ReadinessService) IsReady() bool {
-	for _, c := range s.toCheck {
-		if !c.IsReady() {
-			return false
+	return s.Report().Status == StatusOK
+}
+
+// Report returns the results of the checks in the order they were added.
+func (s *ReadinessService) Report() Report {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	report := Report{
+		Status: StatusOK,
+		Checks: make([]CheckStatus, 0, len(s.checkers)),
+	}
+	for _, c := range s.checkers {
+		result := s.results[c.Name()]
+		if result.Status != StatusOK {
+			report.Status = StatusUnavailable
 		}
+		report.Checks = append(report.Checks, result)
+	}
+	if s.shuttingDown.Load() {
+		report.Status = StatusShuttingDown
 	}
-	return true
+	return report
 }
@@ -0,0 +1,105 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	if err := logger.SetDefaultLogger(logger.EnvDevelopment, slog.LevelError); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestReadiness_Report(t *testing.T) {
+	var failing atomic.Bool
+	s := NewReadinessService([]ReadyChecker{
+		NewCheck("rpc:80002", func(context.Context) error { return nil }),
+		NewCheck("session_store", func(context.Context) error {
+			if failing.Load() {
+				return errors.New("connection refused")
+			}
+			return nil
+		}),
+	})
+
+	// the checks that didn't run yet are pending
+	report := s.Report()
+	require.Equal(t, StatusUnavailable, report.Status)
+	require.Equal(t, StatusPending, report.Checks[0].Status)
+	require.False(t, s.IsReady())
+
+	s.run(context.Background())
+	require.True(t, s.IsReady())
+
+	failing.Store(true)
+	s.run(context.Background())
+	report = s.Report()
+	require.Equal(t, StatusUnavailable, report.Status)
+	require.Equal(t, "rpc:80002", report.Checks[0].Name)
+	require.Equal(t, StatusOK, report.Checks[0].Status)
+	require.Equal(t, StatusFailing, report.Checks[1].Status)
+	require.Equal(t, "connection refused", report.Checks[1].LastError)
+	require.NotNil(t, report.Checks[1].CheckedAt)
+
+	// the last error stays after the recovery
+	failing.Store(false)
+	s.run(context.Background())
+	report = s.Report()
+	require.Equal(t, StatusOK, report.Status)
+	require.Equal(t, "connection refused", report.Checks[1].LastError)
+}
+
+func TestReadiness_CheckTimeout(t *testing.T) {
+	s := NewReadinessService([]ReadyChecker{
+		NewCheck("rpc:80002", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+	}, WithCheckTimeout(10*time.Millisecond))
+
+	s.run(context.Background())
+	report := s.Report()
+	require.Equal(t, StatusFailing, report.Checks[0].Status)
+	require.Equal(t, context.DeadlineExceeded.Error(), report.Checks[0].LastError)
+}
+
+func TestReadiness_Update(t *testing.T) {
+	ok := func(context.Context) error { return nil }
+	s := NewReadinessService([]ReadyChecker{NewCheck("rpc:80002", ok), NewCheck("rpc:137", ok)})
+	s.run(context.Background())
+
+	s.Update(NewCheck("rpc:80002", ok), NewCheck("rpc:1", ok))
+	report := s.Report()
+	require.Len(t, report.Checks, 2)
+	require.Equal(t, StatusOK, report.Checks[0].Status)
+	require.Equal(t, "rpc:1", report.Checks[1].Name)
+	require.Equal(t, StatusPending, report.Checks[1].Status)
+}
+
+func TestReadiness_RunsInBackground(t *testing.T) {
+	var runs atomic.Int32
+	s := NewReadinessService([]ReadyChecker{
+		NewCheck("rpc:80002", func(context.Context) error {
+			runs.Add(1)
+			return nil
+		}),
+	}, WithCheckInterval(10*time.Millisecond))
+	s.Start()
+	require.Eventually(t, func() bool { return runs.Load() > 2 }, time.Second, 5*time.Millisecond)
+	require.True(t, s.IsReady())
+	require.NoError(t, s.Shutdown(context.Background()))
+
+	s.SetShuttingDown()
+	require.False(t, s.IsReady())
+	require.Equal(t, StatusShuttingDown, s.Report().Status)
+}
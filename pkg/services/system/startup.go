@@ -0,0 +1,152 @@
+package system
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iden3/go-service-template/pkg/logger"
+)
+
+// The statuses of the warm-up.
+const (
+	StatusStarting = "starting"
+	StatusStarted  = "started"
+	StatusRunning  = "running"
+	StatusFailed   = "failed"
+)
+
+// WarmUp is a step of the startup, e.g. loading the verification keys.
+type WarmUp struct {
+	Name string
+	Run  func(ctx context.Context) error
+	// Required steps are retried until they succeed, and the startup
+	// fails when one of them hasn't succeeded by the end of the warm-up.
+	Required bool
+}
+
+// StepStatus is the result of a warm-up step.
+type StepStatus struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	DurationMs float64 `json:"durationMs"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// StartupReport is the progress of the warm-up.
+type StartupReport struct {
+	Status string       `json:"status"`
+	Steps  []StepStatus `json:"steps"`
+}
+
+// StartupService runs the warm-up, so that the first requests don't
+// load the dependencies lazily, and reports when it has finished.
+type StartupService struct {
+	started atomic.Bool
+	failed  atomic.Bool
+	// retryInterval is the pause between the attempts of a required step
+	retryInterval time.Duration
+
+	mu    sync.RWMutex
+	steps []StepStatus
+}
+
+func NewStartupService() *StartupService {
+	return &StartupService{retryInterval: time.Second}
+}
+
+// Run runs the steps at once and waits for them. A failed optional step is
+// reported, and the dependency is loaded on its first use instead. The
+// startup fails when a required step hasn't succeeded before ctx is done.
+func (s *StartupService) Run(ctx context.Context, steps ...WarmUp) {
+	start := time.Now()
+	s.mu.Lock()
+	s.steps = make([]StepStatus, len(steps))
+	for i, step := range steps {
+		s.steps[i] = StepStatus{Name: step.Name, Status: StatusRunning}
+	}
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i, step := range steps {
+		wg.Add(1)
+		go func(i int, step WarmUp) {
+			defer wg.Done()
+			s.runStep(ctx, i, step)
+		}(i, step)
+	}
+	wg.Wait()
+
+	for i, step := range steps {
+		if step.Required && s.Report().Steps[i].Status != StatusOK {
+			s.failed.Store(true)
+		}
+	}
+	if s.failed.Load() {
+		logger.Error("warm-up failed", slog.Duration("duration", time.Since(start)))
+		return
+	}
+	s.started.Store(true)
+	logger.Info("warm-up finished", slog.Duration("duration", time.Since(start)))
+}
+
+func (s *StartupService) runStep(ctx context.Context, i int, step WarmUp) {
+	start := time.Now()
+	for {
+		err := step.Run(ctx)
+		duration := time.Since(start)
+		if err == nil {
+			logger.Info("warm-up step finished", slog.String("step", step.Name), slog.Duration("duration", duration))
+			s.setStep(i, StatusOK, duration, nil)
+			return
+		}
+		logger.WithError(err).Warn("warm-up step failed",
+			slog.String("step", step.Name), slog.Duration("duration", duration))
+		if !step.Required {
+			s.setStep(i, StatusFailed, duration, err)
+			return
+		}
+		// the last error is reported while the step is retried
+		s.setStep(i, StatusRunning, duration, err)
+		select {
+		case <-ctx.Done():
+			s.setStep(i, StatusFailed, duration, err)
+			return
+		case <-time.After(s.retryInterval):
+		}
+	}
+}
+
+func (s *StartupService) setStep(i int, status string, duration time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.steps[i].Status = status
+	s.steps[i].DurationMs = float64(duration.Microseconds()) / 1000
+	s.steps[i].Error = ""
+	if err != nil {
+		s.steps[i].Error = err.Error()
+	}
+}
+
+// IsStarted is true once the warm-up has finished, and all the required steps succeeded.
+func (s *StartupService) IsStarted() bool {
+	return s.started.Load()
+}
+
+func (s *StartupService) Report() StartupReport {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	report := StartupReport{
+		Status: StatusStarting,
+		Steps:  append([]StepStatus{}, s.steps...),
+	}
+	switch {
+	case s.started.Load():
+		report.Status = StatusStarted
+	case s.failed.Load():
+		report.Status = StatusFailed
+	}
+	return report
+}
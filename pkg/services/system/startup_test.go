@@ -0,0 +1,90 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartup_Run(t *testing.T) {
+	s := NewStartupService()
+	require.False(t, s.IsStarted())
+	require.Equal(t, StatusStarting, s.Report().Status)
+
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(context.Background(),
+			WarmUp{Name: "keys", Run: func(context.Context) error { return nil }},
+			WarmUp{Name: "rpc", Run: func(context.Context) error {
+				<-release
+				return errors.New("connection refused")
+			}},
+		)
+	}()
+
+	// the startup waits for all the steps
+	require.Eventually(t, func() bool {
+		return s.Report().Steps[0].Status == StatusOK
+	}, time.Second, 5*time.Millisecond)
+	require.False(t, s.IsStarted())
+	require.Equal(t, StatusRunning, s.Report().Steps[1].Status)
+
+	close(release)
+	<-done
+	require.True(t, s.IsStarted())
+	report := s.Report()
+	require.Equal(t, StatusStarted, report.Status)
+	require.Equal(t, StatusFailed, report.Steps[1].Status)
+	require.Equal(t, "connection refused", report.Steps[1].Error)
+}
+
+func TestStartup_RequiredStepIsRetried(t *testing.T) {
+	s := NewStartupService()
+	s.retryInterval = time.Millisecond
+
+	attempts := 0
+	s.Run(context.Background(), WarmUp{
+		Name: "rpc",
+		Run: func(context.Context) error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("connection refused")
+			}
+			return nil
+		},
+		Required: true,
+	})
+	require.True(t, s.IsStarted())
+	require.Equal(t, 3, attempts)
+	report := s.Report()
+	require.Equal(t, StatusStarted, report.Status)
+	require.Equal(t, StatusOK, report.Steps[0].Status)
+	require.Empty(t, report.Steps[0].Error)
+}
+
+func TestStartup_RequiredStepFails(t *testing.T) {
+	s := NewStartupService()
+	s.retryInterval = time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	s.Run(ctx,
+		WarmUp{Name: "keys", Run: func(context.Context) error { return nil }, Required: true},
+		WarmUp{
+			Name:     "rpc",
+			Run:      func(context.Context) error { return errors.New("connection refused") },
+			Required: true,
+		},
+	)
+	require.False(t, s.IsStarted())
+	report := s.Report()
+	require.Equal(t, StatusFailed, report.Status)
+	require.Equal(t, StatusOK, report.Steps[0].Status)
+	require.Equal(t, StatusFailed, report.Steps[1].Status)
+	require.Equal(t, "connection refused", report.Steps[1].Error)
+}
@@ -0,0 +1,139 @@
+package system
+
+import (
+	"log/slog"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// Dependencies are the modules whose versions are reported with the build.
+var Dependencies = []string{
+	"github.com/iden3/go-iden3-auth/v2",
+	"github.com/iden3/iden3comm/v2",
+}
+
+// revision is set by the builds without the VCS info, e.g. in docker, where
+// .git is not in the context: -ldflags "-X <package>.revision=<commit>".
+var revision string
+
+// BuildInfo identifies the build, from the info embedded by the Go toolchain.
+type BuildInfo struct {
+	Module       string            `json:"module"`
+	Version      string            `json:"version"`
+	Revision     string            `json:"revision,omitempty"`
+	RevisionTime string            `json:"revisionTime,omitempty"`
+	Dirty        bool              `json:"dirty"`
+	GoVersion    string            `json:"goVersion"`
+	Dependencies map[string]string `json:"dependencies"`
+}
+
+// ReadBuildInfo reads the build info of the binary. The VCS fields are
+// empty when the binary was built without them, e.g. by go run or go test.
+func ReadBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Revision:     revision,
+		GoVersion:    runtime.Version(),
+		Dependencies: make(map[string]string, len(Dependencies)),
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.Module = bi.Main.Path
+	info.Version = bi.Main.Version
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.time":
+			info.RevisionTime = s.Value
+		case "vcs.modified":
+			info.Dirty = s.Value == "true"
+		}
+	}
+	for _, dep := range bi.Deps {
+		for _, path := range Dependencies {
+			if dep.Path != path {
+				continue
+			}
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			info.Dependencies[path] = dep.Version
+		}
+	}
+	return info
+}
+
+// LogAttrs are the fields of the build for the startup log.
+func (b BuildInfo) LogAttrs() []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("version", b.Version),
+		slog.String("revision", b.Revision),
+		slog.Bool("dirty", b.Dirty),
+		slog.String("goVersion", b.GoVersion),
+	}
+	for _, path := range Dependencies {
+		attrs = append(attrs, slog.String(path, b.Dependencies[path]))
+	}
+	return attrs
+}
+
+// Deployment is what the running config enables.
+type Deployment struct {
+	Chains  []string `json:"chains"`
+	Issuers []string `json:"issuers"`
+}
+
+// RuntimeInfo is a snapshot of the Go runtime.
+type RuntimeInfo struct {
+	GOOS       string `json:"goos"`
+	GOARCH     string `json:"goarch"`
+	NumCPU     int    `json:"numCPU"`
+	GOMAXPROCS int    `json:"gomaxprocs"`
+	Goroutines int    `json:"goroutines"`
+}
+
+// Version is the build, the deployment and the uptime of the instance.
+type Version struct {
+	Build         BuildInfo   `json:"build"`
+	Deployment    Deployment  `json:"deployment"`
+	Runtime       RuntimeInfo `json:"runtime"`
+	StartedAt     time.Time   `json:"startedAt"`
+	UptimeSeconds float64     `json:"uptimeSeconds"`
+}
+
+type VersionService struct {
+	build      BuildInfo
+	startedAt  time.Time
+	deployment func() Deployment
+	now        func() time.Time
+}
+
+// NewVersionService creates the service. The deployment is read on every
+// call, so that it follows a reloaded config.
+func NewVersionService(build BuildInfo, deployment func() Deployment) *VersionService {
+	return &VersionService{
+		build:      build,
+		startedAt:  time.Now(),
+		deployment: deployment,
+		now:        time.Now,
+	}
+}
+
+func (s *VersionService) Version() Version {
+	return Version{
+		Build:      s.build,
+		Deployment: s.deployment(),
+		Runtime: RuntimeInfo{
+			GOOS:       runtime.GOOS,
+			GOARCH:     runtime.GOARCH,
+			NumCPU:     runtime.NumCPU(),
+			GOMAXPROCS: runtime.GOMAXPROCS(0),
+			Goroutines: runtime.NumGoroutine(),
+		},
+		StartedAt:     s.startedAt,
+		UptimeSeconds: s.now().Sub(s.startedAt).Round(time.Second).Seconds(),
+	}
+}
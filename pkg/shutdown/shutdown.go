@@ -2,58 +2,263 @@ package shutdown
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/pkg/errors"
 )
 
 type Shutdown interface {
 	Shutdown(context.Context) error
 }
 
+// Phase is a step of the shutdown. The phases run in order,
+// the services of a phase are shut down at once.
+type Phase int
+
+const (
+	// PhaseStopTraffic stops accepting the requests, e.g. the auth
+	// sessions are drained before the HTTP servers stop.
+	PhaseStopTraffic Phase = iota
+	// PhaseDrain finishes the work in flight, e.g. the auth sessions
+	// are handed off to the shared store.
+	PhaseDrain
+	// PhaseClose closes the stores and the clients.
+	PhaseClose
+	// PhaseTelemetry flushes the telemetry of the other phases.
+	PhaseTelemetry
+)
+
+var phaseNames = map[Phase]string{
+	PhaseStopTraffic: "stop traffic",
+	PhaseDrain:       "drain",
+	PhaseClose:       "close",
+	PhaseTelemetry:   "telemetry",
+}
+
+func (p Phase) String() string {
+	return phaseNames[p]
+}
+
+var phases = []Phase{PhaseStopTraffic, PhaseDrain, PhaseClose, PhaseTelemetry}
+
 type Manager struct {
-	closeTimeout time.Duration
-	services     []Shutdown
+	closeTimeout  time.Duration
+	phaseTimeouts map[Phase]time.Duration
+	stopDelay     time.Duration
+
+	hooks    []func()
+	services map[Phase][]Shutdown
 }
 
 type Option func(*Manager)
 
+// WithCloseTimeout limits the time of every phase. The services that
+// don't stop in time are reported, and the next phase starts.
 func WithCloseTimeout(timeout time.Duration) Option {
 	return func(s *Manager) {
 		s.closeTimeout = timeout
 	}
 }
 
+// WithPhaseTimeout limits the time of the phase instead of the close timeout.
+func WithPhaseTimeout(phase Phase, timeout time.Duration) Option {
+	return func(s *Manager) {
+		s.phaseTimeouts[phase] = timeout
+	}
+}
+
+// WithStopDelay sets how long the traffic is still served after the hooks,
+// so that the load balancers see the readiness change before the servers stop.
+func WithStopDelay(delay time.Duration) Option {
+	return func(s *Manager) {
+		s.stopDelay = delay
+	}
+}
+
 func NewManager(opts ...Option) *Manager {
 	m := &Manager{
-		closeTimeout: 5 * time.Second,
+		closeTimeout:  5 * time.Second,
+		phaseTimeouts: make(map[Phase]time.Duration),
+		services:      make(map[Phase][]Shutdown),
 	}
 	for _, opt := range opts {
 		opt(m)
 	}
-	return &Manager{}
+	return m
+}
+
+// OnShutdown adds a hook that runs before the phases,
+// e.g. to flip the readiness to false.
+func (m *Manager) OnShutdown(hook func()) {
+	m.hooks = append(m.hooks, hook)
+}
+
+// Register adds the services to the close phase.
+func (m *Manager) Register(service Shutdown) {
+	m.RegisterPhase(PhaseClose, service)
+}
+
+// RegisterPhase adds the services to the phase.
+func (m *Manager) RegisterPhase(phase Phase, services ...Shutdown) {
+	m.services[phase] = append(m.services[phase], services...)
+}
+
+// Shutdown runs the hooks and the phases in order. It returns an error that
+// names the services that failed to stop in time. The errors of the services
+// that stopped are logged.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	for _, hook := range m.hooks {
+		hook()
+	}
+	if m.stopDelay > 0 && len(m.services[PhaseStopTraffic]) > 0 {
+		logger.Info("waiting before stopping the traffic", slog.Duration("delay", m.stopDelay))
+		select {
+		case <-time.After(m.stopDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	var laggards []string
+	for _, phase := range phases {
+		laggards = append(laggards, m.shutdownPhase(ctx, phase)...)
+	}
+	if len(laggards) > 0 {
+		return errors.Errorf("services failed to stop in time: %s", strings.Join(laggards, ", "))
+	}
+	return nil
 }
 
-func (m *Manager) shutdown(ctx context.Context) {
-	var wg sync.WaitGroup
-	for _, service := range m.services {
+// shutdownPhase shuts the services of the phase down and returns the names
+// of the ones that didn't stop in time, either still running at the deadline
+// or given up on it.
+func (m *Manager) shutdownPhase(ctx context.Context, phase Phase) []string {
+	services := m.services[phase]
+	if len(services) == 0 {
+		return nil
+	}
+	timeout, ok := m.phaseTimeouts[phase]
+	if !ok {
+		timeout = m.closeTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		late = make([]bool, len(services))
+	)
+	// a service is late until it returns in time
+	for i := range late {
+		late[i] = true
+	}
+	for i, service := range services {
 		wg.Add(1)
-		go func(s Shutdown) {
+		go func(i int, s Shutdown) {
 			defer wg.Done()
-			if err := s.Shutdown(ctx); err != nil {
-				logger.WithError(err).Error("Error during shutdown")
+			err := s.Shutdown(ctx)
+			mu.Lock()
+			late[i] = errors.Is(err, context.DeadlineExceeded)
+			mu.Unlock()
+			if err != nil {
+				logger.WithError(err).Error("Error during shutdown",
+					slog.String("phase", phase.String()), slog.String("service", name(s)))
 			}
-		}(service)
+		}(i, service)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
 	}
-	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	var laggards []string
+	for i, s := range services {
+		if late[i] {
+			laggards = append(laggards, name(s))
+		}
+	}
+	if len(laggards) == 0 {
+		logger.Info("shutdown phase completed",
+			slog.String("phase", phase.String()), slog.Duration("duration", time.Since(start)))
+		return nil
+	}
+	logger.Error("services failed to stop in time",
+		slog.String("phase", phase.String()),
+		slog.Duration("timeout", timeout),
+		slog.Any("services", laggards))
+	return laggards
 }
 
-func (m *Manager) Register(service Shutdown) {
-	m.services = append(m.services, service)
+// name is the name of a fmt.Stringer service,
+// or else its type, e.g. *http.Group.
+func name(s Shutdown) string {
+	if stringer, ok := s.(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return fmt.Sprintf("%T", s)
+}
+
+type namedFunc struct {
+	name string
+	f    func(context.Context) error
+}
+
+// Func makes a service of the function, the name is reported
+// when it doesn't stop in time.
+func Func(name string, f func(context.Context) error) Shutdown {
+	return namedFunc{name: name, f: f}
+}
+
+func (n namedFunc) Shutdown(ctx context.Context) error {
+	return n.f(ctx)
+}
+
+func (n namedFunc) String() string {
+	return n.name
+}
+
+type sequence []Shutdown
+
+// Sequence shuts the services down one after another within a phase,
+// e.g. to drain the work before its listener stops. All the services
+// are shut down, the first error is returned.
+func Sequence(services ...Shutdown) Shutdown {
+	return sequence(services)
+}
+
+func (s sequence) Shutdown(ctx context.Context) error {
+	var first error
+	for _, service := range s {
+		if err := service.Shutdown(ctx); err != nil && first == nil {
+			first = errors.Wrap(err, name(service))
+		}
+	}
+	return first
+}
+
+func (s sequence) String() string {
+	names := make([]string, len(s))
+	for i, service := range s {
+		names[i] = name(service)
+	}
+	return strings.Join(names, " then ")
 }
 
 func (m *Manager) HandleShutdownSignal() {
@@ -61,6 +266,9 @@ func (m *Manager) HandleShutdownSignal() {
 	signal.Notify(stopChan, os.Interrupt, syscall.SIGTERM)
 	<-stopChan
 	logger.Info("Shutting down event received")
-	m.shutdown(context.Background())
+	if err := m.Shutdown(context.Background()); err != nil {
+		logger.WithError(err).Error("Shutdown completed with errors")
+		return
+	}
 	logger.Info("Shutdown completed")
 }
@@ -0,0 +1,150 @@
+package shutdown
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	if err := logger.SetDefaultLogger(logger.EnvDevelopment, slog.LevelError); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// recorder keeps the order of the shutdown calls.
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) add(call string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+func (r *recorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+type fakeService struct {
+	name     string
+	recorder *recorder
+	// block waits for the context instead of returning at once
+	block bool
+}
+
+func (s *fakeService) Shutdown(ctx context.Context) error {
+	if s.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	s.recorder.add(s.name)
+	return nil
+}
+
+// stuckService ignores the context of the shutdown.
+type stuckService struct {
+	release chan struct{}
+}
+
+func (s *stuckService) Shutdown(context.Context) error {
+	<-s.release
+	return nil
+}
+
+func TestNewManager_AppliesOptions(t *testing.T) {
+	m := NewManager(
+		WithCloseTimeout(time.Second),
+		WithPhaseTimeout(PhaseDrain, time.Minute),
+		WithStopDelay(time.Millisecond),
+	)
+	require.Equal(t, time.Second, m.closeTimeout)
+	require.Equal(t, time.Minute, m.phaseTimeouts[PhaseDrain])
+	require.Equal(t, time.Millisecond, m.stopDelay)
+}
+
+func TestManager_RunsPhasesInOrder(t *testing.T) {
+	r := &recorder{}
+	m := NewManager()
+	m.OnShutdown(func() { r.add("hook") })
+	m.RegisterPhase(PhaseTelemetry, &fakeService{name: "tracer", recorder: r})
+	m.Register(&fakeService{name: "store", recorder: r})
+	m.RegisterPhase(PhaseDrain, &fakeService{name: "sessions", recorder: r})
+	m.RegisterPhase(PhaseStopTraffic, &fakeService{name: "server", recorder: r})
+
+	require.NoError(t, m.Shutdown(context.Background()))
+	require.Equal(t, []string{"hook", "server", "sessions", "store", "tracer"}, r.get())
+}
+
+func TestManager_ReportsServicesStuckInPhase(t *testing.T) {
+	r := &recorder{}
+	stuck := &stuckService{release: make(chan struct{})}
+	defer close(stuck.release)
+
+	m := NewManager(WithCloseTimeout(20 * time.Millisecond))
+	m.Register(stuck)
+	m.Register(&fakeService{name: "store", recorder: r})
+	m.RegisterPhase(PhaseTelemetry, &fakeService{name: "tracer", recorder: r})
+
+	err := m.Shutdown(context.Background())
+	require.EqualError(t, err, "services failed to stop in time: *shutdown.stuckService")
+	// the next phases still run
+	require.Equal(t, []string{"store", "tracer"}, r.get())
+}
+
+func TestManager_PhaseTimeout(t *testing.T) {
+	m := NewManager(
+		WithCloseTimeout(time.Hour),
+		WithPhaseTimeout(PhaseDrain, 20*time.Millisecond),
+	)
+	m.RegisterPhase(PhaseDrain, &fakeService{name: "sessions", block: true})
+
+	start := time.Now()
+	err := m.Shutdown(context.Background())
+	require.EqualError(t, err, "services failed to stop in time: *shutdown.fakeService")
+	require.Less(t, time.Since(start), time.Minute)
+}
+
+func TestManager_StopDelay(t *testing.T) {
+	r := &recorder{}
+	m := NewManager(WithStopDelay(50 * time.Millisecond))
+	m.RegisterPhase(PhaseStopTraffic, &fakeService{name: "server", recorder: r})
+
+	start := time.Now()
+	require.NoError(t, m.Shutdown(context.Background()))
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	require.Equal(t, []string{"server"}, r.get())
+}
+
+func TestSequence(t *testing.T) {
+	r := &recorder{}
+	m := NewManager()
+	m.RegisterPhase(PhaseStopTraffic, Sequence(
+		Func("drain", func(context.Context) error {
+			time.Sleep(20 * time.Millisecond)
+			r.add("drain")
+			return nil
+		}),
+		&fakeService{name: "server", recorder: r},
+	))
+	require.NoError(t, m.Shutdown(context.Background()))
+	require.Equal(t, []string{"drain", "server"}, r.get())
+
+	stuck := &stuckService{release: make(chan struct{})}
+	defer close(stuck.release)
+	m = NewManager(WithCloseTimeout(20 * time.Millisecond))
+	m.Register(Sequence(Func("drain", func(context.Context) error { return nil }), stuck))
+	require.EqualError(t, m.Shutdown(context.Background()),
+		"services failed to stop in time: drain then *shutdown.stuckService")
+}
@@ -0,0 +1,131 @@
+package stateresolver
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/iden3/go-iden3-auth/v2/pubsignals"
+	"github.com/iden3/go-iden3-auth/v2/state"
+	"github.com/iden3/go-service-template/pkg/metrics"
+	"github.com/patrickmn/go-cache"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	statePrefix = "state:"
+	gistPrefix  = "gist:"
+
+	cacheLatest   = "latest"
+	cacheHistoric = "historic"
+)
+
+// CachingResolver caches resolved states. States that are latest may be
+// replaced at any moment, so they are kept for a shorter time than
+// historic states, which never change. The lookups are counted by
+// metrics.StateCacheLookups.
+type CachingResolver struct {
+	next     pubsignals.StateResolver
+	latest   *cache.Cache
+	historic *cache.Cache
+}
+
+func NewCachingResolver(
+	next pubsignals.StateResolver,
+	latestTTL, historicTTL time.Duration,
+) *CachingResolver {
+	return &CachingResolver{
+		next:     next,
+		latest:   cache.New(latestTTL, 2*latestTTL),
+		historic: cache.New(historicTTL, 2*historicTTL),
+	}
+}
+
+func (r *CachingResolver) Resolve(ctx context.Context, id, s *big.Int) (*state.ResolvedState, error) {
+	key := statePrefix + id.String() + ":" + s.String()
+	resolved, ok := r.get(key)
+	traceLookup(ctx, "state", ok)
+	if ok {
+		return resolved, nil
+	}
+	resolved, err := r.next.Resolve(ctx, id, s)
+	if err != nil {
+		return nil, err
+	}
+	r.set(key, resolved)
+	return resolved, nil
+}
+
+func (r *CachingResolver) ResolveGlobalRoot(ctx context.Context, s *big.Int) (*state.ResolvedState, error) {
+	key := gistPrefix + s.String()
+	resolved, ok := r.get(key)
+	traceLookup(ctx, "gist", ok)
+	if ok {
+		return resolved, nil
+	}
+	resolved, err := r.next.ResolveGlobalRoot(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	r.set(key, resolved)
+	return resolved, nil
+}
+
+// traceLookup adds the lookup to the span of the caller, as an event, since
+// a verification resolves several states. The missed states are resolved
+// in spans of the next resolver.
+func traceLookup(ctx context.Context, kind string, hit bool) {
+	trace.SpanFromContext(ctx).AddEvent("stateresolver.cache", trace.WithAttributes(
+		attribute.String("cache.kind", kind),
+		attribute.Bool("cache.hit", hit)))
+}
+
+// Invalidate drops the cached states of the identity,
+// e.g. after a state transition was observed.
+func (r *CachingResolver) Invalidate(id *big.Int) {
+	prefix := statePrefix + id.String() + ":"
+	for _, c := range []*cache.Cache{r.latest, r.historic} {
+		for key := range c.Items() {
+			if strings.HasPrefix(key, prefix) {
+				c.Delete(key)
+			}
+		}
+	}
+	// the global root changes with every state transition
+	for key := range r.latest.Items() {
+		if strings.HasPrefix(key, gistPrefix) {
+			r.latest.Delete(key)
+		}
+	}
+}
+
+func (r *CachingResolver) get(key string) (*state.ResolvedState, bool) {
+	c := cacheHistoric
+	v, ok := r.historic.Get(key)
+	if !ok {
+		c = cacheLatest
+		v, ok = r.latest.Get(key)
+	}
+	if !ok {
+		return nil, false
+	}
+	metrics.StateCacheLookups.WithLabelValues(c, metrics.CacheHit).Inc()
+	// callers get a copy, so that they can't change the cached value
+	resolved := *v.(*state.ResolvedState)
+	return &resolved, true
+}
+
+// set caches the state resolved after a miss, which is counted
+// by the cache the state goes to.
+func (r *CachingResolver) set(key string, resolved *state.ResolvedState) {
+	cached := *resolved
+	if cached.Latest {
+		metrics.StateCacheLookups.WithLabelValues(cacheLatest, metrics.CacheMiss).Inc()
+		r.latest.SetDefault(key, &cached)
+		return
+	}
+	metrics.StateCacheLookups.WithLabelValues(cacheHistoric, metrics.CacheMiss).Inc()
+	r.historic.SetDefault(key, &cached)
+}
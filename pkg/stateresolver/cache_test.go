@@ -0,0 +1,104 @@
+package stateresolver_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/iden3/go-iden3-auth/v2/state"
+	"github.com/iden3/go-service-template/pkg/metrics"
+	"github.com/iden3/go-service-template/pkg/stateresolver"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type countingResolver struct {
+	calls  int
+	latest bool
+}
+
+func (r *countingResolver) Resolve(_ context.Context, _, s *big.Int) (*state.ResolvedState, error) {
+	r.calls++
+	return &state.ResolvedState{State: s.String(), Latest: r.latest}, nil
+}
+
+func (r *countingResolver) ResolveGlobalRoot(_ context.Context, s *big.Int) (*state.ResolvedState, error) {
+	r.calls++
+	return &state.ResolvedState{State: s.String(), Latest: r.latest}, nil
+}
+
+func TestCachingResolverTTLs(t *testing.T) {
+	lookups := make(map[string]float64)
+	for _, c := range []string{"latest", "historic"} {
+		for _, result := range []string{metrics.CacheHit, metrics.CacheMiss} {
+			lookups[c+result] = testutil.ToFloat64(metrics.StateCacheLookups.WithLabelValues(c, result))
+		}
+	}
+
+	next := &countingResolver{latest: true}
+	r := stateresolver.NewCachingResolver(next, 10*time.Millisecond, time.Hour)
+	id, s := big.NewInt(1), big.NewInt(2)
+
+	for i := 0; i < 2; i++ {
+		if _, err := r.Resolve(context.Background(), id, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if next.calls != 1 {
+		t.Fatalf("expected 1 call, got %d", next.calls)
+	}
+
+	// latest state expires quickly
+	time.Sleep(20 * time.Millisecond)
+	next.latest = false
+	if _, err := r.Resolve(context.Background(), id, s); err != nil {
+		t.Fatal(err)
+	}
+	// historic state stays cached
+	if _, err := r.Resolve(context.Background(), id, s); err != nil {
+		t.Fatal(err)
+	}
+	if next.calls != 2 {
+		t.Fatalf("expected 2 calls, got %d", next.calls)
+	}
+
+	for _, tt := range []struct {
+		cache, result string
+		want          float64
+	}{
+		{"latest", metrics.CacheHit, 1},
+		{"latest", metrics.CacheMiss, 1},
+		{"historic", metrics.CacheHit, 1},
+		{"historic", metrics.CacheMiss, 1},
+	} {
+		got := testutil.ToFloat64(metrics.StateCacheLookups.WithLabelValues(tt.cache, tt.result)) - lookups[tt.cache+tt.result]
+		if got != tt.want {
+			t.Fatalf("expected %v %s %s lookups, got %v", tt.want, tt.cache, tt.result, got)
+		}
+	}
+}
+
+func TestCachingResolverInvalidate(t *testing.T) {
+	next := &countingResolver{}
+	r := stateresolver.NewCachingResolver(next, time.Hour, time.Hour)
+	id, s := big.NewInt(1), big.NewInt(2)
+
+	if _, err := r.Resolve(context.Background(), id, s); err != nil {
+		t.Fatal(err)
+	}
+	r.Invalidate(big.NewInt(3))
+	if _, err := r.Resolve(context.Background(), id, s); err != nil {
+		t.Fatal(err)
+	}
+	if next.calls != 1 {
+		t.Fatalf("other identity invalidation dropped the state: %d calls", next.calls)
+	}
+
+	r.Invalidate(id)
+	if _, err := r.Resolve(context.Background(), id, s); err != nil {
+		t.Fatal(err)
+	}
+	if next.calls != 2 {
+		t.Fatalf("expected state to be resolved again, got %d calls", next.calls)
+	}
+}
@@ -0,0 +1,79 @@
+package stateresolver
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	stateabi "github.com/iden3/contracts-abi/state/go/abi"
+	"github.com/iden3/go-iden3-auth/v2/state"
+	"github.com/iden3/go-service-template/pkg/ethrpc"
+	"github.com/iden3/go-service-template/pkg/tracing"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrUnavailable is returned when the state can't be read from the chain,
+// e.g. the rpc timed out, unlike the reverts of the contract, that reject it.
+var ErrUnavailable = errors.New("state contract is unavailable")
+
+// ETHResolver resolves identity states from the State contract
+// through a long-lived contract caller, unlike state.ETHResolver
+// that dials the rpc on every call.
+type ETHResolver struct {
+	caller *stateabi.StateCaller
+}
+
+func NewETHResolver(backend bind.ContractCaller, contractAddress string) (*ETHResolver, error) {
+	caller, err := stateabi.NewStateCaller(common.HexToAddress(contractAddress), backend)
+	if err != nil {
+		return nil, err
+	}
+	return &ETHResolver{caller: caller}, nil
+}
+
+func (r *ETHResolver) Resolve(ctx context.Context, id, s *big.Int) (resolved *state.ResolvedState, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "stateresolver.Resolve", trace.WithAttributes(
+		attribute.String("identity.id", id.String()),
+		attribute.String("identity.state", s.String())))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+	return state.Resolve(ctx, getter{r.caller}, id, s)
+}
+
+func (r *ETHResolver) ResolveGlobalRoot(ctx context.Context, s *big.Int) (resolved *state.ResolvedState, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "stateresolver.ResolveGlobalRoot", trace.WithAttributes(
+		attribute.String("gist.root", s.String())))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+	return state.ResolveGlobalRoot(ctx, getter{r.caller}, s)
+}
+
+// getter marks the failed calls with ErrUnavailable. The reverts are passed
+// as they are, since state.Resolve tells the unknown states by their message.
+type getter struct {
+	caller *stateabi.StateCaller
+}
+
+func (g getter) GetStateInfoByIdAndState(opts *bind.CallOpts, id, s *big.Int) (stateabi.IStateStateInfo, error) {
+	info, err := g.caller.GetStateInfoByIdAndState(opts, id, s)
+	return info, unavailable(err)
+}
+
+func (g getter) GetGISTRootInfo(opts *bind.CallOpts, root *big.Int) (stateabi.IStateGistRootInfo, error) {
+	info, err := g.caller.GetGISTRootInfo(opts, root)
+	return info, unavailable(err)
+}
+
+func unavailable(err error) error {
+	if err == nil || ethrpc.IsRevert(err) {
+		return err
+	}
+	return errors.Wrapf(ErrUnavailable, "%v", err)
+}
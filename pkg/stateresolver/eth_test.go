@@ -0,0 +1,112 @@
+package stateresolver_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/iden3/go-service-template/pkg/stateresolver"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// revertError is the JSON-RPC error of a reverted call.
+type revertError struct{}
+
+func (revertError) Error() string  { return "execution reverted: Root does not exist" }
+func (revertError) ErrorCode() int { return 3 }
+
+type failingCaller struct {
+	err error
+}
+
+func (c failingCaller) CodeAt(context.Context, common.Address, *big.Int) ([]byte, error) {
+	return []byte{1}, nil
+}
+
+func (c failingCaller) CallContract(context.Context, ethereum.CallMsg, *big.Int) ([]byte, error) {
+	return nil, c.err
+}
+
+func TestETHResolverMarksUnavailable(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		unavailable bool
+	}{
+		{"timeout", context.DeadlineExceeded, true},
+		{"connection refused", errors.New("dial tcp 127.0.0.1:8545: connect: connection refused"), true},
+		{"revert", revertError{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := stateresolver.NewETHResolver(failingCaller{err: tt.err},
+				"0x1a4cC30f2aA0377b0c3bc9848766D90cb4404124")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = r.ResolveGlobalRoot(context.Background(), big.NewInt(1))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := errors.Is(err, stateresolver.ErrUnavailable); got != tt.unavailable {
+				t.Fatalf("unavailable is %v for %v", got, err)
+			}
+		})
+	}
+}
+
+func TestResolverSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	})
+
+	// the chain is read in the span of the eth resolver
+	eth, err := stateresolver.NewETHResolver(failingCaller{err: context.DeadlineExceeded},
+		"0x1a4cC30f2aA0377b0c3bc9848766D90cb4404124")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := eth.ResolveGlobalRoot(context.Background(), big.NewInt(1)); err == nil {
+		t.Fatal("expected an error")
+	}
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Name() != "stateresolver.ResolveGlobalRoot" || spans[0].Status().Code != codes.Error {
+		t.Fatalf("unexpected spans: %+v", spans)
+	}
+
+	// the cache adds its lookups to the span of the caller
+	cached := stateresolver.NewCachingResolver(&countingResolver{}, time.Hour, time.Hour)
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "verify")
+	for i := 0; i < 2; i++ {
+		if _, err := cached.Resolve(ctx, big.NewInt(1), big.NewInt(2)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	parent.End()
+	spans = recorder.Ended()[1:]
+	if len(spans) != 1 || spans[0].Name() != "verify" {
+		t.Fatalf("unexpected spans: %+v", spans)
+	}
+	events := spans[0].Events()
+	if len(events) != 2 {
+		t.Fatalf("expected 2 cache lookups, got %+v", events)
+	}
+	for i, hit := range []bool{false, true} {
+		set := attribute.NewSet(events[i].Attributes...)
+		if got, ok := set.Value("cache.hit"); !ok || got.AsBool() != hit {
+			t.Fatalf("lookup %d: unexpected attributes %v", i, events[i].Attributes)
+		}
+	}
+}
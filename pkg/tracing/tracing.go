@@ -0,0 +1,138 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/iden3/go-service-template"
+
+// Exporters of the spans.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// Tracer returns the tracer of the service. Spans are not recorded
+// until a provider is set up with New.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Provider exports the spans of the service.
+type Provider struct {
+	provider *sdktrace.TracerProvider
+}
+
+type options struct {
+	serviceName string
+	sampleRatio float64
+	writer      io.Writer
+}
+
+type Option func(*options)
+
+func WithServiceName(name string) Option {
+	return func(o *options) {
+		o.serviceName = name
+	}
+}
+
+// WithSampleRatio sets the share of the traces that are recorded,
+// unless the caller already decided in the traceparent header.
+func WithSampleRatio(ratio float64) Option {
+	return func(o *options) {
+		o.sampleRatio = ratio
+	}
+}
+
+// WithWriter sets where the stdout exporter writes the spans.
+func WithWriter(w io.Writer) Option {
+	return func(o *options) {
+		o.writer = w
+	}
+}
+
+// New sets up the global tracer provider and the W3C trace context
+// propagation. The OTLP exporter is configured by the standard
+// OTEL_EXPORTER_OTLP_* env vars, e.g. OTEL_EXPORTER_OTLP_ENDPOINT.
+func New(ctx context.Context, exporter string, opts ...Option) (*Provider, error) {
+	o := options{
+		serviceName: "onchain-non-merklized-issuer-demo",
+		sampleRatio: 1,
+		writer:      os.Stdout,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var spanExporter sdktrace.SpanExporter
+	switch exporter {
+	case ExporterNone, "":
+		return &Provider{}, nil
+	case ExporterStdout:
+		e, err := stdouttrace.New(stdouttrace.WithWriter(o.writer))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create stdout exporter")
+		}
+		spanExporter = e
+	case ExporterOTLP:
+		e, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create otlp exporter")
+		}
+		spanExporter = e
+	default:
+		return nil, errors.Errorf("unknown trace exporter '%s'", exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(o.serviceName),
+	))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create trace resource")
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(o.sampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return &Provider{provider: provider}, nil
+}
+
+// Shutdown exports the remaining spans.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	if p.provider == nil {
+		return nil
+	}
+	return p.provider.Shutdown(ctx)
+}
+
+// RecordError marks the span as failed.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,27 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_Stdout(t *testing.T) {
+	var out bytes.Buffer
+	provider, err := New(context.Background(), ExporterStdout, WithWriter(&out), WithServiceName("test-service"))
+	require.NoError(t, err)
+
+	_, span := Tracer().Start(context.Background(), "test span")
+	span.End()
+	require.NoError(t, provider.Shutdown(context.Background()))
+
+	require.Contains(t, out.String(), `"Name":"test span"`)
+	require.Contains(t, out.String(), "test-service")
+}
+
+func TestNew_UnknownExporter(t *testing.T) {
+	_, err := New(context.Background(), "jaeger")
+	require.Error(t, err)
+}
@@ -0,0 +1,53 @@
+package http
+
+import (
+	"context"
+	"sync"
+)
+
+// Group runs several servers, e.g. the public and the admin
+// listeners, and shuts them down together.
+type Group struct {
+	servers []*Server
+}
+
+func NewGroup(servers ...*Server) *Group {
+	return &Group{servers: servers}
+}
+
+// Start starts all the servers and returns the error of the first one
+// that stops, like Server.Start. The others keep running until Shutdown.
+func (g *Group) Start() error {
+	errs := make(chan error, len(g.servers))
+	for _, s := range g.servers {
+		go func(s *Server) {
+			errs <- s.Start()
+		}(s)
+	}
+	return <-errs
+}
+
+// Shutdown shuts the servers down at once and
+// returns the first error of them.
+func (g *Group) Shutdown(ctx context.Context) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for _, s := range g.servers {
+		wg.Add(1)
+		go func(s *Server) {
+			defer wg.Done()
+			if err := s.Shutdown(ctx); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(s)
+	}
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,57 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func freePort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+}
+
+func TestGroup(t *testing.T) {
+	ports := []string{freePort(t), freePort(t)}
+	var servers []*Server
+	for i, port := range ports {
+		body := fmt.Sprint(i)
+		servers = append(servers, New(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(body))
+		}), WithHost("127.0.0.1", port)))
+	}
+	g := NewGroup(servers...)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- g.Start()
+	}()
+
+	for i, port := range ports {
+		require.Eventually(t, func() bool {
+			resp, err := http.Get("http://127.0.0.1:" + port)
+			if err != nil {
+				return false
+			}
+			defer resp.Body.Close()
+			var b [1]byte
+			_, _ = resp.Body.Read(b[:])
+			return string(b[:]) == fmt.Sprint(i)
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	require.NoError(t, g.Shutdown(context.Background()))
+	require.ErrorIs(t, <-errs, http.ErrServerClosed)
+	for _, port := range ports {
+		_, err := http.Get("http://127.0.0.1:" + port)
+		require.Error(t, err)
+	}
+}
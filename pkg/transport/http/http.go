@@ -10,11 +10,14 @@ import (
 )
 
 type Server struct {
+	name   string
 	driver *http.Server
+	tls    *tlsSettings
 }
 
 func New(handler http.Handler, opts ...Option) *Server {
 	s := &Server{
+		name: "public",
 		driver: &http.Server{
 			Addr:         ":8080",
 			ReadTimeout:  30 * time.Second,
@@ -36,6 +39,17 @@ func (s *Server) Shutdown(ctx context.Context) error {
 }
 
 func (s *Server) Start() error {
-	logger.Info("HTTP server started", slog.String("address", s.driver.Addr))
-	return s.driver.ListenAndServe()
+	if s.tls == nil {
+		logger.Info("HTTP server started", slog.String("server", s.name), slog.String("address", s.driver.Addr))
+		return s.driver.ListenAndServe()
+	}
+	cfg, err := s.tls.config()
+	if err != nil {
+		return err
+	}
+	s.driver.TLSConfig = cfg
+	logger.Info("HTTPS server started", slog.String("server", s.name), slog.String("address", s.driver.Addr),
+		slog.Bool("clientCertificates", cfg.ClientCAs != nil))
+	// the certificate is served by the TLS config
+	return s.driver.ListenAndServeTLS("", "")
 }
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"crypto/tls"
 	"fmt"
 	"log"
 	"time"
@@ -8,6 +9,13 @@ import (
 
 type Option func(*Server)
 
+// WithName names the server in the logs, e.g. public or admin.
+func WithName(name string) Option {
+	return func(s *Server) {
+		s.name = name
+	}
+}
+
 func WithHost(address, port string) Option {
 	return func(s *Server) {
 		s.driver.Addr = fmt.Sprintf("%s:%s", address, port)
@@ -31,3 +39,19 @@ func WithLogger(logger *log.Logger) Option {
 		s.driver.ErrorLog = logger
 	}
 }
+
+// WithTLS serves HTTPS with the certificate and the key PEM files.
+// The files are loaded again when they change.
+func WithTLS(certFile, keyFile string, opts ...TLSOption) Option {
+	return func(s *Server) {
+		s.tls = &tlsSettings{
+			certFile:      certFile,
+			keyFile:       keyFile,
+			minVersion:    tls.VersionTLS12,
+			checkInterval: time.Minute,
+		}
+		for _, opt := range opts {
+			opt(s.tls)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/pkg/errors"
+)
+
+type TLSOption func(*tlsSettings)
+
+type tlsSettings struct {
+	certFile      string
+	keyFile       string
+	minVersion    uint16
+	cipherSuites  []uint16
+	clientCAFile  string
+	checkInterval time.Duration
+}
+
+// WithMinVersion sets the minimum TLS version, TLS 1.2 by default.
+func WithMinVersion(version uint16) TLSOption {
+	return func(s *tlsSettings) {
+		s.minVersion = version
+	}
+}
+
+// WithCipherSuites sets the cipher suites of TLS 1.2.
+// The suites of TLS 1.3 are not configurable.
+func WithCipherSuites(suites []uint16) TLSOption {
+	return func(s *tlsSettings) {
+		s.cipherSuites = suites
+	}
+}
+
+// WithClientCAs asks the clients for a certificate and verifies it against
+// the CAs in the PEM file. A client without a certificate can still connect,
+// the routes that need one check the verified chains of the request.
+func WithClientCAs(caFile string) TLSOption {
+	return func(s *tlsSettings) {
+		s.clientCAFile = caFile
+	}
+}
+
+// WithCertCheckInterval sets how often the certificate files
+// are checked for changes, once a minute by default.
+func WithCertCheckInterval(interval time.Duration) TLSOption {
+	return func(s *tlsSettings) {
+		s.checkInterval = interval
+	}
+}
+
+// ParseTLSVersion parses a TLS version like "1.2".
+func ParseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, errors.Errorf("unsupported TLS version '%s', expected 1.2 or 1.3", version)
+	}
+}
+
+// ParseCipherSuites parses the names of the secure cipher suites,
+// like TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256. No names are nil,
+// that means the Go defaults.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	suites := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[strings.TrimSpace(name)]
+		if !ok {
+			return nil, errors.Errorf("unknown or insecure cipher suite '%s'", name)
+		}
+		suites = append(suites, id)
+	}
+	return suites, nil
+}
+
+func (s *tlsSettings) config() (*tls.Config, error) {
+	certs := &certReloader{
+		certFile:      s.certFile,
+		keyFile:       s.keyFile,
+		checkInterval: s.checkInterval,
+	}
+	if err := certs.load(); err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		MinVersion:     s.minVersion,
+		CipherSuites:   s.cipherSuites,
+		GetCertificate: certs.getCertificate,
+	}
+	if s.clientCAFile != "" {
+		pem, err := os.ReadFile(s.clientCAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read client CA file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates in client CA file '%s'", s.clientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg, nil
+}
+
+// certReloader serves the certificate and loads it again when the files
+// change, e.g. when cert-manager renews a mounted secret. A certificate
+// that fails to load is logged and the previous one is kept.
+type certReloader struct {
+	certFile      string
+	keyFile       string
+	checkInterval time.Duration
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.checkedAt) >= c.checkInterval {
+		c.checkedAt = time.Now()
+		if modTime, err := c.lastModified(); err == nil && !modTime.Equal(c.modTime) {
+			if err := c.loadLocked(); err != nil {
+				logger.WithError(err).Error("failed to reload TLS certificate, the previous one is kept",
+					slog.String("certFile", c.certFile))
+			} else {
+				logger.Info("TLS certificate reloaded", slog.String("certFile", c.certFile))
+			}
+		}
+	}
+	return c.cert, nil
+}
+
+func (c *certReloader) load() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checkedAt = time.Now()
+	return c.loadLocked()
+}
+
+func (c *certReloader) loadLocked() error {
+	modTime, err := c.lastModified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to load TLS certificate")
+	}
+	c.cert = &cert
+	c.modTime = modTime
+	return nil
+}
+
+// lastModified is the latest modification time of the
+// certificate and the key, that can be replaced separately.
+func (c *certReloader) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, "failed to stat TLS certificate")
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
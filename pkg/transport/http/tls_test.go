@@ -0,0 +1,240 @@
+package http
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	if err := logger.SetDefaultLogger(logger.EnvDevelopment, slog.LevelError); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// issue returns the PEM certificate and key signed by the CA.
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, content []byte) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+}
+
+// startTLSServer starts the server on a free local port and returns its URL.
+func startTLSServer(t *testing.T, handler http.Handler, certFile, keyFile string, opts ...TLSOption) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+
+	s := New(handler, WithHost("127.0.0.1", strconv.Itoa(port)), WithTLS(certFile, keyFile, opts...))
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Start()
+	}()
+	t.Cleanup(func() {
+		require.NoError(t, s.Shutdown(context.Background()))
+		require.ErrorIs(t, <-errs, http.ErrServerClosed)
+	})
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			_ = conn.Close()
+		}
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	return "https://" + addr
+}
+
+func newClient(cfg *tls.Config) *http.Client {
+	return &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: cfg, DisableKeepAlives: true},
+	}
+}
+
+// serverName returns the common name of the certificate the server presents.
+func serverName(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+	resp, err := client.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	return resp.TLS.PeerCertificates[0].Subject.CommonName
+}
+
+func TestServer_TLSReloadsCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, "first", x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+
+	url := startTLSServer(t, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}),
+		certFile, keyFile, WithCertCheckInterval(0))
+	client := newClient(&tls.Config{RootCAs: ca.pool(), MinVersion: tls.VersionTLS12})
+	require.Equal(t, "first", serverName(t, client, url))
+
+	// a broken pair keeps the previous certificate
+	writeFile(t, keyFile, []byte("not a key"))
+	require.Equal(t, "first", serverName(t, client, url))
+
+	certPEM, keyPEM = ca.issue(t, "second", x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+	// the modification time has to change for the check
+	later := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(keyFile, later, later))
+	require.Equal(t, "second", serverName(t, client, url))
+}
+
+func TestServer_TLSMinVersion(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+
+	url := startTLSServer(t, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}),
+		certFile, keyFile, WithMinVersion(tls.VersionTLS13))
+
+	_, err := newClient(&tls.Config{RootCAs: ca.pool(), MaxVersion: tls.VersionTLS12}).Get(url)
+	require.Error(t, err)
+	require.Equal(t, "server", serverName(t, newClient(&tls.Config{RootCAs: ca.pool(), MinVersion: tls.VersionTLS13}), url))
+}
+
+func TestServer_ClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	caFile := filepath.Join(dir, "ca.crt")
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+	writeFile(t, caFile, ca.pem)
+
+	verified := make(chan bool, 1)
+	url := startTLSServer(t, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		verified <- len(r.TLS.VerifiedChains) > 0
+	}), certFile, keyFile, WithClientCAs(caFile))
+
+	// the certificate is optional on the connection
+	require.Equal(t, "server", serverName(t, newClient(&tls.Config{RootCAs: ca.pool(), MinVersion: tls.VersionTLS12}), url))
+	require.False(t, <-verified)
+
+	clientPEM, clientKeyPEM := ca.issue(t, "admin", x509.ExtKeyUsageClientAuth)
+	clientCert, err := tls.X509KeyPair(clientPEM, clientKeyPEM)
+	require.NoError(t, err)
+	client := newClient(&tls.Config{
+		RootCAs:      ca.pool(),
+		Certificates: []tls.Certificate{clientCert},
+		MinVersion:   tls.VersionTLS12,
+	})
+	require.Equal(t, "server", serverName(t, client, url))
+	require.True(t, <-verified)
+
+	// a certificate of another CA is rejected in the handshake
+	otherPEM, otherKeyPEM := newTestCA(t).issue(t, "intruder", x509.ExtKeyUsageClientAuth)
+	otherCert, err := tls.X509KeyPair(otherPEM, otherKeyPEM)
+	require.NoError(t, err)
+	_, err = newClient(&tls.Config{
+		RootCAs:      ca.pool(),
+		Certificates: []tls.Certificate{otherCert},
+		MinVersion:   tls.VersionTLS12,
+	}).Get(url)
+	require.Error(t, err)
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	suites, err := ParseCipherSuites(nil)
+	require.NoError(t, err)
+	require.Nil(t, suites)
+
+	suites, err = ParseCipherSuites([]string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"})
+	require.NoError(t, err)
+	require.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, suites)
+
+	_, err = ParseCipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"})
+	require.Error(t, err)
+}
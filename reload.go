@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math/big"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iden3/go-iden3-auth/v2/loaders"
+	"github.com/iden3/go-service-template/config"
+	"github.com/iden3/go-service-template/pkg/ethrpc"
+	"github.com/iden3/go-service-template/pkg/indexer"
+	"github.com/iden3/go-service-template/pkg/logger"
+	"github.com/iden3/go-service-template/pkg/metrics"
+	"github.com/iden3/go-service-template/pkg/services/authentication"
+	"github.com/iden3/go-service-template/pkg/services/issuer"
+	"github.com/iden3/go-service-template/pkg/services/system"
+	"github.com/iden3/go-service-template/pkg/stateresolver"
+	"github.com/pkg/errors"
+)
+
+// reloader applies a changed config to the running services: the issuers,
+// the rpc clients, the state resolvers and the indexer targets. The other
+// settings take effect after a restart.
+type reloader struct {
+	path string
+
+	mu  sync.Mutex
+	cfg *config.Config
+	// rpcclients are swapped by Reload and read without the lock,
+	// so that the metrics are scraped while a reload dials
+	rpcclients atomic.Pointer[map[string]*ethrpc.Client]
+	// retiring closes the replaced rpc clients, done cuts their delay on shutdown
+	retiring sync.WaitGroup
+	done     chan struct{}
+
+	stateCaches           atomic.Pointer[[]*stateresolver.CachingResolver]
+	authenticationService *authentication.AuthenticationService
+	sessionStore          *authentication.RedisStore
+	issuerService         *issuer.IssuerService
+	indexer               *indexer.Indexer
+	readiness             *system.ReadinessService
+	startup               *system.StartupService
+	version               *system.VersionService
+	keys                  *authentication.KeyCache
+}
+
+func (r *reloader) invalidateState(id *big.Int) {
+	for _, c := range *r.stateCaches.Load() {
+		c.Invalidate(id)
+	}
+}
+
+// Config returns the running config.
+func (r *reloader) Config() *config.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cfg
+}
+
+func (r *reloader) Reload(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := config.Load(r.path)
+	if err != nil {
+		return err
+	}
+	if err = cfg.Validate(); err != nil {
+		return err
+	}
+
+	changes := config.Diff(r.cfg, cfg)
+	if len(changes) == 0 {
+		logger.Info("config has no changes")
+		return nil
+	}
+	for _, c := range changes {
+		if c.Reloadable {
+			logger.Info("config changed", slog.String("change", c.String()))
+		} else {
+			logger.Warn("config change requires a restart", slog.String("change", c.String()))
+		}
+	}
+
+	chains, err := initializationChainRegistry(cfg)
+	if err != nil {
+		return err
+	}
+	rpcclients, dialed, err := r.reuseRPCClients(cfg)
+	if err != nil {
+		return err
+	}
+	keys := r.keys
+	if cfg.KeysDirPath != r.cfg.KeysDirPath {
+		keys = authentication.NewKeyCache(loaders.FSKeyLoader{Dir: cfg.KeysDirPath})
+	}
+	verifier, stateCaches, err := initializationAuthVerifier(cfg, chains, rpcclients, keys)
+	if err != nil {
+		closeRPCClients(dialed)
+		return err
+	}
+	targets, err := initializationIndexerTargets(cfg, rpcclients)
+	if err != nil {
+		closeRPCClients(dialed)
+		return err
+	}
+
+	// the auth sessions are kept by the authentication service,
+	// so the logins in progress continue with the new verifier
+	r.authenticationService.SetVerifier(verifier)
+	r.stateCaches.Store(&stateCaches)
+	r.issuerService.Update(
+		cfg.Issuers,
+		contractCallers(rpcclients),
+		cfg.SupportedStateContracts,
+		issuer.WithMetadata(issuerMetadata(cfg)),
+	)
+	if err = r.indexer.Reload(ctx, targets); err != nil {
+		logger.WithError(err).Error("error reloading indexer")
+	}
+
+	// settings that need a restart keep their running values
+	cfg.Log = r.cfg.Log
+	cfg.HTTPServer = r.cfg.HTTPServer
+	cfg.Admin = r.cfg.Admin
+	cfg.ExternalHost = r.cfg.ExternalHost
+	cfg.MongoDBConnectionString = r.cfg.MongoDBConnectionString
+	cfg.RateLimit = r.cfg.RateLimit
+	cfg.Auth = r.cfg.Auth
+	cfg.Shutdown = r.cfg.Shutdown
+	cfg.Readiness = r.cfg.Readiness
+	cfg.Startup = r.cfg.Startup
+	cfg.Tracing = r.cfg.Tracing
+	startBlocks := cfg.Indexer.StartBlocks
+	cfg.Indexer = r.cfg.Indexer
+	cfg.Indexer.StartBlocks = startBlocks
+
+	// the checks move to the new clients before the unused ones are closed
+	r.readiness.Update(r.readinessCheckers(cfg, rpcclients)...)
+	unused := make(map[string]*ethrpc.Client)
+	for network, client := range *r.rpcclients.Load() {
+		if rpcclients[network] != client {
+			unused[network] = client
+		}
+	}
+	// the verifications in flight may still use the unused clients, they get
+	// as long as the requests in flight get to finish on shutdown
+	r.retire(unused, cfg.Auth.GracePeriod+cfg.Shutdown.Timeout)
+
+	r.cfg = cfg
+	r.rpcclients.Store(&rpcclients)
+	r.keys = keys
+	return nil
+}
+
+// retire closes the clients after the delay, or on shutdown.
+// It must be called with the lock held.
+func (r *reloader) retire(clients map[string]*ethrpc.Client, delay time.Duration) {
+	if len(clients) == 0 {
+		return
+	}
+	r.retiring.Add(1)
+	go func() {
+		defer r.retiring.Done()
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.done:
+		}
+		closeRPCClients(clients)
+	}()
+}
+
+// rpcEndpoints reports the health of the endpoints of the running clients.
+func (r *reloader) rpcEndpoints() []metrics.RPCEndpoint {
+	var endpoints []metrics.RPCEndpoint
+	for _, client := range *r.rpcclients.Load() {
+		for _, e := range client.Endpoints() {
+			endpoints = append(endpoints, metrics.RPCEndpoint{
+				Chain:       client.ChainID(),
+				URL:         e.URL,
+				Healthy:     e.Healthy,
+				Latency:     e.Latency,
+				BlockNumber: e.BlockNumber,
+			})
+		}
+	}
+	return endpoints
+}
+
+// readinessCheckers checks the rpc of every chain, the session store,
+// the verification key and the issuer contracts.
+func (r *reloader) readinessCheckers(cfg *config.Config, rpcclients map[string]*ethrpc.Client) []system.ReadyChecker {
+	networks := make([]string, 0, len(rpcclients))
+	for network := range rpcclients {
+		networks = append(networks, network)
+	}
+	slices.Sort(networks)
+
+	checkers := make([]system.ReadyChecker, 0, len(networks)+3)
+	for _, network := range networks {
+		client := rpcclients[network]
+		checkers = append(checkers, system.NewCheck("rpc:"+network, func(ctx context.Context) error {
+			return client.CheckFreshness(ctx, cfg.Readiness.MaxBlockAge)
+		}))
+	}
+	if r.sessionStore != nil {
+		checkers = append(checkers, system.NewCheck("session_store", r.sessionStore.Ping))
+	}
+	keys := loaders.FSKeyLoader{Dir: cfg.KeysDirPath}
+	checkers = append(checkers,
+		system.NewCheck("verification_key", func(context.Context) error {
+			return authentication.CheckVerificationKey(keys)
+		}),
+		system.NewCheck("issuer_contracts", r.issuerService.CheckContracts),
+	)
+	return checkers
+}
+
+// reuseRPCClients keeps the clients of the networks with the same urls
+// and dials the others. It returns all the clients and the dialed ones.
+func (r *reloader) reuseRPCClients(
+	cfg *config.Config,
+) (clients, dialed map[string]*ethrpc.Client, err error) {
+	running := *r.rpcclients.Load()
+	clients = make(map[string]*ethrpc.Client, len(cfg.SupportedRPC))
+	dialed = make(map[string]*ethrpc.Client)
+	for network, urls := range cfg.SupportedRPC {
+		client, ok := running[network]
+		if ok && slices.Equal(urls, r.cfg.SupportedRPC[network]) && cfg.RPC == r.cfg.RPC {
+			clients[network] = client
+			continue
+		}
+		client, err = dialRPC(cfg, network, urls)
+		if err != nil {
+			closeRPCClients(dialed)
+			return nil, nil, errors.Wrap(err, "error creating rpc clients")
+		}
+		clients[network] = client
+		dialed[network] = client
+	}
+	return clients, dialed, nil
+}
+
+// Shutdown closes the rpc clients, with the ones replaced by a reload.
+func (r *reloader) Shutdown(_ context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	close(r.done)
+	r.retiring.Wait()
+	closeRPCClients(*r.rpcclients.Load())
+	return nil
+}
+
+// deployment returns the chains and the issuers of the running config.
+func (r *reloader) deployment() system.Deployment {
+	cfg := r.Config()
+	chains := make([]string, 0, len(cfg.SupportedRPC))
+	for network := range cfg.SupportedRPC {
+		chains = append(chains, network)
+	}
+	slices.Sort(chains)
+	return system.Deployment{
+		Chains:  chains,
+		Issuers: slices.Clone(cfg.Issuers),
+	}
+}
+
+// warmUps load the verification keys, connect to the rpc of every
+// chain and fetch the state of every issuer, so that the first
+// login of a cold instance doesn't wait for them.
+func (r *reloader) warmUps(cfg *config.Config, rpcclients map[string]*ethrpc.Client) []system.WarmUp {
+	// no login is verified without the keys and the rpc
+	warmUps := []system.WarmUp{{
+		Name: "verification_keys",
+		Run: func(context.Context) error {
+			ids, err := authentication.CircuitKeys(cfg.KeysDirPath)
+			if err != nil {
+				return err
+			}
+			return r.keys.Preload(ids...)
+		},
+		Required: true,
+	}}
+	for network, client := range rpcclients {
+		client := client
+		warmUps = append(warmUps, system.WarmUp{
+			Name: "rpc:" + network,
+			Run: func(ctx context.Context) error {
+				client.CheckHealth(ctx)
+				_, err := client.BlockNumber(ctx)
+				return err
+			},
+			Required: true,
+		})
+	}
+	warmUps = append(warmUps, system.WarmUp{
+		Name: "issuers",
+		Run: func(ctx context.Context) error {
+			for _, issuerDID := range cfg.Issuers {
+				if _, err := r.issuerService.GetIssuer(ctx, issuerDID); err != nil {
+					return errors.Wrapf(err, "failed to resolve the issuer '%s'", issuerDID)
+				}
+				// an issuer that has not published a state yet is fine
+				_, err := r.issuerService.GetIssuerState(ctx, issuerDID)
+				if err != nil && !errors.Is(err, issuer.ErrStateNotFound) {
+					return errors.Wrapf(err, "failed to fetch the state of '%s'", issuerDID)
+				}
+			}
+			return nil
+		},
+	})
+	return warmUps
+}